@@ -6,26 +6,64 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/fcharlie/buna/debug/depends"
 	"github.com/fcharlie/buna/debug/pe"
 )
 
-const (
-	MaxDepth = 200
-)
+// AssetInfo is the version information of a collected file
+type AssetInfo struct {
+	Path        string
+	ProductName string
+	FileVersion string
+	CompanyName string
+}
 
 type Assets struct {
-	filename string
-	location string
-	depends  map[string]string
-	depth    int
+	filename   string
+	location   string
+	depends    map[string]string
+	assemblies map[string]bool
+	system     []pe.AssemblyIdentity
+	infos      map[string]*AssetInfo
+	parsed     map[string]bool
+	resolver   *depends.WindowsResolver
+	walker     *depends.Walker
+}
+
+// NewAssets returns the assets of filename, whose DLLs are resolved in
+// the Windows loader search order with the system directories sysDirs.
+func NewAssets(filename string, sysDirs []string) *Assets {
+	location := filepath.Dir(filename)
+	resolver := depends.NewWindowsResolver(location)
+	if len(sysDirs) != 0 {
+		resolver.SystemDirs = sysDirs
+	}
+	return &Assets{
+		filename:   filename,
+		location:   location,
+		resolver:   resolver,
+		walker:     &depends.Walker{PE: resolver},
+		depends:    make(map[string]string),
+		assemblies: make(map[string]bool),
+		infos:      make(map[string]*AssetInfo),
+		parsed:     make(map[string]bool),
+	}
 }
 
-func NewAssets(filename string) *Assets {
-	return &Assets{filename: filename, location: filepath.Dir(filename), depends: make(map[string]string)}
+// LoadAPISet reads the API set schema of an apisetschema.dll. Without
+// it, the schema of the first system directory is used if present.
+func (a *Assets) LoadAPISet(path string) error {
+	return a.resolver.LoadAPISet(path)
 }
 
 func (a *Assets) Parse() error {
+	if a.resolver.APISet == nil && len(a.resolver.SystemDirs) != 0 {
+		// Best effort, API set contracts are then searched as files.
+		_ = a.resolver.LoadAPISet(filepath.Join(a.resolver.SystemDirs[0], "apisetschema.dll"))
+	}
 	return a.parse(a.filename)
 }
 
@@ -36,55 +74,250 @@ func (a *Assets) isunrecorded(dllname string) bool {
 	return true
 }
 
+// parse walks the DLLs filename depends on and records those the
+// loader finds in the application directory: KnownDLLs, API set
+// contracts and system DLLs come with Windows even when a copy sits
+// next to the executable. The managed and side-by-side dependencies of
+// the recorded files are parsed in turn.
 func (a *Assets) parse(filename string) error {
-	a.depth++
-	defer func() {
-		a.depth--
-	}()
+	if a.parsed[filename] {
+		return nil
+	}
+	g, err := a.walker.Walk(filename)
+	if err != nil {
+		return err
+	}
+	local := []*depends.Module{g.Root}
+	for _, m := range g.Modules {
+		for _, d := range m.Deps {
+			if d.Location == depends.FromAppDir && d.Module != nil && !d.Cycle {
+				local = append(local, d.Module)
+			}
+		}
+	}
+	for _, m := range local {
+		if a.parsed[m.Path] {
+			continue
+		}
+		a.parsed[m.Path] = true
+		if m.Err != nil {
+			return fmt.Errorf("%s: %v", m.Path, m.Err)
+		}
+		if m != g.Root {
+			a.depends[a.relative(m.Path)] = m.Path
+		}
+		if err := a.parseModule(m.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseModule records the version information of the PE file filename
+// and follows its managed and side-by-side dependencies.
+func (a *Assets) parseModule(filename string) error {
 	fd, err := pe.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
-	tables, err := fd.LookupFunctionTable()
-	if err != nil {
+	a.record(filename, fd)
+	if err := a.parseManaged(fd); err != nil {
 		return err
 	}
-	for d := range tables.Imports {
-		if !a.isunrecorded(d) {
-			continue // dll recorded
-		}
-		p := filepath.Join(a.location, d)
-		if _, err := os.Stat(p); err != nil {
-			continue
+	return a.parseAssemblies(fd)
+}
+
+// parseManaged follows the assembly references and the P/Invoke
+// modules of a managed image. Framework assemblies and system DLLs are
+// not in the application directory and are skipped.
+func (a *Assets) parseManaged(fd *pe.File) error {
+	md, err := fd.LookupCLRMetadata()
+	if err != nil || md == nil || md.Tables == nil {
+		return nil
+	}
+	for _, ref := range md.Tables.AssemblyRefs {
+		candidates := a.candidates(a.location, ref.Name+".dll", ref.Name+".exe", filepath.Join(ref.Name, ref.Name+".dll"))
+		if err := a.parseFirst(candidates); err != nil {
+			return err
 		}
-		if a.depth > MaxDepth {
-			continue
+	}
+	for _, ref := range md.Tables.ModuleRefs {
+		names := []string{ref.Name}
+		if !strings.EqualFold(filepath.Ext(ref.Name), ".dll") {
+			names = append(names, ref.Name+".dll")
 		}
-		if err := a.parse(p); err != nil {
+		if err := a.parseFirst(a.candidates(a.location, names...)); err != nil {
 			return err
 		}
-		a.depends[d] = p
 	}
-	for d := range tables.Delay {
-		if !a.isunrecorded(d) {
-			continue // dll recorded
+	return nil
+}
+
+// parseFirst records the first of candidates that exists.
+func (a *Assets) parseFirst(candidates []string) error {
+	for _, p := range candidates {
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return a.parseFile(p)
 		}
-		p := filepath.Join(a.location, d)
+	}
+	return nil
+}
+
+// parseAssemblies follows the side-by-side assemblies the embedded
+// manifest of fd depends on. A malformed manifest is ignored, the
+// loader would refuse the file anyway.
+func (a *Assets) parseAssemblies(fd *pe.File) error {
+	m, err := fd.LookupManifest()
+	if err != nil || m == nil {
+		return nil
+	}
+	for _, dep := range m.Dependencies {
+		if a.assemblies[dep.Name] {
+			continue // assembly recorded
+		}
+		a.assemblies[dep.Name] = true
+		if err := a.parseAssembly(dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseAssembly probes the application directory for the private
+// assembly dep in the order the loader does. Shared assemblies such as
+// Microsoft.Windows.Common-Controls live in WinSxS and are not bundled,
+// unless a copy is deployed privately they are recorded as system
+// dependencies.
+func (a *Assets) parseAssembly(dep pe.AssemblyIdentity) error {
+	candidates := a.candidates(a.location,
+		dep.Name+".dll",
+		dep.Name+".manifest",
+		filepath.Join(dep.Name, dep.Name+".dll"),
+		filepath.Join(dep.Name, dep.Name+".manifest"),
+	)
+	for _, p := range candidates {
 		if _, err := os.Stat(p); err != nil {
 			continue
 		}
-		if a.depth > MaxDepth {
-			continue
+		if strings.HasSuffix(p, ".dll") {
+			// The assembly manifest is embedded in the DLL.
+			return a.parseFile(p)
 		}
-		if err := a.parse(p); err != nil {
+		data, err := os.ReadFile(p)
+		if err != nil {
 			return err
 		}
-		a.depends[d] = p
+		m, err := pe.ParseManifest(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		a.depends[a.relative(p)] = p
+		for _, name := range m.Files {
+			files := a.candidates(filepath.Dir(p), name)
+			if len(files) == 0 {
+				return fmt.Errorf("%s: invalid file name %q", p, name)
+			}
+			if err := a.parseFile(files[0]); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+	if isSharedAssembly(dep) {
+		a.system = append(a.system, dep)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "side-by-side assembly %s not found in application directory\n", dep)
 	return nil
 }
 
+// isSharedAssembly reports whether dep is a shared assembly installed
+// in WinSxS: shared assemblies are strong named.
+func isSharedAssembly(dep pe.AssemblyIdentity) bool {
+	return dep.PublicKeyToken != "" || strings.HasPrefix(strings.ToLower(dep.Name), "microsoft.windows.")
+}
+
+// SystemAssemblies returns the shared side-by-side assemblies the files
+// depend on, which come with Windows.
+func (a *Assets) SystemAssemblies() []pe.AssemblyIdentity {
+	return a.system
+}
+
+// candidates returns the paths of names in dir. Names come from the
+// files and may use either separator: those that are absolute or escape
+// the application directory are dropped.
+func (a *Assets) candidates(dir string, names ...string) []string {
+	var paths []string
+	for _, name := range names {
+		name = filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+		if name == "" || filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(name, string(filepath.Separator)) {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		if rel, err := filepath.Rel(a.location, p); err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// parseFile records a file of a private assembly and its dependencies.
+func (a *Assets) parseFile(p string) error {
+	name := a.relative(p)
+	if !a.isunrecorded(name) {
+		return nil
+	}
+	if _, err := os.Stat(p); err != nil {
+		return nil
+	}
+	if err := a.parse(p); err != nil {
+		return err
+	}
+	a.depends[name] = p
+	return nil
+}
+
+// relative returns the name of p inside the application directory, its
+// base name if p is not in it.
+func (a *Assets) relative(p string) string {
+	if rel, err := filepath.Rel(a.location, p); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return filepath.Base(p)
+}
+
+// record collects the version information of filename. A missing or
+// malformed version resource is not fatal, the fields are left empty.
+func (a *Assets) record(filename string, fd *pe.File) {
+	info := &AssetInfo{Path: filename}
+	a.infos[filename] = info
+	vi, err := fd.LookupVersionInfo()
+	if err != nil || vi == nil {
+		return
+	}
+	info.ProductName = vi.String(pe.VersionProductName)
+	info.CompanyName = vi.String(pe.VersionCompanyName)
+	info.FileVersion = vi.String(pe.VersionFileVersion)
+	if info.FileVersion == "" && vi.Fixed != nil {
+		info.FileVersion = vi.Fixed.FileVersion().String()
+	}
+}
+
+// Infos returns the version information of the file and its
+// dependencies, sorted by path
+func (a *Assets) Infos() []*AssetInfo {
+	infos := make([]*AssetInfo, 0, len(a.infos))
+	for _, info := range a.infos {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Path < infos[j].Path
+	})
+	return infos
+}
+
 func (a *Assets) Write(outfile string) error {
 	fd, err := os.Create(outfile)
 	if err != nil {
@@ -116,7 +349,7 @@ func (a *Assets) compressFile(zw *zip.Writer, filename string) error {
 	if fi.IsDir() {
 		return nil
 	}
-	hdr.Name = filepath.Base(filename)
+	hdr.Name = filepath.ToSlash(a.relative(filename))
 	hdr.Method = zip.Deflate
 	w, err := zw.CreateHeader(hdr)
 	if err != nil {
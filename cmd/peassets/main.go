@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,18 +9,41 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s pefile\n", os.Args[0])
+	apiset := flag.String("apiset", "", "apisetschema.dll to resolve API set contracts with")
+	sysdir := flag.String("sysdir", "", "system directories searched for DLLs, separated by "+string(filepath.ListSeparator))
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] pefile\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
-	a := NewAssets(os.Args[1])
+	var sysDirs []string
+	if *sysdir != "" {
+		sysDirs = filepath.SplitList(*sysdir)
+	}
+	a := NewAssets(flag.Arg(0), sysDirs)
+	if *apiset != "" {
+		if err := a.LoadAPISet(*apiset); err != nil {
+			fmt.Fprintf(os.Stderr, "unable load api set schema: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	if err := a.Parse(); err != nil {
 		fmt.Fprintf(os.Stderr, "unable parse pefile: %v\n", err)
 		os.Exit(1)
 	}
-	baseName := strings.TrimSuffix(filepath.Base(os.Args[1]), ".exe") + ".zip"
+	for _, id := range a.SystemAssemblies() {
+		fmt.Fprintf(os.Stderr, "system assembly %s\n", id)
+	}
+	baseName := strings.TrimSuffix(filepath.Base(flag.Arg(0)), ".exe") + ".zip"
 	if err := a.Write(baseName); err != nil {
 		fmt.Fprintf(os.Stderr, "unable write file: %v\n", err)
 		os.Exit(1)
 	}
+	for _, info := range a.Infos() {
+		fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\n", filepath.Base(info.Path), info.ProductName, info.FileVersion, info.CompanyName)
+	}
 }
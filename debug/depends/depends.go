@@ -0,0 +1,382 @@
+// Package depends builds the dependency graph of PE, ELF and Mach-O
+// binaries, resolving the shared libraries they import the way the
+// system loader does.
+package depends
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/elf"
+	"github.com/fcharlie/buna/debug/macho"
+	"github.com/fcharlie/buna/debug/mime"
+)
+
+// Location is where a library was found.
+type Location int
+
+const (
+	NotFound        Location = iota
+	FromAPISet               // host DLL of an API set contract
+	FromKnownDLLs            // Windows KnownDLLs
+	FromAppDir               // directory of the executable
+	FromSystemDir            // Windows system directories
+	FromPath                 // PATH directories
+	FromFilePath             // path in the import, after @loader_path, @executable_path or $ORIGIN expansion
+	FromRPath                // ELF DT_RPATH or Mach-O LC_RPATH
+	FromRunPath              // ELF DT_RUNPATH
+	FromLibraryPath          // LD_LIBRARY_PATH or DYLD_LIBRARY_PATH
+	FromDefaultDirs          // ld.so.conf and default directories, or the dyld fallback path
+	FromSharedCache          // dyld shared cache, not on disk
+)
+
+var locationNames = [...]string{
+	NotFound:        "not found",
+	FromAPISet:      "api set",
+	FromKnownDLLs:   "known dlls",
+	FromAppDir:      "application directory",
+	FromSystemDir:   "system directory",
+	FromPath:        "PATH",
+	FromFilePath:    "file path",
+	FromRPath:       "rpath",
+	FromRunPath:     "runpath",
+	FromLibraryPath: "library path",
+	FromDefaultDirs: "default directories",
+	FromSharedCache: "shared cache",
+}
+
+func (l Location) String() string {
+	if int(l) < len(locationNames) {
+		return locationNames[l]
+	}
+	return "unknown"
+}
+
+// Resolution is the outcome of resolving an imported library. A
+// library found without a Path is provided by the system, such as a
+// KnownDLL without system directories to look it up in, and is not
+// inspected.
+type Resolution struct {
+	Name     string   // imported name
+	Host     string   // host DLL of an API set contract, or Name
+	Path     string   // empty if the library was not found
+	Location Location // how the library was found
+}
+
+// A Resolver resolves the library name imported by the last module of
+// chain, the modules loading one another from the executable.
+type Resolver interface {
+	Resolve(name string, chain []*Module) Resolution
+}
+
+// Symbol is a symbol imported from Library. Library is empty for ELF
+// symbols without version information, which may come from any module.
+type Symbol struct {
+	Library string
+	Name    string
+}
+
+func (s Symbol) String() string {
+	if s.Library == "" {
+		return s.Name
+	}
+	return s.Library + "!" + s.Name
+}
+
+// Dependency is a library imported by a module.
+type Dependency struct {
+	Resolution
+	Delay  bool    // PE delay-load import
+	Weak   bool    // Mach-O weak import, loading does not fail if missing
+	Module *Module // nil if the library is missing or not inspected
+	// Cycle reports that Module is already being loaded by one of the
+	// importers; its dependencies are those of the first occurrence.
+	Cycle bool
+}
+
+// Missing reports whether the loader does not find the library.
+func (d *Dependency) Missing() bool {
+	return d.Location == NotFound
+}
+
+// Module is a binary of the dependency graph.
+type Module struct {
+	Path       string
+	Format     mime.BinType
+	Deps       []*Dependency
+	Unresolved []Symbol // imported symbols none of the dependencies export
+	Err        error    // the module could not be decoded
+	// Warnings has the errors decoding optional parts of the module,
+	// such as the Mach-O binds, which are then skipped.
+	Warnings []error
+
+	imports []importedSymbol
+	exports map[string]bool
+	// partialExports is set if exports may be missing some: the imports
+	// of the module are then not checked.
+	partialExports bool
+
+	// ELF
+	elfClass   elf.Class
+	elfMachine elf.Machine
+	rpath      []string
+	runpath    []string
+
+	// Mach-O
+	machoCPU  macho.Cpu
+	rpaths    []string
+	reexports []int // indices of re-exported libraries in Deps
+}
+
+// importedSymbol is a symbol a module imports, from the dependency at
+// index dep of Deps, or from any module if dep is negative.
+type importedSymbol struct {
+	dep  int
+	name string
+	weak bool
+}
+
+// Graph is the dependency graph of an executable.
+type Graph struct {
+	Root    *Module
+	Modules []*Module   // in load order
+	Cycles  [][]*Module // chains of modules loading the first one again
+
+	byPath map[string]*Module
+}
+
+// Missing returns the sorted names of the libraries not found, except
+// the weak ones the modules load without.
+func (g *Graph) Missing() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range g.Modules {
+		for _, d := range m.Deps {
+			if d.Missing() && !d.Weak && !seen[d.Name] {
+				seen[d.Name] = true
+				names = append(names, d.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Walker builds dependency graphs. A nil resolver is replaced by the
+// default one of the format.
+type Walker struct {
+	PE    Resolver
+	ELF   Resolver
+	MachO Resolver
+	// Symbols enables the check of the imported symbols against the
+	// exports of the dependencies.
+	Symbols bool
+}
+
+// Walk builds the dependency graph of the executable at path. Only a
+// failure to decode the executable is an error, the failures of its
+// dependencies are recorded in the modules.
+func (w *Walker) Walk(path string) (*Graph, error) {
+	g := &Graph{byPath: make(map[string]*Module)}
+	root := w.load(path, nil)
+	if root.Err != nil {
+		return nil, root.Err
+	}
+	g.Root = root
+	g.add(root)
+	w.walk(g, []*Module{root})
+	if w.Symbols {
+		g.checkSymbols()
+	}
+	return g, nil
+}
+
+func (g *Graph) add(m *Module) {
+	g.byPath[m.Path] = m
+	g.Modules = append(g.Modules, m)
+}
+
+// walk resolves the dependencies of the last module of chain, depth
+// first.
+func (w *Walker) walk(g *Graph, chain []*Module) {
+	m := chain[len(chain)-1]
+	r := w.resolver(m.Format)
+	for _, d := range m.Deps {
+		d.Resolution = r.Resolve(d.Name, chain)
+		if d.Path == "" {
+			continue
+		}
+		if dm, ok := g.byPath[d.Path]; ok {
+			d.Module = dm
+			for i, c := range chain {
+				if c == dm {
+					d.Cycle = true
+					g.Cycles = append(g.Cycles, append(append([]*Module(nil), chain[i:]...), dm))
+					break
+				}
+			}
+			continue
+		}
+		d.Module = w.load(d.Path, chain)
+		g.add(d.Module)
+		if d.Module.Err == nil {
+			w.walk(g, append(chain, d.Module))
+		}
+	}
+}
+
+func (w *Walker) resolver(format mime.BinType) Resolver {
+	switch {
+	case format.IsPE():
+		if w.PE == nil {
+			w.PE = NewWindowsResolver("")
+		}
+		return w.PE
+	case format.IsElf():
+		if w.ELF == nil {
+			w.ELF = NewELFResolver("")
+		}
+		return w.ELF
+	default:
+		if w.MachO == nil {
+			w.MachO = NewMachOResolver("")
+		}
+		return w.MachO
+	}
+}
+
+// load decodes the module at path, loaded by chain.
+func (w *Walker) load(path string, chain []*Module) *Module {
+	m := &Module{Path: path}
+	format, err := Detect(path)
+	if err != nil {
+		m.Err = err
+		return m
+	}
+	m.Format = format
+	switch {
+	case format.IsPE():
+		m.Err = m.loadPE()
+	case format.IsElf():
+		m.Err = m.loadELF()
+	case format.IsMachO():
+		var cpu macho.Cpu
+		if len(chain) != 0 {
+			cpu = chain[0].machoCPU
+		}
+		m.Err = m.loadMachO(cpu)
+	}
+	return m
+}
+
+// Detect returns the format of the binary at path from its header, as
+// Walk does to pick the resolver.
+func Detect(path string) (mime.BinType, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	var b [64]byte
+	n, err := io.ReadFull(fd, b[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	_, format, err := mime.Detect(b[:n])
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return format, nil
+}
+
+// checkSymbols records the imported symbols of each module that its
+// dependencies do not export. Symbols from missing or uninspected
+// libraries are not reported, the libraries are.
+func (g *Graph) checkSymbols() {
+	for _, m := range g.Modules {
+		if m.Err != nil {
+			continue
+		}
+		for _, s := range m.imports {
+			if s.weak || g.defines(m, s) {
+				continue
+			}
+			lib := ""
+			if s.dep >= 0 {
+				lib = m.Deps[s.dep].Name
+			}
+			m.Unresolved = append(m.Unresolved, Symbol{Library: lib, Name: s.name})
+		}
+	}
+}
+
+// defines reports whether the symbol s imported by m is defined, or
+// cannot be checked.
+func (g *Graph) defines(m *Module, s importedSymbol) bool {
+	if s.dep >= 0 {
+		d := m.Deps[s.dep]
+		if d.Module == nil || !d.Module.checkable() {
+			return true
+		}
+		return d.Module.exported(s.name, make(map[*Module]bool))
+	}
+	// Flat namespace: the loader searches all the modules, in load order.
+	for _, o := range g.Modules {
+		if !o.checkable() || o.exports[s.name] {
+			return true
+		}
+	}
+	for _, o := range g.Modules {
+		for _, d := range o.Deps {
+			if d.Module == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkable reports whether the exports of m are all known.
+func (m *Module) checkable() bool {
+	return m.Err == nil && !m.partialExports
+}
+
+// exported reports whether m exports name, itself or through the
+// libraries it re-exports.
+func (m *Module) exported(name string, seen map[*Module]bool) bool {
+	if m.exports[name] {
+		return true
+	}
+	seen[m] = true
+	for _, i := range m.reexports {
+		d := m.Deps[i]
+		if d.Module == nil || !d.Module.checkable() {
+			return true
+		}
+		if !seen[d.Module] && d.Module.exported(name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPrefix replaces the prefix of p, such as @loader_path, by dir.
+func expandPrefix(p, prefix, dir string) (string, bool) {
+	if p == prefix {
+		return dir, true
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return filepath.Clean(dir + p[len(prefix):]), true
+	}
+	return p, false
+}
+
+// isFile reports whether path is an existing file.
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
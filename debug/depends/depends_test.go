@@ -0,0 +1,51 @@
+package depends
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, data)
+}
+
+func writeFile(t *testing.T, dst string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkNotBinary(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "text")
+	writeFile(t, p, []byte("not a binary"))
+	if _, err := new(Walker).Walk(p); err == nil {
+		t.Error("Walk of a text file succeeded")
+	}
+}
+
+func TestExpandPrefix(t *testing.T) {
+	tests := []struct {
+		p, want string
+		ok      bool
+	}{
+		{"@loader_path", "/app", true},
+		{"@loader_path/../lib", "/lib", true},
+		{"@loader_pathological/lib", "@loader_pathological/lib", false},
+		{"/usr/lib", "/usr/lib", false},
+	}
+	for _, tt := range tests {
+		if got, ok := expandPrefix(tt.p, "@loader_path", "/app"); got != tt.want || ok != tt.ok {
+			t.Errorf("expandPrefix(%q) = %q, %v, want %q, %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+}
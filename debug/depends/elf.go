@@ -0,0 +1,259 @@
+package depends
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/elf"
+)
+
+// ELFResolver resolves DT_NEEDED entries in the search order of the GNU
+// dynamic linker: DT_RPATH of the importer and of its loaders unless
+// the importer has a DT_RUNPATH, LD_LIBRARY_PATH, DT_RUNPATH, then the
+// ld.so.conf and default directories. Libraries of another class or
+// machine than the importer are skipped, as the linker does.
+type ELFResolver struct {
+	// Root is prepended to the absolute paths of the target system,
+	// such as a mounted image; empty for the running system.
+	Root        string
+	LibraryPath []string
+	DefaultDirs []string
+
+	headers map[string]elfHeader
+}
+
+// elfHeader is the class and machine of an ELF file.
+type elfHeader struct {
+	class   elf.Class
+	machine elf.Machine
+}
+
+// NewELFResolver returns a resolver for the system mounted at root, or
+// the running system if root is empty. DefaultDirs are read from the
+// ld.so.conf of the system, followed by the default directories; the
+// LD_LIBRARY_PATH of the running system is used.
+func NewELFResolver(root string) *ELFResolver {
+	r := &ELFResolver{Root: root}
+	if root == "" {
+		if p := os.Getenv("LD_LIBRARY_PATH"); p != "" {
+			r.LibraryPath = filepath.SplitList(p)
+		}
+	}
+	r.DefaultDirs = r.ldSoConf("/etc/ld.so.conf", 0)
+	r.DefaultDirs = append(r.DefaultDirs, "/lib64", "/usr/lib64", "/lib", "/usr/lib")
+	return r
+}
+
+// ldSoConf returns the directories of an ld.so.conf file, following its
+// include directives.
+func (r *ELFResolver) ldSoConf(name string, depth int) []string {
+	fd, err := os.Open(r.rooted(name))
+	if err != nil || depth > 8 {
+		return nil
+	}
+	defer fd.Close()
+	var dirs []string
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ' ' || c == '\t' || c == ':' || c == ','
+		})
+		if len(fields) == 0 || fields[0] == "hwcap" {
+			continue
+		}
+		if fields[0] != "include" {
+			dirs = append(dirs, fields...)
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(name), pattern)
+			}
+			matches, _ := filepath.Glob(r.rooted(pattern))
+			for _, m := range matches {
+				rel := strings.TrimPrefix(m, filepath.Clean(r.Root))
+				dirs = append(dirs, r.ldSoConf(rel, depth+1)...)
+			}
+		}
+	}
+	return dirs
+}
+
+// rooted returns the path of the absolute path p of the target system.
+func (r *ELFResolver) rooted(p string) string {
+	if r.Root == "" || !filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(r.Root, p)
+}
+
+// Resolve resolves the DT_NEEDED entry name of the last module of chain.
+func (r *ELFResolver) Resolve(name string, chain []*Module) Resolution {
+	res := Resolution{Name: name, Host: name}
+	importer := chain[len(chain)-1]
+	if strings.ContainsRune(name, '/') {
+		if p := r.hostPath(name, importer); isFile(p) {
+			res.Path, res.Location = p, FromFilePath
+		}
+		return res
+	}
+	try := func(dirs []string, m *Module, loc Location) bool {
+		for _, dir := range dirs {
+			if dir == "" {
+				continue
+			}
+			if m != nil {
+				dir = r.hostPath(dir, m)
+			}
+			p := filepath.Join(dir, name)
+			if isFile(p) && r.compatible(p, importer) {
+				res.Path, res.Location = p, loc
+				return true
+			}
+		}
+		return false
+	}
+	if len(importer.runpath) == 0 {
+		for i := len(chain) - 1; i >= 0; i-- {
+			if try(chain[i].rpath, chain[i], FromRPath) {
+				return res
+			}
+		}
+	}
+	if try(r.LibraryPath, nil, FromLibraryPath) ||
+		try(importer.runpath, importer, FromRunPath) {
+		return res
+	}
+	dirs := make([]string, len(r.DefaultDirs))
+	for i, dir := range r.DefaultDirs {
+		dirs[i] = r.rooted(dir)
+	}
+	try(dirs, nil, FromDefaultDirs)
+	return res
+}
+
+// hostPath returns the path of the search path or library p of the
+// module m: $ORIGIN relative paths are already on this system.
+func (r *ELFResolver) hostPath(p string, m *Module) string {
+	if strings.Contains(p, "ORIGIN") {
+		return r.expand(p, m)
+	}
+	return r.rooted(r.expand(p, m))
+}
+
+// expand substitutes the dynamic string tokens $ORIGIN and $LIB of p
+// for the module m.
+func (r *ELFResolver) expand(p string, m *Module) string {
+	if !strings.ContainsRune(p, '$') {
+		return p
+	}
+	origin, err := filepath.Abs(filepath.Dir(m.Path))
+	if err != nil {
+		origin = filepath.Dir(m.Path)
+	}
+	lib := "lib"
+	if m.elfClass == elf.ELFCLASS64 {
+		lib = "lib64"
+	}
+	return filepath.Clean(strings.NewReplacer("${ORIGIN}", origin, "$ORIGIN", origin, "${LIB}", lib, "$LIB", lib).Replace(p))
+}
+
+// compatible reports whether the ELF file at p can be loaded by m.
+func (r *ELFResolver) compatible(p string, m *Module) bool {
+	if r.headers == nil {
+		r.headers = make(map[string]elfHeader)
+	}
+	h, ok := r.headers[p]
+	if !ok {
+		h, _ = readELFHeader(p)
+		r.headers[p] = h
+	}
+	return h.class == m.elfClass && h.machine == m.elfMachine
+}
+
+func readELFHeader(p string) (elfHeader, error) {
+	fd, err := os.Open(p)
+	if err != nil {
+		return elfHeader{}, err
+	}
+	defer fd.Close()
+	var ident [20]byte
+	if _, err := fd.ReadAt(ident[:], 0); err != nil {
+		return elfHeader{}, err
+	}
+	if string(ident[:4]) != elf.ELFMAG {
+		return elfHeader{}, errors.New("bad magic number")
+	}
+	h := elfHeader{class: elf.Class(ident[elf.EI_CLASS])}
+	if elf.Data(ident[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		h.machine = elf.Machine(binary.BigEndian.Uint16(ident[18:]))
+	} else {
+		h.machine = elf.Machine(binary.LittleEndian.Uint16(ident[18:]))
+	}
+	return h, nil
+}
+
+// stbGNUUnique is the binding of the GNU unique symbols, STB_LOOS.
+const stbGNUUnique = elf.STB_LOOS
+
+// loadELF reads the needed libraries, the search paths and the dynamic
+// symbols of an ELF module.
+func (m *Module) loadELF() error {
+	f, err := elf.Open(m.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	m.elfClass, m.elfMachine = f.Class, f.Machine
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return err
+	}
+	deps := make(map[string]int, len(needed))
+	for _, name := range needed {
+		deps[name] = len(m.Deps)
+		m.Deps = append(m.Deps, &Dependency{Resolution: Resolution{Name: name}})
+	}
+	for tag, paths := range map[elf.DynTag]*[]string{elf.DT_RPATH: &m.rpath, elf.DT_RUNPATH: &m.runpath} {
+		values, err := f.DynString(tag)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			*paths = append(*paths, strings.Split(v, ":")...)
+		}
+	}
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		if errors.Is(err, elf.ErrNoSymbols) {
+			return nil
+		}
+		return err
+	}
+	m.exports = make(map[string]bool)
+	for _, s := range syms {
+		bind := elf.ST_BIND(s.Info)
+		if s.Name == "" || (bind != elf.STB_GLOBAL && bind != elf.STB_WEAK && bind != stbGNUUnique) {
+			continue
+		}
+		if s.Section != elf.SHN_UNDEF {
+			m.exports[s.Name] = true
+			continue
+		}
+		// Versioned symbols name the library defining them.
+		dep := -1
+		if i, ok := deps[s.Library]; ok {
+			dep = i
+		}
+		m.imports = append(m.imports, importedSymbol{dep: dep, name: s.Name, weak: bind == elf.STB_WEAK})
+	}
+	return nil
+}
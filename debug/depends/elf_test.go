@@ -0,0 +1,99 @@
+package depends
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fcharlie/buna/debug/elf"
+)
+
+func TestELFResolver(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "opt", "app")
+	lib64 := "../elf/testdata/gcc-amd64-linux-exec"
+	lib32 := "../elf/testdata/gcc-386-freebsd-exec"
+	copyFile(t, lib64, filepath.Join(app, "lib", "libfoo.so"))
+	copyFile(t, lib64, filepath.Join(app, "runpath", "libfoo.so"))
+	copyFile(t, lib32, filepath.Join(root, "usr", "lib", "libbar.so"))
+	copyFile(t, lib64, filepath.Join(root, "usr", "lib64", "libbar.so"))
+	copyFile(t, lib64, filepath.Join(root, "opt", "plugins", "libbaz.so"))
+	writeFile(t, filepath.Join(root, "etc", "ld.so.conf"), []byte("include /etc/ld.so.conf.d/*.conf\n"))
+	writeFile(t, filepath.Join(root, "etc", "ld.so.conf.d", "plugins.conf"), []byte("# plugins\n/opt/plugins\n"))
+
+	r := NewELFResolver(root)
+	want := []string{"/opt/plugins", "/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+	if !reflect.DeepEqual(r.DefaultDirs, want) {
+		t.Errorf("DefaultDirs = %q, want %q", r.DefaultDirs, want)
+	}
+	exe := &Module{
+		Path:       filepath.Join(app, "bin", "app"),
+		elfClass:   elf.ELFCLASS64,
+		elfMachine: elf.EM_X86_64,
+		rpath:      []string{"$ORIGIN/../lib"},
+	}
+	plugin := &Module{
+		Path:       filepath.Join(app, "plugin.so"),
+		elfClass:   elf.ELFCLASS64,
+		elfMachine: elf.EM_X86_64,
+	}
+	tests := []struct {
+		name     string
+		chain    []*Module
+		path     string
+		location Location
+	}{
+		{"libfoo.so", []*Module{exe}, filepath.Join(app, "lib", "libfoo.so"), FromRPath},
+		// The DT_RPATH of the executable applies to its dependencies.
+		{"libfoo.so", []*Module{exe, plugin}, filepath.Join(app, "lib", "libfoo.so"), FromRPath},
+		// The 32-bit libbar.so in /usr/lib is skipped.
+		{"libbar.so", []*Module{exe}, filepath.Join(root, "usr", "lib64", "libbar.so"), FromDefaultDirs},
+		{"libbaz.so", []*Module{exe}, filepath.Join(root, "opt", "plugins", "libbaz.so"), FromDefaultDirs},
+		{"/usr/lib64/libbar.so", []*Module{exe}, filepath.Join(root, "usr", "lib64", "libbar.so"), FromFilePath},
+		{"$ORIGIN/../lib/libfoo.so", []*Module{exe}, filepath.Join(app, "lib", "libfoo.so"), FromFilePath},
+		{"libqux.so", []*Module{exe}, "", NotFound},
+	}
+	for _, tt := range tests {
+		res := r.Resolve(tt.name, tt.chain)
+		if res.Path != tt.path || res.Location != tt.location {
+			t.Errorf("Resolve(%q) = %+v, want %q from %v", tt.name, res, tt.path, tt.location)
+		}
+	}
+
+	// DT_RUNPATH disables DT_RPATH and comes after LD_LIBRARY_PATH.
+	plugin.runpath = []string{"$ORIGIN/runpath"}
+	if res := r.Resolve("libfoo.so", []*Module{exe, plugin}); res.Location != FromRunPath {
+		t.Errorf("Resolve with DT_RUNPATH = %+v", res)
+	}
+	r.LibraryPath = []string{filepath.Join(app, "lib")}
+	if res := r.Resolve("libfoo.so", []*Module{exe, plugin}); res.Location != FromLibraryPath {
+		t.Errorf("Resolve with LD_LIBRARY_PATH = %+v", res)
+	}
+}
+
+func TestWalkELF(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "bin", "hello")
+	copyFile(t, "../elf/testdata/gcc-amd64-linux-exec", exe)
+	// A stand-in libc.so.6, which needs itself and exports nothing.
+	copyFile(t, "../elf/testdata/gcc-amd64-linux-exec", filepath.Join(dir, "lib", "libc.so.6"))
+
+	r := NewELFResolver(t.TempDir())
+	r.LibraryPath = []string{filepath.Join(dir, "lib")}
+	w := &Walker{ELF: r, Symbols: true}
+	g, err := w.Walk(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Modules) != 2 || !g.Root.Format.IsElf() {
+		t.Fatalf("Walk found %d modules", len(g.Modules))
+	}
+	libc := g.Root.Deps[0]
+	if libc.Location != FromLibraryPath || libc.Module == nil || !libc.Module.Deps[0].Cycle {
+		t.Errorf("libc.so.6 = %+v", libc)
+	}
+	want := []Symbol{{"libc.so.6", "puts"}, {"libc.so.6", "__libc_start_main"}}
+	if !reflect.DeepEqual(g.Root.Unresolved, want) {
+		t.Errorf("Unresolved = %v, want %v", g.Root.Unresolved, want)
+	}
+}
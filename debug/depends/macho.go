@@ -0,0 +1,244 @@
+package depends
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/macho"
+)
+
+// MachOResolver resolves dylib install names the way dyld does:
+// DYLD_LIBRARY_PATH first, then the install name with @executable_path,
+// @loader_path and @rpath expanded, then DYLD_FALLBACK_LIBRARY_PATH.
+// @rpath is searched through the LC_RPATH of the importer, then of its
+// loaders up to the executable.
+type MachOResolver struct {
+	// Root is prepended to the absolute paths of the target system,
+	// such as a mounted image; empty for the running system.
+	Root         string
+	LibraryPath  []string
+	FallbackPath []string
+	// SharedCache lists the prefixes of the system libraries that live
+	// in the dyld shared cache rather than on disk since macOS 11. They
+	// are reported found, without a path.
+	SharedCache []string
+}
+
+// NewMachOResolver returns a resolver for the system mounted at root,
+// or the running system if root is empty. The DYLD_LIBRARY_PATH and
+// DYLD_FALLBACK_LIBRARY_PATH of the running system are used.
+func NewMachOResolver(root string) *MachOResolver {
+	r := &MachOResolver{
+		Root:         root,
+		FallbackPath: []string{"/usr/local/lib", "/usr/lib"},
+		SharedCache:  []string{"/usr/lib/", "/System/Library/"},
+	}
+	if root == "" {
+		if p := os.Getenv("DYLD_LIBRARY_PATH"); p != "" {
+			r.LibraryPath = filepath.SplitList(p)
+		}
+		if p := os.Getenv("DYLD_FALLBACK_LIBRARY_PATH"); p != "" {
+			r.FallbackPath = filepath.SplitList(p)
+		}
+	}
+	return r
+}
+
+// rooted returns the path of the absolute path p of the target system.
+func (r *MachOResolver) rooted(p string) string {
+	if r.Root == "" || !filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(r.Root, p)
+}
+
+// expand substitutes the @executable_path and @loader_path prefixes of
+// p for the module m loaded by chain. It reports whether p had one.
+func (r *MachOResolver) expand(p string, m *Module, chain []*Module) (string, bool) {
+	if e, ok := expandPrefix(p, "@executable_path", filepath.Dir(chain[0].Path)); ok {
+		return e, true
+	}
+	return expandPrefix(p, "@loader_path", filepath.Dir(m.Path))
+}
+
+// Resolve resolves the install name of a dylib imported by the last
+// module of chain.
+func (r *MachOResolver) Resolve(name string, chain []*Module) Resolution {
+	res := Resolution{Name: name, Host: name}
+	importer := chain[len(chain)-1]
+	found := func(p string, loc Location) bool {
+		if isFile(p) {
+			res.Path, res.Location = p, loc
+			return true
+		}
+		return false
+	}
+	leaf := filepath.Base(name)
+	for _, dir := range r.LibraryPath {
+		if found(filepath.Join(dir, leaf), FromLibraryPath) {
+			return res
+		}
+	}
+	if p, ok := r.expand(name, importer, chain); ok {
+		found(p, FromFilePath)
+		return res
+	}
+	if rest, ok := expandPrefix(name, "@rpath", ""); ok {
+		for i := len(chain) - 1; i >= 0; i-- {
+			for _, rp := range chain[i].rpaths {
+				dir, ok := r.expand(rp, chain[i], chain)
+				if !ok {
+					dir = r.rooted(rp)
+				}
+				if found(filepath.Join(dir, rest), FromRPath) {
+					return res
+				}
+			}
+		}
+		return res
+	}
+	if found(r.rooted(name), FromFilePath) {
+		return res
+	}
+	for _, dir := range r.FallbackPath {
+		if found(filepath.Join(r.rooted(dir), leaf), FromDefaultDirs) {
+			return res
+		}
+	}
+	for _, prefix := range r.SharedCache {
+		if strings.HasPrefix(name, prefix) {
+			res.Location = FromSharedCache
+			break
+		}
+	}
+	return res
+}
+
+// Symbol table bits of n_type and n_desc.
+const (
+	nStab    = 0xe0
+	nPext    = 0x10
+	nType    = 0x0e
+	nExt     = 0x01
+	nUndf    = 0x0
+	nWeakRef = 0x40
+
+	selfLibraryOrdinal       = 0x0
+	dynamicLookupOrdinal     = 0xfe
+	executableLibraryOrdinal = 0xff
+)
+
+// openMachO opens the Mach-O file at path, or the architecture cpu of a
+// universal binary, the first one if cpu is 0.
+func openMachO(path string, cpu macho.Cpu) (*macho.File, func() error, error) {
+	f, err := macho.Open(path)
+	if err == nil {
+		return f, f.Close, nil
+	}
+	ff, ferr := macho.OpenFat(path)
+	if ferr != nil {
+		return nil, nil, err
+	}
+	for _, arch := range ff.Arches {
+		if cpu == 0 || arch.Cpu == cpu {
+			return arch.File, ff.Close, nil
+		}
+	}
+	ff.Close()
+	return nil, nil, errors.New("no matching architecture in universal binary")
+}
+
+// loadMachO reads the dylibs, the rpaths and the symbols of a Mach-O
+// module.
+func (m *Module) loadMachO(cpu macho.Cpu) error {
+	f, closer, err := openMachO(m.Path, cpu)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	m.machoCPU = f.Cpu
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *macho.Dylib:
+			if l.Kind == macho.DylibReexport {
+				m.reexports = append(m.reexports, len(m.Deps))
+			}
+			m.Deps = append(m.Deps, &Dependency{Resolution: Resolution{Name: l.Name}, Weak: l.Kind == macho.DylibWeak})
+		case *macho.Rpath:
+			m.rpaths = append(m.rpaths, l.Path)
+		}
+	}
+	// The exports trie lists the exports stripped from the symbol
+	// table, and the re-exported symbols. Without it the symbols the
+	// module exports are not all known.
+	exports, err := f.Exports()
+	if err != nil {
+		m.Warnings = append(m.Warnings, err)
+		m.partialExports = true
+	}
+	m.exports = make(map[string]bool)
+	for _, e := range exports {
+		m.exports[e.Name] = true
+	}
+	// The binds tell the dylib of each import even without a symbol
+	// table. Streams this package does not decode, such as threaded
+	// binds, fall back to the library ordinals of the symbol table.
+	binds, err := f.Binds()
+	if err != nil {
+		m.Warnings = append(m.Warnings, err)
+		binds = nil
+	}
+	m.importBinds(binds)
+	if f.Symtab == nil {
+		return nil
+	}
+	twoLevel := f.Flags&macho.FlagTwoLevel != 0
+	for _, s := range f.Symtab.Syms {
+		if s.Type&nStab != 0 || s.Type&nExt == 0 {
+			continue
+		}
+		if s.Type&nType != nUndf {
+			if s.Type&nPext == 0 {
+				m.exports[s.Name] = true
+			}
+			continue
+		}
+		if s.Value != 0 || len(binds) != 0 {
+			continue // common symbol, or import known from the binds
+		}
+		dep := -1
+		if twoLevel {
+			switch ordinal := int(s.Desc >> 8); ordinal {
+			case selfLibraryOrdinal:
+				continue
+			case dynamicLookupOrdinal, executableLibraryOrdinal:
+			default:
+				if ordinal <= len(m.Deps) {
+					dep = ordinal - 1
+				}
+			}
+		}
+		m.imports = append(m.imports, importedSymbol{dep: dep, name: s.Name, weak: s.Desc&nWeakRef != 0})
+	}
+	return nil
+}
+
+// importBinds records the symbols bound by binds as imports, once each.
+func (m *Module) importBinds(binds []macho.Bind) {
+	seen := make(map[importedSymbol]bool)
+	for _, b := range binds {
+		s := importedSymbol{dep: -1, name: b.Name, weak: b.Weak}
+		switch {
+		case b.Library == macho.LibrarySelf, b.Library == macho.LibraryWeakLookup:
+			continue // defined by the module, or coalesced weak definitions
+		case b.Library > 0 && b.Library <= len(m.Deps):
+			s.dep = b.Library - 1
+		}
+		if !seen[s] {
+			seen[s] = true
+			m.imports = append(m.imports, s)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package depends
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fcharlie/buna/debug/macho"
+)
+
+// readBase64 decodes a base64 test file of the macho package.
+func readBase64(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("../macho/testdata", name+".base64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// copyBase64 decodes a base64 test file of the macho package to dst.
+func copyBase64(t *testing.T, name, dst string) {
+	t.Helper()
+	writeFile(t, dst, readBase64(t, name))
+}
+
+func TestMachOResolver(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "Applications", "App.app", "Contents")
+	touch(t, filepath.Join(app, "Frameworks"), "libfoo.dylib")
+	touch(t, filepath.Join(app, "MacOS", "plugins"), "libbar.dylib")
+	touch(t, filepath.Join(root, "opt", "lib"), "libbaz.dylib")
+	touch(t, filepath.Join(root, "usr", "local", "lib"), "libqux.dylib")
+
+	r := NewMachOResolver(root)
+	exe := &Module{
+		Path:   filepath.Join(app, "MacOS", "App"),
+		rpaths: []string{"@executable_path/../Frameworks", "/opt/lib"},
+	}
+	plugin := &Module{Path: filepath.Join(app, "MacOS", "plugins", "libbar.dylib")}
+	tests := []struct {
+		name     string
+		path     string
+		location Location
+	}{
+		{"@rpath/libfoo.dylib", filepath.Join(app, "Frameworks", "libfoo.dylib"), FromRPath},
+		{"@rpath/libbaz.dylib", filepath.Join(root, "opt", "lib", "libbaz.dylib"), FromRPath},
+		{"@loader_path/libbar.dylib", filepath.Join(app, "MacOS", "plugins", "libbar.dylib"), FromFilePath},
+		{"@executable_path/plugins/libbar.dylib", filepath.Join(app, "MacOS", "plugins", "libbar.dylib"), FromFilePath},
+		{"/opt/lib/libbaz.dylib", filepath.Join(root, "opt", "lib", "libbaz.dylib"), FromFilePath},
+		{"/opt/old/libqux.dylib", filepath.Join(root, "usr", "local", "lib", "libqux.dylib"), FromDefaultDirs},
+		{"/usr/lib/libSystem.B.dylib", "", FromSharedCache},
+		{"@rpath/libmissing.dylib", "", NotFound},
+	}
+	for _, tt := range tests {
+		// The plugin has no LC_RPATH, those of the executable apply.
+		res := r.Resolve(tt.name, []*Module{exe, plugin})
+		if res.Path != tt.path || res.Location != tt.location {
+			t.Errorf("Resolve(%q) = %+v, want %q from %v", tt.name, res, tt.path, tt.location)
+		}
+	}
+}
+
+func TestWalkMachO(t *testing.T) {
+	root := t.TempDir()
+	exe := filepath.Join(root, "bin", "hello")
+	copyBase64(t, "clang-amd64-darwin-exec-with-rpath", exe)
+	// A stand-in libSystem, which loads itself and the libgcc_s of the
+	// shared cache.
+	copyBase64(t, "gcc-amd64-darwin-exec", filepath.Join(root, "usr", "lib", "libSystem.B.dylib"))
+
+	w := &Walker{MachO: NewMachOResolver(root), Symbols: true}
+	g, err := w.Walk(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Modules) != 2 || g.Root.machoCPU != macho.CpuAmd64 {
+		t.Fatalf("Walk found %d modules", len(g.Modules))
+	}
+	libSystem := g.Modules[1]
+	if len(libSystem.Deps) != 2 {
+		t.Fatalf("libSystem has %d dependencies", len(libSystem.Deps))
+	}
+	if d := libSystem.Deps[0]; d.Location != FromSharedCache || d.Module != nil {
+		t.Errorf("libgcc_s = %+v", d)
+	}
+	if d := libSystem.Deps[1]; !d.Cycle {
+		t.Errorf("self load of libSystem = %+v, want a cycle", d)
+	}
+	if len(g.Missing()) != 0 {
+		t.Errorf("Missing = %v", g.Missing())
+	}
+	// In the order of the binds: dyld_stub_binder is bound at load time,
+	// _printf lazily.
+	want := []Symbol{{"/usr/lib/libSystem.B.dylib", "dyld_stub_binder"}, {"/usr/lib/libSystem.B.dylib", "_printf"}}
+	if !reflect.DeepEqual(g.Root.Unresolved, want) {
+		t.Errorf("Unresolved = %v, want %v", g.Root.Unresolved, want)
+	}
+}
+
+func TestWalkMachOWeak(t *testing.T) {
+	// Turn the libSystem load command of the executable into a weak
+	// load; the 64-bit load commands follow the 32-byte header.
+	b := readBase64(t, "clang-amd64-darwin-exec-with-rpath")
+	ncmd := binary.LittleEndian.Uint32(b[16:])
+	for i, off := uint32(0), uint32(32); i < ncmd; i++ {
+		if macho.LoadCmd(binary.LittleEndian.Uint32(b[off:])) == macho.LoadCmdDylib {
+			binary.LittleEndian.PutUint32(b[off:], uint32(macho.LoadCmdLoadWeakDylib))
+		}
+		off += binary.LittleEndian.Uint32(b[off+4:])
+	}
+	root := t.TempDir()
+	exe := filepath.Join(root, "bin", "hello")
+	writeFile(t, exe, b)
+
+	w := &Walker{MachO: &MachOResolver{Root: root}, Symbols: true}
+	g, err := w.Walk(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Root.Deps) != 1 {
+		t.Fatalf("found %d dependencies, want 1", len(g.Root.Deps))
+	}
+	if d := g.Root.Deps[0]; !d.Weak || !d.Missing() {
+		t.Errorf("libSystem = %+v, want a missing weak dependency", d)
+	}
+	if len(g.Missing()) != 0 {
+		t.Errorf("Missing = %v, want none", g.Missing())
+	}
+}
+
+func TestWalkMachOUndecoded(t *testing.T) {
+	// Start the bind stream of the executable with a threaded bind
+	// opcode, which the macho package does not decode.
+	// dyldInfo calls fn with the dyld info command of the executable.
+	dyldInfo := func(fn func(b []byte, cmd uint32)) []byte {
+		b := readBase64(t, "clang-amd64-darwin-exec-with-rpath")
+		ncmd := binary.LittleEndian.Uint32(b[16:])
+		for i, off := uint32(0), uint32(32); i < ncmd; i++ {
+			if macho.LoadCmd(binary.LittleEndian.Uint32(b[off:])) == macho.LoadCmdDyldInfoOnly {
+				fn(b, off)
+			}
+			off += binary.LittleEndian.Uint32(b[off+4:])
+		}
+		return b
+	}
+	root := t.TempDir()
+	exe := filepath.Join(root, "bin", "hello")
+	writeFile(t, exe, dyldInfo(func(b []byte, cmd uint32) {
+		b[binary.LittleEndian.Uint32(b[cmd+16:])] = 0xd0
+	}))
+	copyBase64(t, "gcc-amd64-darwin-exec", filepath.Join(root, "usr", "lib", "libSystem.B.dylib"))
+
+	w := &Walker{MachO: NewMachOResolver(root), Symbols: true}
+	g, err := w.Walk(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Root.Err != nil || len(g.Root.Warnings) != 1 {
+		t.Fatalf("Err = %v, Warnings = %v; want one warning", g.Root.Err, g.Root.Warnings)
+	}
+	// The imports come from the two-level namespace ordinals of the
+	// symbol table instead.
+	want := []Symbol{{"/usr/lib/libSystem.B.dylib", "_printf"}, {"/usr/lib/libSystem.B.dylib", "dyld_stub_binder"}}
+	if !reflect.DeepEqual(g.Root.Unresolved, want) {
+		t.Errorf("Unresolved = %v, want %v", g.Root.Unresolved, want)
+	}
+
+	// A libSystem whose exports trie is out of the file: its exports
+	// are not all known, the imports from it are not checked.
+	copyBase64(t, "clang-amd64-darwin-exec-with-rpath", exe)
+	writeFile(t, filepath.Join(root, "usr", "lib", "libSystem.B.dylib"), dyldInfo(func(b []byte, cmd uint32) {
+		binary.LittleEndian.PutUint32(b[cmd+40:], 0xfffffff0)
+	}))
+	g, err = w.Walk(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libSystem := g.Modules[1]
+	if libSystem.Err != nil || len(libSystem.Warnings) != 1 {
+		t.Fatalf("libSystem Err = %v, Warnings = %v; want one warning", libSystem.Err, libSystem.Warnings)
+	}
+	if len(g.Root.Unresolved) != 0 {
+		t.Errorf("Unresolved = %v, want none", g.Root.Unresolved)
+	}
+}
+
+func TestOpenMachOFat(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "fat")
+	copyBase64(t, "fat-gcc-386-amd64-darwin-exec", p)
+	for _, cpu := range []macho.Cpu{macho.Cpu386, macho.CpuAmd64} {
+		f, closer, err := openMachO(p, cpu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Cpu != cpu {
+			t.Errorf("openMachO(%v) = %v", cpu, f.Cpu)
+		}
+		closer()
+	}
+	if _, _, err := openMachO(p, macho.CpuArm64); err == nil {
+		t.Error("openMachO of a missing architecture succeeded")
+	}
+}
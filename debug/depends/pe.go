@@ -0,0 +1,224 @@
+package depends
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/pe"
+)
+
+// DefaultKnownDLLs are the KnownDLLs of Windows 10 and later, with
+// ntdll.dll which the loader always maps first. The loader maps them
+// from the system directory whatever the search order.
+var DefaultKnownDLLs = []string{
+	"advapi32.dll", "clbcatq.dll", "combase.dll", "comdlg32.dll",
+	"coml2.dll", "difxapi.dll", "gdi32.dll", "gdiplus.dll",
+	"imagehlp.dll", "imm32.dll", "kernel32.dll", "msctf.dll",
+	"msvcrt.dll", "normaliz.dll", "nsi.dll", "ntdll.dll", "ole32.dll",
+	"oleaut32.dll", "psapi.dll", "rpcrt4.dll", "sechost.dll",
+	"setupapi.dll", "shcore.dll", "shell32.dll", "shlwapi.dll",
+	"user32.dll", "wldap32.dll", "wow64.dll", "wow64cpu.dll",
+	"wow64win.dll", "ws2_32.dll",
+}
+
+// WindowsResolver resolves DLL names in the standard search order of
+// the Windows loader in safe DLL search mode: API set redirection,
+// KnownDLLs, the application directory, the system directories and the
+// PATH directories. The current directory is not searched.
+type WindowsResolver struct {
+	AppDir string // defaults to the directory of the executable
+	// SystemDirs are searched in order, such as System32, System and the
+	// Windows directory. KnownDLLs and API set hosts are mapped from the
+	// first one. Use SysWOW64 for 32-bit images on 64-bit Windows.
+	SystemDirs []string
+	Path       []string
+	KnownDLLs  []string
+	APISet     *pe.APISetSchema // no API set redirection if nil
+
+	dirs map[string]map[string]string
+}
+
+// NewWindowsResolver returns a resolver for the application in appDir,
+// or the directory of the executable if empty. On Windows, the system
+// directories and PATH are those of the running system; elsewhere they
+// are left empty for the caller to fill.
+func NewWindowsResolver(appDir string) *WindowsResolver {
+	r := &WindowsResolver{
+		AppDir:    appDir,
+		KnownDLLs: DefaultKnownDLLs,
+	}
+	if runtime.GOOS == "windows" {
+		if root := os.Getenv("SystemRoot"); root != "" {
+			r.SystemDirs = []string{filepath.Join(root, "System32"), filepath.Join(root, "System"), root}
+		}
+		r.Path = filepath.SplitList(os.Getenv("PATH"))
+	}
+	return r
+}
+
+// LoadAPISet reads the API set schema of the apisetschema.dll at path.
+func (r *WindowsResolver) LoadAPISet(path string) error {
+	fd, err := pe.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	s, err := fd.LookupAPISetSchema()
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("%s: no .apiset section", path)
+	}
+	r.APISet = s
+	return nil
+}
+
+// Resolve resolves the DLL name imported by the last module of chain.
+// Without system directories, KnownDLLs and API set contracts are
+// assumed to be provided by the system.
+func (r *WindowsResolver) Resolve(name string, chain []*Module) Resolution {
+	res := Resolution{Name: name, Host: name}
+	if pe.IsAPISetName(name) && r.APISet == nil && len(r.SystemDirs) == 0 {
+		if res.Path = r.find(r.appDir(chain), name); res.Path != "" {
+			res.Location = FromAppDir
+		} else {
+			res.Location = FromAPISet
+		}
+		return res
+	}
+	if r.APISet != nil && pe.IsAPISetName(name) {
+		if host, ok := r.APISet.Resolve(name, filepath.Base(chain[len(chain)-1].Path)); ok {
+			res.Host = host
+			if len(r.SystemDirs) == 0 {
+				res.Location = FromAPISet
+			} else if res.Path = r.find(r.SystemDirs[0], host); res.Path != "" {
+				res.Location = FromAPISet
+			}
+			return res
+		}
+		// Contracts missing from the schema are looked up as files, the
+		// Universal CRT redistributable ships them for older systems.
+	}
+	if r.isKnownDLL(name) {
+		if len(r.SystemDirs) == 0 {
+			res.Location = FromKnownDLLs
+		} else if res.Path = r.find(r.SystemDirs[0], name); res.Path != "" {
+			res.Location = FromKnownDLLs
+		}
+		return res
+	}
+	if res.Path = r.find(r.appDir(chain), name); res.Path != "" {
+		res.Location = FromAppDir
+		return res
+	}
+	for _, dir := range r.SystemDirs {
+		if res.Path = r.find(dir, name); res.Path != "" {
+			res.Location = FromSystemDir
+			return res
+		}
+	}
+	for _, dir := range r.Path {
+		if res.Path = r.find(dir, name); res.Path != "" {
+			res.Location = FromPath
+			return res
+		}
+	}
+	return res
+}
+
+func (r *WindowsResolver) appDir(chain []*Module) string {
+	if r.AppDir != "" {
+		return r.AppDir
+	}
+	return filepath.Dir(chain[0].Path)
+}
+
+func (r *WindowsResolver) isKnownDLL(name string) bool {
+	for _, k := range r.KnownDLLs {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// find looks name up in dir ignoring case, as on Windows file systems.
+// The directory listings are cached.
+func (r *WindowsResolver) find(dir, name string) string {
+	if strings.ContainsAny(name, `/\`) {
+		p := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+		return ""
+	}
+	if r.dirs == nil {
+		r.dirs = make(map[string]map[string]string)
+	}
+	files, ok := r.dirs[dir]
+	if !ok {
+		files = make(map[string]string)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if !e.IsDir() {
+				files[strings.ToLower(e.Name())] = e.Name()
+			}
+		}
+		r.dirs[dir] = files
+	}
+	if f, ok := files[strings.ToLower(name)]; ok {
+		return filepath.Join(dir, f)
+	}
+	return ""
+}
+
+// loadPE reads the imports and exports of a PE module.
+func (m *Module) loadPE() error {
+	fd, err := pe.Open(m.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	ft, err := fd.LookupFunctionTable()
+	if err != nil {
+		return err
+	}
+	addImports := func(fs pe.Functions) {
+		for _, fn := range fs {
+			name := fn.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", fn.Ordinal)
+			}
+			m.imports = append(m.imports, importedSymbol{dep: len(m.Deps), name: name})
+		}
+	}
+	for _, dll := range ft.ImportOrder {
+		addImports(ft.Imports[dll])
+		m.Deps = append(m.Deps, &Dependency{Resolution: Resolution{Name: dll}})
+	}
+	delay := make([]string, 0, len(ft.Delay))
+	for dll := range ft.Delay {
+		delay = append(delay, dll)
+	}
+	sort.Strings(delay)
+	for _, dll := range delay {
+		addImports(ft.Delay[dll])
+		m.Deps = append(m.Deps, &Dependency{Resolution: Resolution{Name: dll}, Delay: true})
+	}
+	m.exports = make(map[string]bool, len(ft.Exports))
+	for _, e := range ft.Exports {
+		if e.Address == 0 && e.ForwardName == "" {
+			continue // unused slot of the export address table
+		}
+		m.exports[fmt.Sprintf("#%d", e.Ordinal)] = true
+		if e.Name != "" {
+			m.exports[e.Name] = true
+		}
+	}
+	return nil
+}
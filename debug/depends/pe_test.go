@@ -0,0 +1,131 @@
+package depends
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fcharlie/buna/debug/pe"
+)
+
+func touch(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWindowsResolver(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	sys := filepath.Join(root, "System32")
+	win := filepath.Join(root, "Windows")
+	bin := filepath.Join(root, "bin")
+	touch(t, app, "App.exe", "Foo.DLL", "msvcrt.dll", "api-ms-win-crt-heap-l1-1-0.dll")
+	touch(t, sys, "KERNEL32.dll", "kernelbase.dll", "msvcrt.dll", "ucrtbase.dll", "version.dll")
+	touch(t, win, "legacy.dll")
+	touch(t, bin, "zlib1.dll", "version.dll")
+
+	r := NewWindowsResolver(app)
+	r.SystemDirs = []string{sys, win}
+	r.Path = []string{bin}
+	r.APISet = &pe.APISetSchema{
+		Version: 6,
+		Entries: []pe.APISetEntry{
+			{Name: "api-ms-win-core-file-l1-2-4", Hosts: []pe.APISetHost{{Host: "kernelbase.dll"}}},
+			{Name: "api-ms-win-crt-runtime-l1-1-0", Hosts: []pe.APISetHost{{Host: "ucrtbase.dll"}}},
+		},
+	}
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		location Location
+	}{
+		{"api-ms-win-core-file-l1-2-2.dll", "kernelbase.dll", filepath.Join(sys, "kernelbase.dll"), FromAPISet},
+		{"api-ms-win-crt-runtime-l1-1-0.dll", "ucrtbase.dll", filepath.Join(sys, "ucrtbase.dll"), FromAPISet},
+		{"api-ms-win-crt-heap-l1-1-0.dll", "api-ms-win-crt-heap-l1-1-0.dll", filepath.Join(app, "api-ms-win-crt-heap-l1-1-0.dll"), FromAppDir},
+		{"kernel32.dll", "kernel32.dll", filepath.Join(sys, "KERNEL32.dll"), FromKnownDLLs},
+		{"MSVCRT.dll", "MSVCRT.dll", filepath.Join(sys, "msvcrt.dll"), FromKnownDLLs},
+		{"foo.dll", "foo.dll", filepath.Join(app, "Foo.DLL"), FromAppDir},
+		{"version.dll", "version.dll", filepath.Join(sys, "version.dll"), FromSystemDir},
+		{"legacy.dll", "legacy.dll", filepath.Join(win, "legacy.dll"), FromSystemDir},
+		{"zlib1.dll", "zlib1.dll", filepath.Join(bin, "zlib1.dll"), FromPath},
+		{"missing.dll", "missing.dll", "", NotFound},
+	}
+	chain := []*Module{{Path: filepath.Join(app, "App.exe")}}
+	for _, tt := range tests {
+		res := r.Resolve(tt.name, chain)
+		if res.Host != tt.host || res.Path != tt.path || res.Location != tt.location {
+			t.Errorf("Resolve(%q) = %+v, want host %q, path %q from %v", tt.name, res, tt.host, tt.path, tt.location)
+		}
+	}
+}
+
+func TestWindowsResolverNoSystemDirs(t *testing.T) {
+	app := t.TempDir()
+	touch(t, app, "api-ms-win-crt-heap-l1-1-0.dll")
+	r := NewWindowsResolver(app)
+	r.SystemDirs, r.Path = nil, nil
+	chain := []*Module{{Path: filepath.Join(app, "app.exe")}}
+	tests := []struct {
+		name     string
+		location Location
+	}{
+		{"KERNEL32.dll", FromKnownDLLs},
+		{"api-ms-win-core-synch-l1-2-0.dll", FromAPISet},
+		{"api-ms-win-crt-heap-l1-1-0.dll", FromAppDir},
+		{"version.dll", NotFound},
+	}
+	for _, tt := range tests {
+		if res := r.Resolve(tt.name, chain); res.Location != tt.location {
+			t.Errorf("Resolve(%q) = %+v, want %v", tt.name, res, tt.location)
+		}
+	}
+}
+
+func TestWalkPE(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	sys := filepath.Join(root, "System32")
+	copyFile(t, "../pe/testdata/gcc-amd64-mingw-exec", filepath.Join(app, "app.exe"))
+	// A stand-in kernel32.dll, which imports itself and exports nothing.
+	copyFile(t, "../pe/testdata/gcc-amd64-mingw-exec", filepath.Join(sys, "kernel32.dll"))
+
+	pr := NewWindowsResolver("")
+	pr.SystemDirs = []string{sys}
+	w := &Walker{PE: pr, Symbols: true}
+	g, err := w.Walk(filepath.Join(app, "app.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Modules) != 2 || len(g.Root.Deps) != 2 {
+		t.Fatalf("Walk found %d modules, root has %d dependencies", len(g.Modules), len(g.Root.Deps))
+	}
+	k32 := g.Root.Deps[0]
+	if k32.Name != "KERNEL32.dll" || k32.Location != FromKnownDLLs || k32.Module != g.Modules[1] {
+		t.Errorf("Deps[0] = %+v", k32)
+	}
+	if d := k32.Module.Deps[0]; !d.Cycle || d.Module != k32.Module {
+		t.Errorf("self import of kernel32.dll = %+v, want a cycle", d)
+	}
+	if len(g.Cycles) != 1 {
+		t.Errorf("Cycles = %v, want the kernel32.dll self import", g.Cycles)
+	}
+	if got := g.Missing(); len(got) != 1 || got[0] != "msvcrt.dll" {
+		t.Errorf("Missing = %v, want [msvcrt.dll]", got)
+	}
+	// Only the imports of the stand-in kernel32.dll are unresolved,
+	// msvcrt.dll is reported missing instead.
+	if n := len(g.Root.Unresolved); n != 29 {
+		t.Errorf("%d unresolved imports, want 29", n)
+	}
+	if s := g.Root.Unresolved[0]; s.String() != "KERNEL32.dll!DeleteCriticalSection" {
+		t.Errorf("Unresolved[0] = %v", s)
+	}
+}
@@ -0,0 +1,432 @@
+package macho
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// A ChainedPtrFormat is the format of the pointers of the chains of a
+// segment.
+type ChainedPtrFormat uint16
+
+const (
+	ChainedPtrArm64e           ChainedPtrFormat = 1
+	ChainedPtr64               ChainedPtrFormat = 2 // rebase targets are virtual addresses
+	ChainedPtr32               ChainedPtrFormat = 3
+	ChainedPtr32Cache          ChainedPtrFormat = 4
+	ChainedPtr32Firmware       ChainedPtrFormat = 5
+	ChainedPtr64Offset         ChainedPtrFormat = 6 // rebase targets are offsets from the image
+	ChainedPtrArm64eKernel     ChainedPtrFormat = 7
+	ChainedPtr64KernelCache    ChainedPtrFormat = 8
+	ChainedPtrArm64eUserland   ChainedPtrFormat = 9
+	ChainedPtrArm64eFirmware   ChainedPtrFormat = 10
+	ChainedPtrX8664KernelCache ChainedPtrFormat = 11
+	ChainedPtrArm64eUserland24 ChainedPtrFormat = 12
+)
+
+var chainedPtrFormatStrings = []intName{
+	{uint32(ChainedPtrArm64e), "ChainedPtrArm64e"},
+	{uint32(ChainedPtr64), "ChainedPtr64"},
+	{uint32(ChainedPtr32), "ChainedPtr32"},
+	{uint32(ChainedPtr32Cache), "ChainedPtr32Cache"},
+	{uint32(ChainedPtr32Firmware), "ChainedPtr32Firmware"},
+	{uint32(ChainedPtr64Offset), "ChainedPtr64Offset"},
+	{uint32(ChainedPtrArm64eKernel), "ChainedPtrArm64eKernel"},
+	{uint32(ChainedPtr64KernelCache), "ChainedPtr64KernelCache"},
+	{uint32(ChainedPtrArm64eUserland), "ChainedPtrArm64eUserland"},
+	{uint32(ChainedPtrArm64eFirmware), "ChainedPtrArm64eFirmware"},
+	{uint32(ChainedPtrX8664KernelCache), "ChainedPtrX8664KernelCache"},
+	{uint32(ChainedPtrArm64eUserland24), "ChainedPtrArm64eUserland24"},
+}
+
+func (i ChainedPtrFormat) String() string {
+	return stringName(uint32(i), chainedPtrFormatStrings, false)
+}
+func (i ChainedPtrFormat) GoString() string {
+	return stringName(uint32(i), chainedPtrFormatStrings, true)
+}
+
+// A ChainedImportFormat is the format of the imports table.
+type ChainedImportFormat uint32
+
+const (
+	ChainedImportFormatDefault  ChainedImportFormat = 1 // 8-bit ordinal
+	ChainedImportFormatAddend   ChainedImportFormat = 2 // 8-bit ordinal and 32-bit addend
+	ChainedImportFormatAddend64 ChainedImportFormat = 3 // 16-bit ordinal and 64-bit addend
+)
+
+// ChainedPtrStartNone is the page start of the pages without fixups.
+const ChainedPtrStartNone = 0xffff
+
+// A ChainedFixupsHeader is the header of the data of a chained fixups
+// command. The offsets are relative to the data.
+type ChainedFixupsHeader struct {
+	Version       uint32
+	StartsOffset  uint32
+	ImportsOffset uint32
+	SymbolsOffset uint32
+	ImportsCount  uint32
+	ImportsFormat ChainedImportFormat
+	SymbolsFormat uint32 // 0 for plain strings, 1 for zlib compressed
+}
+
+// A ChainedStartsHeader is the header of the chain starts of a segment.
+type ChainedStartsHeader struct {
+	Size            uint32
+	PageSize        uint16
+	PointerFormat   ChainedPtrFormat
+	SegmentOffset   uint64 // offset of the segment from the image
+	MaxValidPointer uint32
+	PageCount       uint16
+}
+
+// ChainedStarts is where the chains of the pages of a segment start.
+type ChainedStarts struct {
+	ChainedStartsHeader
+	// PageStarts has the offset of the first fixup of each page, or
+	// ChainedPtrStartNone.
+	PageStarts []uint16
+}
+
+// A ChainedImport is a symbol bound by chained fixups.
+type ChainedImport struct {
+	Name    string
+	Library int // dylib ordinal, or a special ordinal such as LibraryFlatLookup
+	Weak    bool
+	Addend  int64
+}
+
+// ChainedFixups is the data of a LC_DYLD_CHAINED_FIXUPS command.
+type ChainedFixups struct {
+	ChainedFixupsHeader
+	// Starts has the chain starts of each segment, nil for the
+	// segments without fixups.
+	Starts  []*ChainedStarts
+	Imports []ChainedImport
+}
+
+// linkeditData returns the command of the file locating the data cmd
+// of the __LINKEDIT segment, nil if it has none.
+func (f *File) linkeditData(cmd LoadCmd) *LinkeditData {
+	for _, l := range f.Loads {
+		if d, ok := l.(*LinkeditData); ok && d.Cmd == cmd {
+			return d
+		}
+	}
+	return nil
+}
+
+// ChainedFixups returns the decoded LC_DYLD_CHAINED_FIXUPS command of
+// the file. It returns nil, nil if the file has none.
+func (f *File) ChainedFixups() (*ChainedFixups, error) {
+	l := f.linkeditData(LoadCmdDyldChainedFixups)
+	if l == nil {
+		return nil, nil
+	}
+	dat, err := f.linkedit(l.DataOff, l.DataSize)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := parseChainedFixups(dat, f.ByteOrder)
+	if err != nil {
+		return nil, &FormatError{int64(l.DataOff), "invalid chained fixups: " + err.Error(), nil}
+	}
+	return cf, nil
+}
+
+func parseChainedFixups(dat []byte, bo binary.ByteOrder) (*ChainedFixups, error) {
+	cf := new(ChainedFixups)
+	if err := binary.Read(bytes.NewReader(dat), bo, &cf.ChainedFixupsHeader); err != nil {
+		return nil, err
+	}
+	if cf.Version != 0 {
+		return nil, fmt.Errorf("unknown version %d", cf.Version)
+	}
+	if err := cf.parseStarts(dat, bo); err != nil {
+		return nil, err
+	}
+	if err := cf.parseImports(dat, bo); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// parseStarts reads the starts in image: the number of segments, then
+// the offsets of their chain starts from the starts in image, 0 for the
+// segments without fixups.
+func (cf *ChainedFixups) parseStarts(dat []byte, bo binary.ByteOrder) error {
+	if uint64(cf.StartsOffset)+4 > uint64(len(dat)) {
+		return errors.New("invalid starts offset")
+	}
+	image := dat[cf.StartsOffset:]
+	count := uint64(bo.Uint32(image))
+	if 4+count*4 > uint64(len(image)) {
+		return errors.New("invalid segment count")
+	}
+	cf.Starts = make([]*ChainedStarts, count)
+	for i := range cf.Starts {
+		off := bo.Uint32(image[4+4*i:])
+		if off == 0 {
+			continue
+		}
+		if uint64(off) >= uint64(len(image)) {
+			return fmt.Errorf("invalid starts of segment %d", i)
+		}
+		r := bytes.NewReader(image[off:])
+		s := new(ChainedStarts)
+		if err := binary.Read(r, bo, &s.ChainedStartsHeader); err != nil {
+			return err
+		}
+		if uint64(s.PageCount)*2 > uint64(r.Len()) {
+			return fmt.Errorf("invalid page count of segment %d", i)
+		}
+		s.PageStarts = make([]uint16, s.PageCount)
+		if err := binary.Read(r, bo, s.PageStarts); err != nil {
+			return err
+		}
+		cf.Starts[i] = s
+	}
+	return nil
+}
+
+// maxSymbolsRatio is the largest ratio of the size of the decompressed
+// symbols to the size of the chained fixups data.
+const maxSymbolsRatio = 32
+
+// parseImports reads the imports table and their names.
+func (cf *ChainedFixups) parseImports(dat []byte, bo binary.ByteOrder) error {
+	var size uint64
+	switch cf.ImportsFormat {
+	case ChainedImportFormatDefault:
+		size = 4
+	case ChainedImportFormatAddend:
+		size = 8
+	case ChainedImportFormatAddend64:
+		size = 16
+	default:
+		return fmt.Errorf("unknown imports format %d", cf.ImportsFormat)
+	}
+	start := uint64(cf.ImportsOffset)
+	if start+uint64(cf.ImportsCount)*size > uint64(len(dat)) {
+		return errors.New("invalid imports table")
+	}
+	if uint64(cf.SymbolsOffset) > uint64(len(dat)) {
+		return errors.New("invalid symbols offset")
+	}
+	symbols := dat[cf.SymbolsOffset:]
+	switch cf.SymbolsFormat {
+	case 0:
+	case 1:
+		zr, err := zlib.NewReader(bytes.NewReader(symbols))
+		if err != nil {
+			return err
+		}
+		// Bound the output by a generous ratio of the data, against
+		// zlib bombs.
+		limit := int64(len(dat)) * maxSymbolsRatio
+		symbols, err = io.ReadAll(io.LimitReader(zr, limit+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(symbols)) > limit {
+			return errors.New("compressed symbols too large")
+		}
+	default:
+		return fmt.Errorf("unknown symbols format %d", cf.SymbolsFormat)
+	}
+	c := saferio.SliceCap((*ChainedImport)(nil), uint64(cf.ImportsCount))
+	if c < 0 {
+		return errors.New("too many imports")
+	}
+	cf.Imports = make([]ChainedImport, 0, c)
+	for i := uint64(0); i < uint64(cf.ImportsCount); i++ {
+		b := dat[start+i*size:]
+		var imp ChainedImport
+		var name uint64
+		switch cf.ImportsFormat {
+		case ChainedImportFormatDefault, ChainedImportFormatAddend:
+			v := bo.Uint32(b)
+			imp.Library = specialOrdinal(uint64(v&0xff), 8)
+			imp.Weak = v>>8&1 != 0
+			name = uint64(v >> 9)
+			if cf.ImportsFormat == ChainedImportFormatAddend {
+				imp.Addend = int64(int32(bo.Uint32(b[4:])))
+			}
+		case ChainedImportFormatAddend64:
+			v := bo.Uint64(b)
+			imp.Library = specialOrdinal(v&0xffff, 16)
+			imp.Weak = v>>16&1 != 0
+			name = v >> 32
+			imp.Addend = int64(bo.Uint64(b[8:]))
+		}
+		if name >= uint64(len(symbols)) {
+			return fmt.Errorf("invalid name of import %d", i)
+		}
+		imp.Name = cstring(symbols[name:])
+		cf.Imports = append(cf.Imports, imp)
+	}
+	return nil
+}
+
+// specialOrdinal returns the library ordinal of the bits-wide ordinal
+// v, whose highest values are the negative special ordinals.
+func specialOrdinal(v uint64, bits uint) int {
+	top := uint64(1)<<bits - 1
+	if v > top-15 {
+		return int(v) - int(top) - 1
+	}
+	return int(v)
+}
+
+// A chainedPtr is a decoded pointer of a chain.
+type chainedPtr struct {
+	bind    bool
+	ordinal uint64 // index of the import of a bind
+	addend  int64  // added to the addend of the import
+	next    uint64 // stride count to the next pointer, 0 at the end
+}
+
+// stride returns the unit of the offsets between the pointers of the
+// chains of format.
+func (format ChainedPtrFormat) stride() (uint64, error) {
+	switch format {
+	case ChainedPtr64, ChainedPtr64Offset:
+		return 4, nil
+	case ChainedPtrArm64e, ChainedPtrArm64eUserland, ChainedPtrArm64eUserland24:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unsupported pointer format %v", format)
+}
+
+// decode decodes a pointer of format, one of those stride supports.
+func (format ChainedPtrFormat) decode(v uint64) chainedPtr {
+	if format == ChainedPtr64 || format == ChainedPtr64Offset {
+		// rebase: target:36 high8:8 reserved:7 next:12 bind:1
+		// bind: ordinal:24 addend:8 reserved:19 next:12 bind:1
+		p := chainedPtr{bind: v>>63 != 0, next: v >> 51 & 0xfff}
+		if p.bind {
+			p.ordinal = v & 0xffffff
+			p.addend = int64(v >> 24 & 0xff)
+		}
+		return p
+	}
+	// rebase: target:43 high8:8 next:11 bind:1 auth:1
+	// bind: ordinal:16 zero:16 addend:19 next:11 bind:1 auth:1
+	// auth rebase: target:32 diversity:16 addrDiv:1 key:2 next:11 bind:1 auth:1
+	// auth bind: ordinal:16 zero:16 diversity:16 addrDiv:1 key:2 next:11 bind:1 auth:1
+	// The ordinals of ChainedPtrArm64eUserland24 have 24 bits.
+	p := chainedPtr{bind: v>>62&1 != 0, next: v >> 51 & 0x7ff}
+	if !p.bind {
+		return p
+	}
+	p.ordinal = v & 0xffff
+	if format == ChainedPtrArm64eUserland24 {
+		p.ordinal = v & 0xffffff
+	}
+	if auth := v>>63 != 0; !auth {
+		p.addend = int64(v >> 32 & 0x7ffff)
+		if p.addend&0x40000 != 0 {
+			p.addend -= 0x80000
+		}
+	}
+	return p
+}
+
+// fixupChains returns the rebases and the binds of the chained fixups
+// of the file, nil if it has none.
+func (f *File) fixupChains() ([]Rebase, []Bind, error) {
+	cf, err := f.ChainedFixups()
+	if err != nil || cf == nil {
+		return nil, nil, err
+	}
+	rebases, binds, err := f.walkChains(cf)
+	if err != nil {
+		l := f.linkeditData(LoadCmdDyldChainedFixups)
+		return nil, nil, &FormatError{int64(l.DataOff), "invalid chained fixups: " + err.Error(), nil}
+	}
+	f.setBindDylibs(binds)
+	return rebases, binds, nil
+}
+
+// walkChains follows the chains of pointers of the pages of the
+// segments, from their starts. A chain ends in its page, and the
+// pointers of the chains of a segment are bounded by its contents, so
+// that overlapping pages cannot walk the same pointers over and over.
+func (f *File) walkChains(cf *ChainedFixups) ([]Rebase, []Bind, error) {
+	var rebases []Rebase
+	var binds []Bind
+	segs := f.segments()
+	loc := f.newFixupLocation()
+	var buf [8]byte
+	for i, s := range cf.Starts {
+		if s == nil {
+			continue
+		}
+		if i >= len(segs) {
+			return nil, nil, fmt.Errorf("invalid segment index %d", i)
+		}
+		seg := segs[i]
+		stride, err := s.PointerFormat.stride()
+		if err != nil {
+			return nil, nil, err
+		}
+		for page, start := range s.PageStarts {
+			if start == ChainedPtrStartNone {
+				continue
+			}
+			pageOff := uint64(page) * uint64(s.PageSize)
+			pageEnd := pageOff + uint64(s.PageSize)
+			off := pageOff + uint64(start)
+			for {
+				if off+8 > pageEnd {
+					return nil, nil, fmt.Errorf("chain beyond page %d of segment %s", page, seg.Name)
+				}
+				if err := loc.set(i, off); err != nil {
+					return nil, nil, err
+				}
+				if err := loc.reserve(1, 0); err != nil {
+					return nil, nil, err
+				}
+				if _, err := seg.ReadAt(buf[:], int64(off)); err != nil {
+					return nil, nil, fmt.Errorf("chain beyond segment %s", seg.Name)
+				}
+				p := s.PointerFormat.decode(f.ByteOrder.Uint64(buf[:]))
+				if p.bind {
+					if p.ordinal >= uint64(len(cf.Imports)) {
+						return nil, nil, fmt.Errorf("invalid import %d", p.ordinal)
+					}
+					imp := cf.Imports[p.ordinal]
+					binds = append(binds, Bind{
+						Kind:    BindRegular,
+						Segment: seg.Name,
+						Offset:  off,
+						Address: seg.Addr + off,
+						Type:    FixupPointer,
+						Name:    imp.Name,
+						Library: imp.Library,
+						Addend:  imp.Addend + p.addend,
+						Weak:    imp.Weak,
+					})
+				} else {
+					rebases = append(rebases, Rebase{
+						Segment: seg.Name,
+						Offset:  off,
+						Address: seg.Addr + off,
+						Type:    FixupPointer,
+					})
+				}
+				if p.next == 0 {
+					break
+				}
+				off += p.next * stride
+			}
+		}
+	}
+	return rebases, binds, nil
+}
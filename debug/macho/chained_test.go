@@ -0,0 +1,327 @@
+package macho
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testImport is an import of the chained fixups to encode.
+type testImport struct {
+	library int
+	weak    bool
+	addend  int64
+	name    string
+}
+
+// chainedImports returns the imports table of format and its symbols.
+func chainedImports(format ChainedImportFormat, imports []testImport) (table, symbols []byte) {
+	symbols = []byte{0}
+	for _, imp := range imports {
+		name := uint64(len(symbols))
+		symbols = append(append(symbols, imp.name...), 0)
+		var weak uint64
+		if imp.weak {
+			weak = 1
+		}
+		switch format {
+		case ChainedImportFormatDefault, ChainedImportFormatAddend:
+			v := uint32(uint8(imp.library)) | uint32(weak)<<8 | uint32(name)<<9
+			table = binary.LittleEndian.AppendUint32(table, v)
+			if format == ChainedImportFormatAddend {
+				table = binary.LittleEndian.AppendUint32(table, uint32(imp.addend))
+			}
+		case ChainedImportFormatAddend64:
+			v := uint64(uint16(imp.library)) | weak<<16 | name<<32
+			table = binary.LittleEndian.AppendUint64(table, v)
+			table = binary.LittleEndian.AppendUint64(table, uint64(imp.addend))
+		}
+	}
+	return table, symbols
+}
+
+// chainedFixups returns the data of a chained fixups command with the
+// page starts of segment 1 of 2.
+func chainedFixups(ptrFormat ChainedPtrFormat, pageStarts []uint16, importsFormat ChainedImportFormat, imports []testImport) []byte {
+	table, symbols := chainedImports(importsFormat, imports)
+	var starts bytes.Buffer
+	bo := binary.LittleEndian
+	binary.Write(&starts, bo, []uint32{2, 0, 12})
+	binary.Write(&starts, bo, ChainedStartsHeader{
+		Size:          uint32(22 + 2*len(pageStarts)),
+		PageSize:      0x1000,
+		PointerFormat: ptrFormat,
+		SegmentOffset: 0x4000,
+		PageCount:     uint16(len(pageStarts)),
+	})
+	binary.Write(&starts, bo, pageStarts)
+	for starts.Len()%4 != 0 {
+		starts.WriteByte(0)
+	}
+	hdr := ChainedFixupsHeader{
+		StartsOffset:  28,
+		ImportsOffset: uint32(28 + starts.Len()),
+		SymbolsOffset: uint32(28 + starts.Len() + len(table)),
+		ImportsCount:  uint32(len(imports)),
+		ImportsFormat: importsFormat,
+	}
+	var b bytes.Buffer
+	binary.Write(&b, bo, hdr)
+	b.Write(starts.Bytes())
+	b.Write(table)
+	b.Write(symbols)
+	return b.Bytes()
+}
+
+// chainedImage returns an image whose __DATA segment holds the pointers
+// ptrs, keyed by offset, fixed up by the chained fixups data fixups.
+func chainedImage(ptrs map[uint64]uint64, fixups []byte) []byte {
+	const dataSize = 0x2000
+	seg := func(name string, addr, off, size uint64) []byte {
+		c := command(LoadCmdSegment64, Segment64{Addr: addr, Memsz: size, Offset: off, Filesz: size}, nil)
+		copy(c[8:], name)
+		return c
+	}
+	dylib := func(cmd LoadCmd, name string) []byte {
+		return command(cmd, DylibCmd{Name: 24}, []byte(name+"\x00"))
+	}
+	libSystem := dylib(LoadCmdDylib, "/usr/lib/libSystem.B.dylib")
+	metal := dylib(LoadCmdLoadWeakDylib, "/System/Library/Frameworks/Metal.framework/Metal")
+	// The commands have fixed sizes: place __DATA after them.
+	dataOff := uint64(32 + 2*72 + len(libSystem) + len(metal) + 16)
+	text := seg("__TEXT", 0x100000000, 0, dataOff)
+	data := seg("__DATA", 0x100004000, dataOff, dataSize)
+	cmd := command(LoadCmdDyldChainedFixups, LinkeditDataCmd{DataOff: uint32(dataOff + dataSize), DataSize: uint32(len(fixups))}, nil)
+	contents := make([]byte, dataSize)
+	for off, v := range ptrs {
+		binary.LittleEndian.PutUint64(contents[off:], v)
+	}
+	return buildImage(TypeExec, append(contents, fixups...), text, data, libSystem, metal, cmd)
+}
+
+var testImports = []testImport{
+	{library: 1, name: "_malloc"},
+	{library: 2, weak: true, addend: 16, name: "_MTLCreateSystemDefaultDevice"},
+	{library: LibraryFlatLookup, name: "_flat"},
+}
+
+func TestChainedImports(t *testing.T) {
+	for _, format := range []ChainedImportFormat{ChainedImportFormatDefault, ChainedImportFormatAddend, ChainedImportFormatAddend64} {
+		dat := chainedFixups(ChainedPtr64, nil, format, testImports)
+		cf, err := parseChainedFixups(dat, binary.LittleEndian)
+		if err != nil {
+			t.Errorf("format %d: %v", format, err)
+			continue
+		}
+		var want []ChainedImport
+		for _, imp := range testImports {
+			ci := ChainedImport{Name: imp.name, Library: imp.library, Weak: imp.weak}
+			if format != ChainedImportFormatDefault {
+				ci.Addend = imp.addend
+			}
+			want = append(want, ci)
+		}
+		if !reflect.DeepEqual(cf.Imports, want) {
+			t.Errorf("format %d imports:\n got %+v\nwant %+v", format, cf.Imports, want)
+		}
+		if len(cf.Starts) != 2 || cf.Starts[0] != nil || cf.Starts[1] == nil {
+			t.Errorf("format %d starts = %v", format, cf.Starts)
+		}
+	}
+
+	// zlib compressed symbols, and a bomb of them.
+	compress := func(dat, symbols []byte) []byte {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write(symbols)
+		zw.Close()
+		off := binary.LittleEndian.Uint32(dat[12:]) // SymbolsOffset
+		dat = append(dat[:off:off], b.Bytes()...)
+		binary.LittleEndian.PutUint32(dat[24:], 1) // SymbolsFormat
+		return dat
+	}
+	dat := chainedFixups(ChainedPtr64, nil, ChainedImportFormatDefault, testImports)
+	_, symbols := chainedImports(ChainedImportFormatDefault, testImports)
+	cf, err := parseChainedFixups(compress(dat, symbols), binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("compressed symbols: %v", err)
+	}
+	if len(cf.Imports) != len(testImports) || cf.Imports[1].Name != testImports[1].name {
+		t.Errorf("imports of compressed symbols = %+v", cf.Imports)
+	}
+	bomb := append(symbols, make([]byte, 1<<20)...)
+	if _, err := parseChainedFixups(compress(dat, bomb), binary.LittleEndian); err == nil {
+		t.Error("parseChainedFixups of a zlib bomb succeeded")
+	}
+
+	if o := specialOrdinal(0xfff0, 16); o != 0xfff0 {
+		t.Errorf("specialOrdinal(0xfff0, 16) = %d", o)
+	}
+	if o := specialOrdinal(0xfffd, 16); o != LibraryWeakLookup {
+		t.Errorf("specialOrdinal(0xfffd, 16) = %d", o)
+	}
+}
+
+func TestChainedFixups(t *testing.T) {
+	const base = 0x100000000
+	// Page 0 has a rebase at 0x10, then binds at 0x18 and 0x28; page 1
+	// a rebase at 0x1008.
+	pageStarts := []uint16{0x10, 0x8}
+	ptr64 := func(offsetTargets bool) map[uint64]uint64 {
+		target := uint64(base + 0x1000)
+		if offsetTargets {
+			target = 0x1000
+		}
+		return map[uint64]uint64{
+			0x10:   target | 2<<51,
+			0x18:   1<<63 | 0 | 4<<51,
+			0x28:   1<<63 | 1 | 8<<24,
+			0x1008: target,
+		}
+	}
+	arm64e := func(ordinal24 bool) map[uint64]uint64 {
+		addend := uint64(0x80000-8) << 32 // -8
+		first := uint64(0)
+		if ordinal24 {
+			// Beyond the 16 bits of the other formats.
+			first = 1 << 16
+		}
+		return map[uint64]uint64{
+			0x10:   0x1000 | 1<<51,
+			0x18:   1<<62 | first | addend | 2<<51,
+			0x28:   1<<63 | 1<<62 | 1 | 0x1234<<32,
+			0x1008: 1<<63 | 0x1000 | 0x5678<<32,
+		}
+	}
+	bind := func(off uint64, imp testImport, addend int64, dylib string) Bind {
+		return Bind{
+			Kind:    BindRegular,
+			Segment: "__DATA",
+			Offset:  off,
+			Address: base + 0x4000 + off,
+			Type:    FixupPointer,
+			Name:    imp.name,
+			Library: imp.library,
+			Dylib:   dylib,
+			Addend:  imp.addend + addend,
+			Weak:    imp.weak,
+		}
+	}
+	const (
+		libSystem = "/usr/lib/libSystem.B.dylib"
+		metal     = "/System/Library/Frameworks/Metal.framework/Metal"
+	)
+	tests := []struct {
+		format ChainedPtrFormat
+		ptrs   map[uint64]uint64
+		binds  []Bind
+	}{
+		{ChainedPtr64, ptr64(false), []Bind{bind(0x18, testImports[0], 0, libSystem), bind(0x28, testImports[1], 8, metal)}},
+		{ChainedPtr64Offset, ptr64(true), []Bind{bind(0x18, testImports[0], 0, libSystem), bind(0x28, testImports[1], 8, metal)}},
+		{ChainedPtrArm64e, arm64e(false), []Bind{bind(0x18, testImports[0], -8, libSystem), bind(0x28, testImports[1], 0, metal)}},
+		{ChainedPtrArm64eUserland, arm64e(false), []Bind{bind(0x18, testImports[0], -8, libSystem), bind(0x28, testImports[1], 0, metal)}},
+	}
+	wantRebases := []Rebase{
+		{Segment: "__DATA", Offset: 0x10, Address: base + 0x4010, Type: FixupPointer},
+		{Segment: "__DATA", Offset: 0x1008, Address: base + 0x5008, Type: FixupPointer},
+	}
+	for _, tt := range tests {
+		fixups := chainedFixups(tt.format, pageStarts, ChainedImportFormatAddend, testImports)
+		f, err := NewFile(bytes.NewReader(chainedImage(tt.ptrs, fixups)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf, err := f.ChainedFixups()
+		if err != nil {
+			t.Errorf("%v: %v", tt.format, err)
+			continue
+		}
+		if s := cf.Starts[1]; s.PointerFormat != tt.format || !reflect.DeepEqual(s.PageStarts, pageStarts) {
+			t.Errorf("%v: starts = %+v", tt.format, s)
+		}
+		rebases, err := f.Rebases()
+		if err != nil {
+			t.Errorf("%v: %v", tt.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(rebases, wantRebases) {
+			t.Errorf("%v rebases:\n got %+v\nwant %+v", tt.format, rebases, wantRebases)
+		}
+		binds, err := f.Binds()
+		if err != nil {
+			t.Errorf("%v: %v", tt.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(binds, tt.binds) {
+			t.Errorf("%v binds:\n got %+v\nwant %+v", tt.format, binds, tt.binds)
+		}
+	}
+
+	// The 24-bit ordinals of ChainedPtrArm64eUserland24 address 65537
+	// imports.
+	imports := make([]testImport, 1<<16+2)
+	for i := range imports {
+		imports[i] = testImport{library: 1, name: "_f"}
+	}
+	imports[1<<16].name = "_far"
+	fixups := chainedFixups(ChainedPtrArm64eUserland24, pageStarts, ChainedImportFormatDefault, imports)
+	f, err := NewFile(bytes.NewReader(chainedImage(arm64e(true), fixups)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binds, err := f.Binds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(binds) != 2 || binds[0].Name != "_far" || binds[0].Addend != -8 {
+		t.Errorf("ChainedPtrArm64eUserland24 binds = %+v", binds)
+	}
+
+	// An import out of range, and an unsupported pointer format.
+	bad := ptr64(false)
+	bad[0x28] = 1<<63 | 7
+	for _, dat := range [][]byte{
+		chainedImage(bad, chainedFixups(ChainedPtr64, pageStarts, ChainedImportFormatDefault, testImports)),
+		chainedImage(ptr64(false), chainedFixups(ChainedPtr32, pageStarts, ChainedImportFormatDefault, testImports)),
+	} {
+		f, err := NewFile(bytes.NewReader(dat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Binds(); err == nil {
+			t.Error("Binds of invalid chained fixups succeeded")
+		}
+	}
+}
+
+func TestChainedFixupsOverlappingPages(t *testing.T) {
+	// A chain of rebases through the whole of __DATA, and pages of 8
+	// bytes all starting at its first pointer: walking the chain from
+	// each of them would be quadratic in the size of the segment.
+	ptrs := make(map[uint64]uint64)
+	for off := uint64(0); off < 0x2000-8; off += 8 {
+		ptrs[off] = 0x1000 | 2<<51
+	}
+	pageStarts := make([]uint16, 0x400)
+	fixups := chainedFixups(ChainedPtr64Offset, pageStarts, ChainedImportFormatDefault, testImports)
+	binary.LittleEndian.PutUint16(fixups[28+12+4:], 8) // PageSize
+	f, err := NewFile(bytes.NewReader(chainedImage(ptrs, fixups)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebases, err := f.Rebases(); err == nil {
+		t.Errorf("Rebases of chains beyond their pages = %d rebases, want error", len(rebases))
+	}
+
+	// A page size of 0 puts all the pages at the start of the segment.
+	binary.LittleEndian.PutUint16(fixups[28+12+4:], 0)
+	f, err = NewFile(bytes.NewReader(chainedImage(map[uint64]uint64{0: 0x1000}, fixups)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebases, err := f.Rebases(); err == nil {
+		t.Errorf("Rebases of overlapping pages = %d rebases, want error", len(rebases))
+	}
+}
@@ -0,0 +1,429 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A FixupType is the kind of location a rebase or a bind updates.
+type FixupType uint8
+
+const (
+	FixupPointer        FixupType = 1
+	FixupTextAbsolute32 FixupType = 2
+	FixupTextPCRel32    FixupType = 3
+)
+
+var fixupTypeStrings = []intName{
+	{uint32(FixupPointer), "Pointer"},
+	{uint32(FixupTextAbsolute32), "TextAbsolute32"},
+	{uint32(FixupTextPCRel32), "TextPCRel32"},
+}
+
+func (t FixupType) String() string { return stringName(uint32(t), fixupTypeStrings, false) }
+
+// Special library ordinals of the binds, besides the ordinals of the
+// dylibs which count from 1.
+const (
+	LibrarySelf           = 0  // the image itself
+	LibraryMainExecutable = -1 // the main executable
+	LibraryFlatLookup     = -2 // the first image defining the symbol
+	LibraryWeakLookup     = -3 // the first weak or regular definition
+)
+
+// A BindKind is the dyld info stream a bind comes from.
+type BindKind uint8
+
+const (
+	BindRegular BindKind = iota // bound at load time
+	BindWeak                    // coalesced with the other weak definitions
+	BindLazy                    // bound on the first call
+)
+
+var bindKindStrings = []intName{
+	{uint32(BindRegular), "Regular"},
+	{uint32(BindWeak), "Weak"},
+	{uint32(BindLazy), "Lazy"},
+}
+
+func (k BindKind) String() string { return stringName(uint32(k), bindKindStrings, false) }
+
+// A Rebase is a location dyld slides by the difference between the
+// load address of the image and its preferred address.
+type Rebase struct {
+	Segment string
+	Offset  uint64 // offset in Segment
+	Address uint64
+	Type    FixupType
+}
+
+// A Bind is a location dyld sets to the address of a symbol, plus
+// Addend.
+type Bind struct {
+	Kind    BindKind
+	Segment string
+	Offset  uint64 // offset in Segment
+	Address uint64
+	Type    FixupType
+	Name    string
+	// Library is the ordinal of the dylib defining the symbol, or one
+	// of the special ordinals; Dylib is its install name.
+	Library int
+	Dylib   string
+	Addend  int64
+	Weak    bool // weak import, left 0 if the symbol is missing
+}
+
+// Opcodes of the rebase stream, with an immediate in the low bits.
+const (
+	rebaseOpcodeMask                  = 0xf0
+	rebaseImmediateMask               = 0x0f
+	rebaseOpDone                      = 0x00
+	rebaseOpSetTypeImm                = 0x10
+	rebaseOpSetSegmentAndOffsetUleb   = 0x20
+	rebaseOpAddAddrUleb               = 0x30
+	rebaseOpAddAddrImmScaled          = 0x40
+	rebaseOpDoRebaseImmTimes          = 0x50
+	rebaseOpDoRebaseUlebTimes         = 0x60
+	rebaseOpDoRebaseAddAddrUleb       = 0x70
+	rebaseOpDoRebaseUlebTimesSkipping = 0x80
+)
+
+// Opcodes of the bind streams, with an immediate in the low bits.
+const (
+	bindOpcodeMask                    = 0xf0
+	bindImmediateMask                 = 0x0f
+	bindOpDone                        = 0x00
+	bindOpSetDylibOrdinalImm          = 0x10
+	bindOpSetDylibOrdinalUleb         = 0x20
+	bindOpSetDylibSpecialImm          = 0x30
+	bindOpSetSymbolTrailingFlagsImm   = 0x40
+	bindOpSetTypeImm                  = 0x50
+	bindOpSetAddendSleb               = 0x60
+	bindOpSetSegmentAndOffsetUleb     = 0x70
+	bindOpAddAddrUleb                 = 0x80
+	bindOpDoBind                      = 0x90
+	bindOpDoBindAddAddrUleb           = 0xa0
+	bindOpDoBindAddAddrImmScaled      = 0xb0
+	bindOpDoBindUlebTimesSkippingUleb = 0xc0
+	bindOpThreaded                    = 0xd0
+
+	bindSymbolFlagsWeakImport        = 0x1
+	bindSymbolFlagsNonWeakDefinition = 0x8
+)
+
+// segments returns the segments of the file, in the order of their
+// load commands, which the dyld info and the chained fixups index.
+func (f *File) segments() []*Segment {
+	var segs []*Segment
+	for _, l := range f.Loads {
+		if s, ok := l.(*Segment); ok {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+func (f *File) pointerSize() uint64 {
+	if f.Magic == Magic64 {
+		return 8
+	}
+	return 4
+}
+
+// dyldInfo returns the dyld info command of the file, nil if it has
+// none.
+func (f *File) dyldInfo() *DyldInfo {
+	for _, l := range f.Loads {
+		if d, ok := l.(*DyldInfo); ok {
+			return d
+		}
+	}
+	return nil
+}
+
+// fixupLocation is the location the opcodes of the dyld info streams
+// update, a segment and an offset in it. The locations are bounded by
+// the contents of the segments in the file, and their number in each
+// segment by the pointers its contents hold, so that a stream of a few
+// bytes cannot describe more fixups than the file has room for.
+type fixupLocation struct {
+	segs   []*Segment
+	sizes  []uint64 // sizes of the contents of segs in the file
+	seg    int      // index of the segment, -1 if not set
+	offset uint64
+	left   []uint64 // number of fixups left in each of segs
+}
+
+func (f *File) newFixupLocation() *fixupLocation {
+	l := &fixupLocation{segs: f.segments(), seg: -1}
+	l.sizes = make([]uint64, len(l.segs))
+	l.left = make([]uint64, len(l.segs))
+	for i, s := range l.segs {
+		size := s.Filesz
+		if size > s.Memsz {
+			size = s.Memsz
+		}
+		if size == 0 {
+			continue
+		}
+		var b [1]byte
+		if _, err := s.ReadAt(b[:], int64(size-1)); err != nil {
+			continue // truncated file
+		}
+		l.sizes[i] = size
+		l.left[i] = size / f.pointerSize()
+	}
+	return l
+}
+
+func (l *fixupLocation) set(index int, offset uint64) error {
+	if index < 0 || index >= len(l.segs) {
+		return fmt.Errorf("invalid segment index %d", index)
+	}
+	l.seg, l.offset = index, offset
+	return nil
+}
+
+// reserve reports an error if the count locations stride bytes apart
+// from the location are not all in the contents of its segment, or are
+// more than the fixups left in it.
+func (l *fixupLocation) reserve(count, stride uint64) error {
+	if l.seg < 0 {
+		return errors.New("no segment set")
+	}
+	if count == 0 {
+		return nil
+	}
+	size := l.sizes[l.seg]
+	if l.offset >= size || count > 1 && (stride == 0 || count-1 > (size-l.offset-1)/stride) {
+		return fmt.Errorf("offset %#x beyond segment %s", l.offset, l.segs[l.seg].Name)
+	}
+	if count > l.left[l.seg] {
+		return fmt.Errorf("too many fixups in segment %s", l.segs[l.seg].Name)
+	}
+	l.left[l.seg] -= count
+	return nil
+}
+
+// Rebases returns the rebases of the LC_DYLD_INFO command, or of the
+// LC_DYLD_CHAINED_FIXUPS command. It returns nil, nil if the file has
+// neither.
+func (f *File) Rebases() ([]Rebase, error) {
+	info := f.dyldInfo()
+	if info == nil {
+		rebases, _, err := f.fixupChains()
+		return rebases, err
+	}
+	if info.RebaseSize == 0 {
+		return nil, nil
+	}
+	dat, err := f.linkedit(info.RebaseOff, info.RebaseSize)
+	if err != nil {
+		return nil, err
+	}
+	rebases, err := f.parseRebases(dat)
+	if err != nil {
+		return nil, &FormatError{int64(info.RebaseOff), "invalid rebase info: " + err.Error(), nil}
+	}
+	return rebases, nil
+}
+
+// parseRebases interprets the opcodes of the rebase stream.
+func (f *File) parseRebases(dat []byte) ([]Rebase, error) {
+	var rebases []Rebase
+	ptrSize := f.pointerSize()
+	loc := f.newFixupLocation()
+	typ := FixupPointer
+	r := &dyldReader{b: dat}
+	// rebase records count rebases, each followed by skip bytes.
+	rebase := func(count, skip uint64) error {
+		if err := loc.reserve(count, skip+ptrSize); err != nil {
+			return err
+		}
+		seg := loc.segs[loc.seg]
+		for i := uint64(0); i < count; i++ {
+			rebases = append(rebases, Rebase{
+				Segment: seg.Name,
+				Offset:  loc.offset,
+				Address: seg.Addr + loc.offset,
+				Type:    typ,
+			})
+			loc.offset += skip + ptrSize
+		}
+		return nil
+	}
+	for r.off < len(r.b) {
+		c := r.byte()
+		imm := uint64(c & rebaseImmediateMask)
+		var err error
+		switch c & rebaseOpcodeMask {
+		case rebaseOpDone:
+			return rebases, r.err
+		case rebaseOpSetTypeImm:
+			typ = FixupType(imm)
+		case rebaseOpSetSegmentAndOffsetUleb:
+			err = loc.set(int(imm), r.uleb())
+		case rebaseOpAddAddrUleb:
+			loc.offset += r.uleb()
+		case rebaseOpAddAddrImmScaled:
+			loc.offset += imm * ptrSize
+		case rebaseOpDoRebaseImmTimes:
+			err = rebase(imm, 0)
+		case rebaseOpDoRebaseUlebTimes:
+			err = rebase(r.uleb(), 0)
+		case rebaseOpDoRebaseAddAddrUleb:
+			err = rebase(1, r.uleb())
+		case rebaseOpDoRebaseUlebTimesSkipping:
+			count := r.uleb()
+			err = rebase(count, r.uleb())
+		default:
+			err = fmt.Errorf("unknown opcode %#x", c)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rebases, nil
+}
+
+// Binds returns the regular, weak and lazy binds of the LC_DYLD_INFO
+// command, in this order, or the binds of the LC_DYLD_CHAINED_FIXUPS
+// command, all regular. It returns nil, nil if the file has neither.
+func (f *File) Binds() ([]Bind, error) {
+	info := f.dyldInfo()
+	if info == nil {
+		_, binds, err := f.fixupChains()
+		return binds, err
+	}
+	streams := []struct {
+		kind      BindKind
+		off, size uint32
+	}{
+		{BindRegular, info.BindOff, info.BindSize},
+		{BindWeak, info.WeakBindOff, info.WeakBindSize},
+		{BindLazy, info.LazyBindOff, info.LazyBindSize},
+	}
+	var binds []Bind
+	for _, s := range streams {
+		if s.size == 0 {
+			continue
+		}
+		dat, err := f.linkedit(s.off, s.size)
+		if err != nil {
+			return nil, err
+		}
+		b, err := f.parseBinds(dat, s.kind)
+		if err != nil {
+			return nil, &FormatError{int64(s.off), fmt.Sprintf("invalid %s bind info: %v", s.kind, err), nil}
+		}
+		binds = append(binds, b...)
+	}
+	f.setBindDylibs(binds)
+	return binds, nil
+}
+
+// setBindDylibs sets the install names of the dylibs of binds.
+func (f *File) setBindDylibs(binds []Bind) {
+	var dylibs []string
+	for _, l := range f.Loads {
+		if d, ok := l.(*Dylib); ok {
+			dylibs = append(dylibs, d.Name)
+		}
+	}
+	for i := range binds {
+		if n := binds[i].Library; n > 0 && n <= len(dylibs) {
+			binds[i].Dylib = dylibs[n-1]
+		}
+	}
+}
+
+// parseBinds interprets the opcodes of a bind stream. The entries of
+// the lazy stream each end with a done opcode.
+func (f *File) parseBinds(dat []byte, kind BindKind) ([]Bind, error) {
+	var binds []Bind
+	ptrSize := f.pointerSize()
+	loc := f.newFixupLocation()
+	b := Bind{Kind: kind, Type: FixupPointer}
+	if kind == BindWeak {
+		b.Library = LibraryWeakLookup
+	}
+	r := &dyldReader{b: dat}
+	// bind records count binds, each followed by skip bytes.
+	bind := func(count, skip uint64) error {
+		if err := loc.reserve(count, skip+ptrSize); err != nil {
+			return err
+		}
+		if b.Name == "" {
+			return errors.New("bind without a symbol")
+		}
+		seg := loc.segs[loc.seg]
+		for i := uint64(0); i < count; i++ {
+			b.Segment, b.Offset, b.Address = seg.Name, loc.offset, seg.Addr+loc.offset
+			binds = append(binds, b)
+			loc.offset += skip + ptrSize
+		}
+		return nil
+	}
+	for r.off < len(r.b) {
+		c := r.byte()
+		imm := uint64(c & bindImmediateMask)
+		var err error
+		switch c & bindOpcodeMask {
+		case bindOpDone:
+			if kind != BindLazy {
+				return binds, r.err
+			}
+		case bindOpSetDylibOrdinalImm:
+			b.Library = int(imm)
+		case bindOpSetDylibOrdinalUleb:
+			b.Library = int(r.uleb())
+		case bindOpSetDylibSpecialImm:
+			// The immediate is a negative ordinal, sign extended.
+			if imm == 0 {
+				b.Library = LibrarySelf
+			} else {
+				b.Library = int(int8(c | bindOpcodeMask))
+			}
+		case bindOpSetSymbolTrailingFlagsImm:
+			b.Name = r.cstring()
+			b.Weak = imm&bindSymbolFlagsWeakImport != 0
+			if imm&bindSymbolFlagsNonWeakDefinition != 0 {
+				// A strong definition of the image overriding the weak
+				// ones, not followed by a bind.
+				b.Name = ""
+			}
+		case bindOpSetTypeImm:
+			b.Type = FixupType(imm)
+		case bindOpSetAddendSleb:
+			b.Addend = r.sleb()
+		case bindOpSetSegmentAndOffsetUleb:
+			err = loc.set(int(imm), r.uleb())
+		case bindOpAddAddrUleb:
+			loc.offset += r.uleb()
+		case bindOpDoBind:
+			err = bind(1, 0)
+		case bindOpDoBindAddAddrUleb:
+			err = bind(1, r.uleb())
+		case bindOpDoBindAddAddrImmScaled:
+			err = bind(1, imm*ptrSize)
+		case bindOpDoBindUlebTimesSkippingUleb:
+			count := r.uleb()
+			err = bind(count, r.uleb())
+		case bindOpThreaded:
+			err = errors.New("threaded binds are not supported")
+		default:
+			err = fmt.Errorf("unknown opcode %#x", c)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return binds, nil
+}
@@ -0,0 +1,185 @@
+package macho
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// dyldInfoFile returns a 64-bit file with the segments the test streams
+// refer to, __DATA being segment 2, and __BSS segment 3 whose contents
+// are not in the file.
+func dyldInfoFile() *File {
+	seg := func(name string, addr, memsz, filesz uint64) *Segment {
+		s := &Segment{SegmentHeader: SegmentHeader{Cmd: LoadCmdSegment64, Name: name, Addr: addr, Memsz: memsz, Filesz: filesz}}
+		s.sr = io.NewSectionReader(bytes.NewReader(make([]byte, filesz)), 0, int64(filesz))
+		s.ReaderAt = s.sr
+		return s
+	}
+	return &File{
+		FileHeader: FileHeader{Magic: Magic64},
+		Loads: []Load{
+			seg("__PAGEZERO", 0, 0x100000000, 0),
+			seg("__TEXT", 0x100000000, 0x4000, 0x4000),
+			seg("__DATA", 0x100004000, 0x1000, 0x1000),
+			seg("__BSS", 0x100005000, 1<<44, 0x10),
+		},
+	}
+}
+
+func TestParseRebases(t *testing.T) {
+	f := dyldInfoFile()
+	stream := []byte{
+		0x11,       // type pointer
+		0x22, 0x10, // __DATA+0x10
+		0x53,       // 3 rebases
+		0x41,       // skip 1 pointer
+		0x70, 0x08, // rebase and skip 8 bytes
+		0x80, 0x02, 0x08, // 2 rebases each followed by 8 bytes
+		0x00, // done
+	}
+	rebases, err := f.parseRebases(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []Rebase
+	for _, off := range []uint64{0x10, 0x18, 0x20, 0x30, 0x40, 0x50} {
+		want = append(want, Rebase{Segment: "__DATA", Offset: off, Address: 0x100004000 + off, Type: FixupPointer})
+	}
+	if !reflect.DeepEqual(rebases, want) {
+		t.Errorf("rebases:\n got %+v\nwant %+v", rebases, want)
+	}
+
+	for _, bad := range [][]byte{
+		{0x24, 0x00, 0x51},                                     // segment 4
+		{0x22, 0x00, 0x60, 0x81, 0x04},                         // 513 rebases beyond __DATA
+		{0x23, 0x00, 0x60, 0x80, 0x80, 0x80, 0x80, 0x80, 0x20}, // 2^40 rebases in memory only
+		{0x22, 0x00, 0x60, 0x80, 0x04, 0x22, 0x00, 0x51},       // 513 rebases of the 512 pointers of __DATA
+		{0x22, 0x80, 0x20, 0x51},                               // offset beyond __DATA
+		{0x51},                                                 // no segment
+		{0x22},                                                 // truncated
+		{0xf0},                                                 // unknown opcode
+	} {
+		if _, err := f.parseRebases(bad); err == nil {
+			t.Errorf("parseRebases(% x) succeeded", bad)
+		}
+	}
+}
+
+func TestParseBinds(t *testing.T) {
+	f := dyldInfoFile()
+	data := func(off uint64) (string, uint64, uint64) { return "__DATA", off, 0x100004000 + off }
+	bind := func(kind BindKind, off uint64, name string, library int, addend int64, weak bool) Bind {
+		b := Bind{Kind: kind, Type: FixupPointer, Name: name, Library: library, Addend: addend, Weak: weak}
+		b.Segment, b.Offset, b.Address = data(off)
+		return b
+	}
+	tests := []struct {
+		kind   BindKind
+		stream []byte
+		want   []Bind
+	}{
+		{
+			BindRegular,
+			[]byte{
+				0x11,                        // libSystem
+				0x40, '_', 'm', 'e', 'm', 0, // _mem
+				0x51,       // type pointer
+				0x72, 0x00, // __DATA+0
+				0x90,       // bind
+				0x60, 0x78, // addend -8
+				0x41, '_', 'o', 'p', 't', 0, // _opt, weak import
+				0xb1,                        // bind and skip 1 pointer
+				0x3e,                        // flat lookup
+				0x40, '_', 'f', 'l', 't', 0, // _flt
+				0x60, 0x00, // addend 0
+				0xc0, 0x02, 0x08, // 2 binds each followed by 8 bytes
+				0x00, // done
+				0x90, // ignored
+			},
+			[]Bind{
+				bind(BindRegular, 0x00, "_mem", 1, 0, false),
+				bind(BindRegular, 0x08, "_opt", 1, -8, true),
+				bind(BindRegular, 0x18, "_flt", LibraryFlatLookup, 0, false),
+				bind(BindRegular, 0x28, "_flt", LibraryFlatLookup, 0, false),
+			},
+		},
+		{
+			BindWeak,
+			[]byte{
+				0x48, '_', 's', 't', 'r', 'o', 'n', 'g', 0, // strong definition
+				0x40, '_', 'w', 'e', 'a', 'k', 0,
+				0x72, 0x30,
+				0x90,
+				0x00,
+			},
+			[]Bind{bind(BindWeak, 0x30, "_weak", LibraryWeakLookup, 0, false)},
+		},
+		{
+			BindLazy,
+			[]byte{
+				0x72, 0x40, 0x11, 0x40, '_', 'p', 'u', 't', 's', 0, 0x90, 0x00,
+				0x72, 0x48, 0x20, 0x02, 0x40, '_', 'e', 'x', 'i', 't', 0, 0x90, 0x00,
+				0x72, 0x50, 0x3f, 0x40, '_', 'm', 'a', 'i', 'n', 0, 0x90, 0x00,
+			},
+			[]Bind{
+				bind(BindLazy, 0x40, "_puts", 1, 0, false),
+				bind(BindLazy, 0x48, "_exit", 2, 0, false),
+				bind(BindLazy, 0x50, "_main", LibraryMainExecutable, 0, false),
+			},
+		},
+	}
+	for _, tt := range tests {
+		binds, err := f.parseBinds(tt.stream, tt.kind)
+		if err != nil {
+			t.Errorf("%v: %v", tt.kind, err)
+			continue
+		}
+		if !reflect.DeepEqual(binds, tt.want) {
+			t.Errorf("%v binds:\n got %+v\nwant %+v", tt.kind, binds, tt.want)
+		}
+	}
+
+	for _, bad := range [][]byte{
+		{0x72, 0x00, 0x90},                                 // no symbol
+		{0x40, 'a', 0, 0x74, 0x00, 0x90},                   // segment 4
+		{0x40, 'a', 0, 0x73, 0x20, 0x90},                   // __BSS+0x20, not in the file
+		{0x40, 'a', 0, 0x72, 0x00, 0xc0, 0x81, 0x04, 0x00}, // 513 binds beyond __DATA
+		{0x40, 'a'},  // truncated name
+		{0xd0, 0x00}, // threaded
+	} {
+		if _, err := f.parseBinds(bad, BindRegular); err == nil {
+			t.Errorf("parseBinds(% x) succeeded", bad)
+		}
+	}
+}
+
+func TestDyldInfo(t *testing.T) {
+	f := openBase64(t, "testdata/clang-amd64-darwin-exec-with-rpath.base64")
+	rebases, err := f.Rebases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRebases := []Rebase{{Segment: "__DATA", Offset: 0x10, Address: 0x100001010, Type: FixupPointer}}
+	if !reflect.DeepEqual(rebases, wantRebases) {
+		t.Errorf("Rebases = %+v, want %+v", rebases, wantRebases)
+	}
+	binds, err := f.Binds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const libSystem = "/usr/lib/libSystem.B.dylib"
+	wantBinds := []Bind{
+		{Kind: BindRegular, Segment: "__DATA", Offset: 0, Address: 0x100001000, Type: FixupPointer, Name: "dyld_stub_binder", Library: 1, Dylib: libSystem},
+		{Kind: BindLazy, Segment: "__DATA", Offset: 0x10, Address: 0x100001010, Type: FixupPointer, Name: "_printf", Library: 1, Dylib: libSystem},
+	}
+	if !reflect.DeepEqual(binds, wantBinds) {
+		t.Errorf("Binds = %+v, want %+v", binds, wantBinds)
+	}
+
+	f = openBase64(t, "testdata/gcc-amd64-darwin-exec.base64")
+	if binds, err := f.Binds(); binds != nil || err != nil {
+		t.Errorf("Binds without dyld info = %v, %v", binds, err)
+	}
+}
@@ -0,0 +1,282 @@
+package macho
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// An ExportFlag is the flags of a symbol of the exports trie. The low
+// two bits are the kind of the symbol.
+type ExportFlag uint64
+
+const (
+	ExportKindMask        ExportFlag = 0x03
+	ExportRegular         ExportFlag = 0x00
+	ExportThreadLocal     ExportFlag = 0x01
+	ExportAbsolute        ExportFlag = 0x02
+	ExportWeak            ExportFlag = 0x04 // weak definition
+	ExportReexport        ExportFlag = 0x08 // defined by another dylib
+	ExportStubAndResolver ExportFlag = 0x10 // resolved at load time by a resolver function
+	ExportStaticResolver  ExportFlag = 0x20
+)
+
+var exportKindStrings = []intName{
+	{uint32(ExportRegular), "Regular"},
+	{uint32(ExportThreadLocal), "ThreadLocal"},
+	{uint32(ExportAbsolute), "Absolute"},
+}
+
+var exportFlagStrings = []intName{
+	{uint32(ExportWeak), "Weak"},
+	{uint32(ExportReexport), "Reexport"},
+	{uint32(ExportStubAndResolver), "StubAndResolver"},
+	{uint32(ExportStaticResolver), "StaticResolver"},
+}
+
+// Kind returns the kind of the symbol: ExportRegular, ExportThreadLocal
+// or ExportAbsolute.
+func (f ExportFlag) Kind() ExportFlag { return f & ExportKindMask }
+
+func (f ExportFlag) String() string {
+	s := []string{stringName(uint32(f.Kind()), exportKindStrings, false)}
+	for _, n := range exportFlagStrings {
+		if uint32(f)&n.i != 0 {
+			s = append(s, n.s)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// An Export is a symbol of the exports trie.
+type Export struct {
+	Name  string
+	Flags ExportFlag
+	// Address is the virtual address of the symbol, or its value if
+	// the symbol is absolute. It is 0 for re-exports.
+	Address uint64
+	// Resolver is the address of the resolver function of a stub and
+	// resolver symbol.
+	Resolver uint64
+
+	// Library is the ordinal of the dylib a re-exported symbol is
+	// defined by, Dylib its install name and ImportName its name in
+	// that dylib.
+	Library    int
+	Dylib      string
+	ImportName string
+}
+
+var errInvalidTrie = errors.New("invalid exports trie")
+
+// Dylib returns the dylib of the library ordinal, counting from 1 the
+// dynamic library commands of all kinds. It returns nil if the ordinal
+// is out of range.
+func (f *File) Dylib(ordinal int) *Dylib {
+	n := 0
+	for _, l := range f.Loads {
+		if d, ok := l.(*Dylib); ok {
+			n++
+			if n == ordinal {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// imageBase returns the virtual address of the Mach-O header, which
+// the addresses of the dyld info are relative to.
+func (f *File) imageBase() uint64 {
+	for _, l := range f.Loads {
+		if s, ok := l.(*Segment); ok && s.Offset == 0 && s.Filesz != 0 {
+			return s.Addr
+		}
+	}
+	return 0
+}
+
+// linkedit reads size bytes at offset off of the file, data of the
+// __LINKEDIT segment located by a load command.
+func (f *File) linkedit(off, size uint32) ([]byte, error) {
+	if f.originalReader == nil {
+		return nil, errors.New("macho: file reader is nil")
+	}
+	return saferio.ReadDataAt(f.originalReader, uint64(size), int64(off))
+}
+
+// Exports returns the symbols of the exports trie of the LC_DYLD_INFO
+// or LC_DYLD_EXPORTS_TRIE command, in the order of the trie. It returns
+// nil, nil if the file has no exports trie.
+func (f *File) Exports() ([]Export, error) {
+	var off, size uint32
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *DyldInfo:
+			off, size = l.ExportOff, l.ExportSize
+		case *LinkeditData:
+			if l.Cmd == LoadCmdDyldExportsTrie {
+				off, size = l.DataOff, l.DataSize
+			}
+		}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	trie, err := f.linkedit(off, size)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := parseExportsTrie(trie, f.imageBase())
+	if err != nil {
+		return nil, &FormatError{int64(off), err.Error(), nil}
+	}
+	for i := range exports {
+		e := &exports[i]
+		if e.Flags&ExportReexport == 0 {
+			continue
+		}
+		if d := f.Dylib(e.Library); d != nil {
+			e.Dylib = d.Name
+		}
+	}
+	return exports, nil
+}
+
+// parseExportsTrie walks the nodes of trie depth first. A node starts
+// with the size of its terminal information, the symbol ending at the
+// node if not 0, and lists its children by edge label and offset.
+func parseExportsTrie(trie []byte, base uint64) ([]Export, error) {
+	type node struct {
+		off    uint64
+		prefix string
+	}
+	var exports []Export
+	visited := make(map[uint64]bool)
+	stack := []node{{0, ""}}
+	for len(stack) != 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.off >= uint64(len(trie)) || visited[n.off] {
+			return nil, errInvalidTrie
+		}
+		visited[n.off] = true
+		r := &dyldReader{b: trie, off: int(n.off)}
+		terminalSize := r.uleb()
+		children := uint64(r.off) + terminalSize
+		if terminalSize != 0 {
+			e := Export{Name: n.prefix, Flags: ExportFlag(r.uleb())}
+			switch {
+			case e.Flags&ExportReexport != 0:
+				e.Library = int(r.uleb())
+				e.ImportName = r.cstring()
+				if e.ImportName == "" {
+					e.ImportName = e.Name
+				}
+			case e.Flags&ExportStubAndResolver != 0:
+				e.Address = base + r.uleb()
+				e.Resolver = base + r.uleb()
+			case e.Flags.Kind() == ExportAbsolute:
+				e.Address = r.uleb()
+			default:
+				e.Address = base + r.uleb()
+			}
+			if r.err != nil {
+				return nil, r.err
+			}
+			exports = append(exports, e)
+		}
+		if children >= uint64(len(trie)) {
+			return nil, errInvalidTrie
+		}
+		r.off = int(children)
+		count := int(r.byte())
+		// Push the children in reverse to visit them in order.
+		first := len(stack)
+		for i := 0; i < count; i++ {
+			label := r.cstring()
+			off := r.uleb()
+			stack = append(stack, node{off, n.prefix + label})
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		for i, j := first, len(stack)-1; i < j; i, j = i+1, j-1 {
+			stack[i], stack[j] = stack[j], stack[i]
+		}
+	}
+	return exports, nil
+}
+
+// dyldReader reads the LEB128 numbers and the strings of the dyld
+// info. It records the first error and then returns zeros.
+type dyldReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *dyldReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("unexpected end of dyld info")
+	}
+	r.off = len(r.b)
+}
+
+func (r *dyldReader) byte() byte {
+	if r.off >= len(r.b) {
+		r.fail()
+		return 0
+	}
+	c := r.b[r.off]
+	r.off++
+	return c
+}
+
+func (r *dyldReader) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (r *dyldReader) sleb() int64 {
+	var v int64
+	for shift := uint(0); ; shift += 7 {
+		c := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			if shift+7 < 64 && c&0x40 != 0 {
+				v |= -1 << (shift + 7)
+			}
+			return v
+		}
+	}
+}
+
+func (r *dyldReader) cstring() string {
+	for i := r.off; i < len(r.b); i++ {
+		if r.b[i] == 0 {
+			s := string(r.b[r.off:i])
+			r.off = i + 1
+			return s
+		}
+	}
+	r.fail()
+	return ""
+}
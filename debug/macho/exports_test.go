@@ -0,0 +1,161 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// A trieNode is a node of an exports trie to encode.
+type trieNode struct {
+	terminal []byte
+	edges    []trieEdge
+}
+
+type trieEdge struct {
+	label string
+	child *trieNode
+}
+
+// uleb appends the ULEB128 encoding of v to b.
+func uleb(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+// encode returns the trie of root. The child offsets are encoded on two
+// bytes, so that the node sizes do not depend on them.
+func (root *trieNode) encode() []byte {
+	var nodes []*trieNode
+	var walk func(n *trieNode)
+	walk = func(n *trieNode) {
+		nodes = append(nodes, n)
+		for _, e := range n.edges {
+			walk(e.child)
+		}
+	}
+	walk(root)
+	offsets := make(map[*trieNode]int)
+	off := 0
+	for _, n := range nodes {
+		offsets[n] = off
+		off += len(uleb(nil, uint64(len(n.terminal)))) + len(n.terminal) + 1
+		for _, e := range n.edges {
+			off += len(e.label) + 1 + 2
+		}
+	}
+	var b []byte
+	for _, n := range nodes {
+		b = uleb(b, uint64(len(n.terminal)))
+		b = append(b, n.terminal...)
+		b = append(b, byte(len(n.edges)))
+		for _, e := range n.edges {
+			o := offsets[e.child]
+			b = append(b, e.label...)
+			b = append(b, 0, byte(o&0x7f|0x80), byte(o>>7))
+		}
+	}
+	return b
+}
+
+// terminal returns the terminal information of the flags and values.
+func terminal(flags ExportFlag, values ...uint64) *trieNode {
+	b := uleb(nil, uint64(flags))
+	for _, v := range values {
+		b = uleb(b, v)
+	}
+	return &trieNode{terminal: b}
+}
+
+func TestExports(t *testing.T) {
+	reexport := func(ordinal uint64, name string) *trieNode {
+		n := terminal(ExportReexport, ordinal)
+		n.terminal = append(append(n.terminal, name...), 0)
+		return n
+	}
+	root := &trieNode{edges: []trieEdge{
+		{"_", &trieNode{edges: []trieEdge{
+			{"foo", &trieNode{
+				terminal: terminal(ExportRegular, 0x1000).terminal,
+				edges:    []trieEdge{{"_weak", terminal(ExportWeak, 0x1010)}},
+			}},
+			{"tlv", terminal(ExportThreadLocal, 0x2000)},
+			{"abs", terminal(ExportAbsolute, 0x42)},
+			{"ifunc", terminal(ExportStubAndResolver, 0x3000, 0x3100)},
+			{"memcpy", reexport(2, "_platform_memmove")},
+			{"strlen", reexport(1, "")},
+		}}},
+	}}
+	trie := root.encode()
+
+	const base = 0x100000000
+	text := command(LoadCmdSegment64, Segment64{Addr: base, Memsz: 0x4000, Filesz: 0x4000}, nil)
+	copy(text[8:], "__TEXT")
+	libSystem := command(LoadCmdDylib, DylibCmd{Name: 24}, []byte("/usr/lib/libSystem.B.dylib\x00"))
+	platform := command(LoadCmdLoadWeakDylib, DylibCmd{Name: 24}, []byte("/usr/lib/system/libsystem_platform.dylib\x00"))
+	size := 32 + len(text) + len(libSystem) + len(platform) + 16
+	exportsTrie := command(LoadCmdDyldExportsTrie, LinkeditDataCmd{DataOff: uint32(size), DataSize: uint32(len(trie))}, nil)
+	dat := buildImage(TypeDylib, trie, text, libSystem, platform, exportsTrie)
+
+	f, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exports, err := f.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Export{
+		{Name: "_foo", Flags: ExportRegular, Address: base + 0x1000},
+		{Name: "_foo_weak", Flags: ExportWeak, Address: base + 0x1010},
+		{Name: "_tlv", Flags: ExportThreadLocal, Address: base + 0x2000},
+		{Name: "_abs", Flags: ExportAbsolute, Address: 0x42},
+		{Name: "_ifunc", Flags: ExportStubAndResolver, Address: base + 0x3000, Resolver: base + 0x3100},
+		{Name: "_memcpy", Flags: ExportReexport, Library: 2, Dylib: "/usr/lib/system/libsystem_platform.dylib", ImportName: "_platform_memmove"},
+		{Name: "_strlen", Flags: ExportReexport, Library: 1, Dylib: "/usr/lib/libSystem.B.dylib", ImportName: "_strlen"},
+	}
+	if !reflect.DeepEqual(exports, want) {
+		t.Errorf("Exports:\n got %+v\nwant %+v", exports, want)
+	}
+	if s := (ExportThreadLocal | ExportWeak).String(); s != "ThreadLocal|Weak" {
+		t.Errorf("String = %q, want ThreadLocal|Weak", s)
+	}
+
+	// A child pointing back to the root.
+	loop := []byte{0, 1, 'a', 0, 0}
+	if _, err := parseExportsTrie(loop, 0); err == nil {
+		t.Error("parseExportsTrie of a loop succeeded")
+	}
+	if _, err := parseExportsTrie(trie[:len(trie)-3], 0); err == nil {
+		t.Error("parseExportsTrie of a truncated trie succeeded")
+	}
+}
+
+func TestExportsDyldInfo(t *testing.T) {
+	f := openBase64(t, "testdata/clang-amd64-darwin-exec-with-rpath.base64")
+	exports, err := f.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Export{
+		{Name: "__mh_execute_header", Address: 0x100000000},
+		{Name: "_main", Address: 0x100000f60},
+	}
+	if !reflect.DeepEqual(exports, want) {
+		t.Errorf("Exports = %+v, want %+v", exports, want)
+	}
+
+	f = openBase64(t, "testdata/gcc-amd64-darwin-exec.base64")
+	if exports, err := f.Exports(); exports != nil || err != nil {
+		t.Errorf("Exports without a trie = %v, %v", exports, err)
+	}
+}
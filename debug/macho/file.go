@@ -142,15 +142,49 @@ func (s *Section) Data() ([]byte, error) {
 // Open returns a new ReadSeeker reading the Mach-O section.
 func (s *Section) Open() io.ReadSeeker { return io.NewSectionReader(s.sr, 0, 1<<63-1) }
 
-// A Dylib represents a Mach-O load dynamic library command.
+// A Dylib represents a Mach-O load dynamic library command, of any
+// kind. The dylibs are numbered from 1 in the order of their commands
+// by the library ordinals of the two-level namespace.
 type Dylib struct {
 	LoadBytes
+	Kind           DylibKind
 	Name           string
 	Time           uint32
 	CurrentVersion uint32
 	CompatVersion  uint32
 }
 
+// A DylibKind is the kind of a dynamic library command.
+type DylibKind int
+
+const (
+	DylibLoad     DylibKind = iota // required, LC_LOAD_DYLIB
+	DylibWeak                      // optional, the image loads without it
+	DylibReexport                  // its exports are exported by the image
+	DylibLazy                      // loaded on first use
+	DylibUpward                    // loaded by a library it depends on
+)
+
+var dylibKindStrings = []intName{
+	{uint32(DylibLoad), "DylibLoad"},
+	{uint32(DylibWeak), "DylibWeak"},
+	{uint32(DylibReexport), "DylibReexport"},
+	{uint32(DylibLazy), "DylibLazy"},
+	{uint32(DylibUpward), "DylibUpward"},
+}
+
+func (k DylibKind) String() string   { return stringName(uint32(k), dylibKindStrings, false) }
+func (k DylibKind) GoString() string { return stringName(uint32(k), dylibKindStrings, true) }
+
+// dylibKinds maps the dynamic library commands to their kind.
+var dylibKinds = map[LoadCmd]DylibKind{
+	LoadCmdDylib:           DylibLoad,
+	LoadCmdLoadWeakDylib:   DylibWeak,
+	LoadCmdReexportDylib:   DylibReexport,
+	LoadCmdLazyLoadDylib:   DylibLazy,
+	LoadCmdLoadUpwardDylib: DylibUpward,
+}
+
 // A Symtab represents a Mach-O symbol table command.
 type Symtab struct {
 	LoadBytes
@@ -289,7 +323,7 @@ func NewFile(r io.ReaderAt) (*File, error) {
 		var s *Segment
 		switch cmd {
 		default:
-			f.Loads = append(f.Loads, LoadBytes(cmddat))
+			f.Loads = append(f.Loads, parseLoad(cmd, cmddat, bo))
 
 		case LoadCmdRpath:
 			var hdr RpathCmd
@@ -305,13 +339,13 @@ func NewFile(r io.ReaderAt) (*File, error) {
 			l.LoadBytes = LoadBytes(cmddat)
 			f.Loads = append(f.Loads, l)
 
-		case LoadCmdDylib:
+		case LoadCmdDylib, LoadCmdLoadWeakDylib, LoadCmdReexportDylib, LoadCmdLazyLoadDylib, LoadCmdLoadUpwardDylib:
 			var hdr DylibCmd
 			b := bytes.NewReader(cmddat)
 			if err := binary.Read(b, bo, &hdr); err != nil {
 				return nil, err
 			}
-			l := new(Dylib)
+			l := &Dylib{Kind: dylibKinds[cmd]}
 			if hdr.Name >= uint32(len(cmddat)) {
 				return nil, &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
 			}
@@ -726,7 +760,8 @@ func (f *File) ImportedSymbols() ([]string, error) {
 
 // ImportedLibraries returns the paths of all libraries
 // referred to by the binary f that are expected to be
-// linked with the binary at dynamic link time.
+// linked with the binary at dynamic link time, including
+// the weak ones, which may be missing.
 func (f *File) ImportedLibraries() ([]string, error) {
 	var all []string
 	for _, l := range f.Loads {
@@ -0,0 +1,299 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// A UUID represents a Mach-O uuid command, the identifier matching an
+// image with its dSYM.
+type UUID struct {
+	LoadBytes
+	ID [16]byte
+}
+
+// String returns the UUID in the canonical upper case form of dwarfdump.
+func (u *UUID) String() string {
+	b := u.ID
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// A BuildTool is a tool that built a Mach-O file.
+type BuildTool struct {
+	Tool    Tool
+	Version Version
+}
+
+// A BuildVersion represents a Mach-O build version command.
+type BuildVersion struct {
+	LoadBytes
+	Platform Platform
+	MinOS    Version
+	SDK      Version
+	Tools    []BuildTool
+}
+
+// A VersionMin represents a Mach-O minimum OS version command, which
+// predates the build version command. Cmd tells the platform.
+type VersionMin struct {
+	LoadBytes
+	Cmd     LoadCmd
+	Version Version
+	SDK     Version
+}
+
+// Platform returns the platform of the command.
+func (v *VersionMin) Platform() Platform {
+	switch v.Cmd {
+	case LoadCmdVersionMinMacOSX:
+		return PlatformMacOS
+	case LoadCmdVersionMinIPhoneOS:
+		return PlatformIOS
+	case LoadCmdVersionMinTvOS:
+		return PlatformTvOS
+	case LoadCmdVersionMinWatchOS:
+		return PlatformWatchOS
+	}
+	return 0
+}
+
+// An EntryPoint represents a Mach-O main command.
+type EntryPoint struct {
+	LoadBytes
+	EntryOff  uint64 // file offset of main()
+	StackSize uint64
+}
+
+// A Dylinker represents a Mach-O load or id dylinker command.
+type Dylinker struct {
+	LoadBytes
+	Cmd  LoadCmd
+	Name string
+}
+
+// A DylibID represents a Mach-O id dylib command, the install name of
+// a dynamic library.
+type DylibID struct {
+	LoadBytes
+	Name           string
+	Time           uint32
+	CurrentVersion uint32
+	CompatVersion  uint32
+}
+
+// A SourceVersion represents a Mach-O source version command.
+type SourceVersion struct {
+	LoadBytes
+	Version uint64
+}
+
+// String returns the version as A.B.C.D.E, without the trailing zero
+// components.
+func (s *SourceVersion) String() string {
+	v := s.Version
+	parts := []uint64{v >> 40, v >> 30 & 0x3ff, v >> 20 & 0x3ff, v >> 10 & 0x3ff, v & 0x3ff}
+	n := len(parts)
+	for n > 1 && parts[n-1] == 0 {
+		n--
+	}
+	str := make([]string, n)
+	for i := range str {
+		str[i] = fmt.Sprint(parts[i])
+	}
+	return strings.Join(str, ".")
+}
+
+// An EncryptionInfo represents a Mach-O 32-bit or 64-bit encryption
+// info command. CryptID is 0 if the range is not encrypted.
+type EncryptionInfo struct {
+	LoadBytes
+	Cmd       LoadCmd
+	CryptOff  uint32
+	CryptSize uint32
+	CryptID   uint32
+}
+
+// A LinkerOption represents a Mach-O linker option command, such as
+// the -framework options of auto-linking.
+type LinkerOption struct {
+	LoadBytes
+	Options []string
+}
+
+// A DyldInfo represents a Mach-O dyld info or dyld info only command.
+type DyldInfo struct {
+	LoadBytes
+	DyldInfoCmd
+}
+
+// A LinkeditData represents a Mach-O command locating data of the
+// __LINKEDIT segment. Cmd tells which data.
+type LinkeditData struct {
+	LoadBytes
+	LinkeditDataCmd
+}
+
+// parseLoad decodes the load commands beyond the segments, the symbol
+// tables and the dylibs. Unknown commands, and commands too short for
+// their fixed fields or with fields out of range, are returned as
+// LoadBytes.
+func parseLoad(cmd LoadCmd, cmddat []byte, bo binary.ByteOrder) Load {
+	b := bytes.NewReader(cmddat)
+	read := func(data interface{}) bool {
+		return binary.Read(b, bo, data) == nil
+	}
+	// name reads the lc_str at off of the command.
+	name := func(off uint32) (string, bool) {
+		if off >= uint32(len(cmddat)) {
+			return "", false
+		}
+		return cstring(cmddat[off:]), true
+	}
+	switch cmd {
+	case LoadCmdUUID:
+		var hdr UUIDCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		return &UUID{LoadBytes: cmddat, ID: hdr.UUID}
+
+	case LoadCmdBuildVersion:
+		var hdr BuildVersionCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		if uint64(hdr.Ntools)*8 > uint64(b.Len()) {
+			return LoadBytes(cmddat)
+		}
+		l := &BuildVersion{LoadBytes: cmddat, Platform: hdr.Platform, MinOS: hdr.Minos, SDK: hdr.Sdk}
+		for i := uint32(0); i < hdr.Ntools; i++ {
+			var t BuildToolVersion
+			if !read(&t) {
+				return LoadBytes(cmddat)
+			}
+			l.Tools = append(l.Tools, BuildTool{Tool: t.Tool, Version: t.Version})
+		}
+		return l
+
+	case LoadCmdVersionMinMacOSX, LoadCmdVersionMinIPhoneOS, LoadCmdVersionMinTvOS, LoadCmdVersionMinWatchOS:
+		var hdr VersionMinCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		return &VersionMin{LoadBytes: cmddat, Cmd: cmd, Version: hdr.Version, SDK: hdr.Sdk}
+
+	case LoadCmdMain:
+		var hdr EntryPointCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		return &EntryPoint{LoadBytes: cmddat, EntryOff: hdr.EntryOff, StackSize: hdr.StackSize}
+
+	case LoadCmdLoadDylinker, LoadCmdDylinker:
+		var hdr DylinkerCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		s, ok := name(hdr.Name)
+		if !ok {
+			return LoadBytes(cmddat)
+		}
+		return &Dylinker{LoadBytes: cmddat, Cmd: cmd, Name: s}
+
+	case LoadCmdIDDylib:
+		var hdr DylibCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		s, ok := name(hdr.Name)
+		if !ok {
+			return LoadBytes(cmddat)
+		}
+		return &DylibID{
+			LoadBytes:      cmddat,
+			Name:           s,
+			Time:           hdr.Time,
+			CurrentVersion: hdr.CurrentVersion,
+			CompatVersion:  hdr.CompatVersion,
+		}
+
+	case LoadCmdSourceVersion:
+		var hdr SourceVersionCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		return &SourceVersion{LoadBytes: cmddat, Version: hdr.Version}
+
+	case LoadCmdEncryptionInfo, LoadCmdEncryptionInfo64:
+		// The 64-bit command only adds padding.
+		var hdr EncryptionInfoCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		return &EncryptionInfo{
+			LoadBytes: cmddat,
+			Cmd:       cmd,
+			CryptOff:  hdr.Cryptoff,
+			CryptSize: hdr.Cryptsize,
+			CryptID:   hdr.Cryptid,
+		}
+
+	case LoadCmdLinkerOption:
+		var hdr LinkerOptionCmd
+		if !read(&hdr) {
+			return LoadBytes(cmddat)
+		}
+		l := &LinkerOption{LoadBytes: cmddat}
+		rest := cmddat[binary.Size(hdr):]
+		for i := uint32(0); i < hdr.Count; i++ {
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return LoadBytes(cmddat)
+			}
+			l.Options = append(l.Options, string(rest[:end]))
+			rest = rest[end+1:]
+		}
+		return l
+
+	case LoadCmdDyldInfo, LoadCmdDyldInfoOnly:
+		l := &DyldInfo{LoadBytes: cmddat}
+		if !read(&l.DyldInfoCmd) {
+			return LoadBytes(cmddat)
+		}
+		return l
+
+	case LoadCmdDyldExportsTrie, LoadCmdDyldChainedFixups:
+		l := &LinkeditData{LoadBytes: cmddat}
+		if !read(&l.LinkeditDataCmd) {
+			return LoadBytes(cmddat)
+		}
+		return l
+	}
+	return LoadBytes(cmddat)
+}
+
+// MinOS returns the platform and the minimum OS version of the file,
+// from its build version or minimum version command.
+func (f *File) MinOS() (Platform, Version, bool) {
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *BuildVersion:
+			return l.Platform, l.MinOS, true
+		case *VersionMin:
+			return l.Platform(), l.Version, true
+		}
+	}
+	return 0, 0, false
+}
+
+// UUID returns the uuid command of the file, nil if it has none.
+func (f *File) UUID() *UUID {
+	for _, l := range f.Loads {
+		if u, ok := l.(*UUID); ok {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func openBase64(t *testing.T, name string) *File {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestLoads(t *testing.T) {
+	f := openBase64(t, "testdata/clang-amd64-darwin-exec-with-rpath.base64")
+	if u := f.UUID(); u == nil || u.String() != "7F2C2EFA-311A-3BD2-8C49-A9C95D4DFA49" {
+		t.Errorf("UUID = %v", u)
+	}
+	platform, minos, ok := f.MinOS()
+	if !ok || platform != PlatformMacOS || minos.String() != "10.12" {
+		t.Errorf("MinOS = %v, %v, %v; want macOS, 10.12, true", platform, minos, ok)
+	}
+	var found int
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *Dylinker:
+			found++
+			if l.Cmd != LoadCmdLoadDylinker || l.Name != "/usr/lib/dyld" {
+				t.Errorf("Dylinker = %v %q", l.Cmd, l.Name)
+			}
+		case *EntryPoint:
+			found++
+			if l.EntryOff == 0 {
+				t.Error("EntryPoint.EntryOff = 0")
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %d of the dylinker and main commands, want 2", found)
+	}
+}
+
+// command returns a little-endian load command of the header v followed
+// by tail, padded to 8 bytes.
+func command(cmd LoadCmd, v interface{}, tail []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	buf.Write(tail)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[0:], uint32(cmd))
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	return b
+}
+
+// buildImage returns a little-endian 64-bit image of the load commands
+// cmds, followed by data.
+func buildImage(typ Type, data []byte, cmds ...[]byte) []byte {
+	var buf bytes.Buffer
+	var size int
+	for _, c := range cmds {
+		size += len(c)
+	}
+	binary.Write(&buf, binary.LittleEndian, FileHeader{
+		Magic:  Magic64,
+		Cpu:    CpuAmd64,
+		SubCpu: 3,
+		Type:   typ,
+		Ncmd:   uint32(len(cmds)),
+		Cmdsz:  uint32(size),
+		Flags:  FlagTwoLevel,
+	})
+	buf.Write(make([]byte, 4)) // reserved
+	for _, c := range cmds {
+		buf.Write(c)
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestDylibKinds(t *testing.T) {
+	dylib := func(cmd LoadCmd, name string) []byte {
+		return command(cmd, DylibCmd{Name: 24}, []byte(name+"\x00"))
+	}
+	dat := buildImage(TypeExec, nil,
+		dylib(LoadCmdDylib, "/usr/lib/libSystem.B.dylib"),
+		dylib(LoadCmdLoadWeakDylib, "/System/Library/Frameworks/Metal.framework/Metal"),
+		dylib(LoadCmdReexportDylib, "@rpath/libreexport.dylib"),
+		dylib(LoadCmdLazyLoadDylib, "@rpath/liblazy.dylib"),
+		dylib(LoadCmdLoadUpwardDylib, "@rpath/libupward.dylib"),
+	)
+	f, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/usr/lib/libSystem.B.dylib",
+		"/System/Library/Frameworks/Metal.framework/Metal",
+		"@rpath/libreexport.dylib",
+		"@rpath/liblazy.dylib",
+		"@rpath/libupward.dylib",
+	}
+	if !reflect.DeepEqual(libs, want) {
+		t.Errorf("ImportedLibraries = %q, want %q", libs, want)
+	}
+	kinds := []DylibKind{DylibLoad, DylibWeak, DylibReexport, DylibLazy, DylibUpward}
+	for i, l := range f.Loads {
+		if d, ok := l.(*Dylib); !ok || d.Kind != kinds[i] {
+			t.Errorf("load %d = %#v, want a dylib of kind %v", i, l, kinds[i])
+		}
+	}
+}
+
+func TestParseLoad(t *testing.T) {
+	bo := binary.LittleEndian
+	tests := []struct {
+		cmd  LoadCmd
+		dat  []byte
+		want Load
+	}{
+		{
+			LoadCmdBuildVersion,
+			command(LoadCmdBuildVersion, BuildVersionCmd{Platform: PlatformIOS, Minos: 0x0e0200, Sdk: 0x110000, Ntools: 1},
+				[]byte{3, 0, 0, 0, 0, 0x02, 0x03, 0x02}),
+			&BuildVersion{Platform: PlatformIOS, MinOS: 0x0e0200, SDK: 0x110000, Tools: []BuildTool{{ToolLD, 0x02030200}}},
+		},
+		{
+			LoadCmdIDDylib,
+			command(LoadCmdIDDylib, DylibCmd{Name: 24, CurrentVersion: 0x10000, CompatVersion: 0x10000}, []byte("@rpath/libfoo.dylib\x00")),
+			&DylibID{Name: "@rpath/libfoo.dylib", CurrentVersion: 0x10000, CompatVersion: 0x10000},
+		},
+		{
+			LoadCmdSourceVersion,
+			command(LoadCmdSourceVersion, SourceVersionCmd{Version: 1205<<40 | 1<<30 | 3<<20}, nil),
+			&SourceVersion{Version: 1205<<40 | 1<<30 | 3<<20},
+		},
+		{
+			LoadCmdEncryptionInfo64,
+			command(LoadCmdEncryptionInfo64, EncryptionInfo64Cmd{Cryptoff: 0x4000, Cryptsize: 0x8000, Cryptid: 1}, nil),
+			&EncryptionInfo{Cmd: LoadCmdEncryptionInfo64, CryptOff: 0x4000, CryptSize: 0x8000, CryptID: 1},
+		},
+		{
+			LoadCmdLinkerOption,
+			command(LoadCmdLinkerOption, LinkerOptionCmd{Count: 2}, []byte("-framework\x00Foundation\x00")),
+			&LinkerOption{Options: []string{"-framework", "Foundation"}},
+		},
+	}
+	for _, tt := range tests {
+		l := parseLoad(tt.cmd, tt.dat, bo)
+		// Compare without the raw bytes.
+		reflect.ValueOf(l).Elem().Field(0).SetBytes(nil)
+		if !reflect.DeepEqual(l, tt.want) {
+			t.Errorf("%v = %+v, want %+v", tt.cmd, l, tt.want)
+		}
+	}
+
+	if s := (&SourceVersion{Version: 1205<<40 | 1<<30 | 3<<20}).String(); s != "1205.1.3" {
+		t.Errorf("SourceVersion = %q, want 1205.1.3", s)
+	}
+	if s := Version(0x0e0201).String(); s != "14.2.1" {
+		t.Errorf("Version = %q, want 14.2.1", s)
+	}
+
+	// Truncated commands are kept opaque, as before they were decoded.
+	for _, cmd := range []LoadCmd{LoadCmdUUID, LoadCmdBuildVersion, LoadCmdLinkerOption, LoadCmdDyldInfoOnly} {
+		short := command(cmd, struct{}{}, []byte{1, 2})
+		l := parseLoad(cmd, short, bo)
+		if _, ok := l.(LoadBytes); !ok {
+			t.Errorf("%v: parseLoad of a truncated command = %T, want LoadBytes", cmd, l)
+		}
+	}
+
+	// So are the commands with fields out of range, and the file is
+	// still read.
+	bad := [][]byte{
+		command(LoadCmdBuildVersion, BuildVersionCmd{Ntools: 1000}, nil),
+		command(LoadCmdLinkerOption, LinkerOptionCmd{Count: 2}, []byte("-lfoo\x00-lbarr")),
+		command(LoadCmdLoadDylinker, DylinkerCmd{Name: 200}, nil),
+		command(LoadCmdIDDylib, DylibCmd{Name: 200}, nil),
+	}
+	f, err := NewFile(bytes.NewReader(buildImage(TypeDylib, nil, bad...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Loads) != len(bad) {
+		t.Fatalf("%d loads, want %d", len(f.Loads), len(bad))
+	}
+	for i, l := range f.Loads {
+		if _, ok := l.(LoadBytes); !ok {
+			t.Errorf("load %d of out of range fields = %T, want LoadBytes", i, l)
+		}
+	}
+}
@@ -95,6 +95,30 @@ const (
 	LoadCmdDylinker   LoadCmd = 0xf // id dylinker command (not load dylinker command)
 	LoadCmdSegment64  LoadCmd = 0x19
 	LoadCmdRpath      LoadCmd = 0x8000001c
+
+	LoadCmdIDDylib            LoadCmd = 0xd
+	LoadCmdLoadDylinker       LoadCmd = 0xe
+	LoadCmdUUID               LoadCmd = 0x1b
+	LoadCmdEncryptionInfo     LoadCmd = 0x21
+	LoadCmdVersionMinMacOSX   LoadCmd = 0x24
+	LoadCmdVersionMinIPhoneOS LoadCmd = 0x25
+	LoadCmdSourceVersion      LoadCmd = 0x2a
+	LoadCmdEncryptionInfo64   LoadCmd = 0x2c
+	LoadCmdLinkerOption       LoadCmd = 0x2d
+	LoadCmdVersionMinTvOS     LoadCmd = 0x2f
+	LoadCmdVersionMinWatchOS  LoadCmd = 0x30
+	LoadCmdBuildVersion       LoadCmd = 0x32
+	LoadCmdMain               LoadCmd = 0x80000028 // entry point command
+
+	LoadCmdLoadWeakDylib   LoadCmd = 0x80000018
+	LoadCmdReexportDylib   LoadCmd = 0x8000001f
+	LoadCmdLazyLoadDylib   LoadCmd = 0x20
+	LoadCmdLoadUpwardDylib LoadCmd = 0x80000023
+
+	LoadCmdDyldInfo          LoadCmd = 0x22
+	LoadCmdDyldInfoOnly      LoadCmd = 0x80000022
+	LoadCmdDyldExportsTrie   LoadCmd = 0x80000033
+	LoadCmdDyldChainedFixups LoadCmd = 0x80000034
 )
 
 var cmdStrings = []intName{
@@ -104,11 +128,105 @@ var cmdStrings = []intName{
 	{uint32(LoadCmdDylib), "LoadCmdDylib"},
 	{uint32(LoadCmdSegment64), "LoadCmdSegment64"},
 	{uint32(LoadCmdRpath), "LoadCmdRpath"},
+	{uint32(LoadCmdSymtab), "LoadCmdSymtab"},
+	{uint32(LoadCmdDysymtab), "LoadCmdDysymtab"},
+	{uint32(LoadCmdDylinker), "LoadCmdDylinker"},
+	{uint32(LoadCmdIDDylib), "LoadCmdIDDylib"},
+	{uint32(LoadCmdLoadDylinker), "LoadCmdLoadDylinker"},
+	{uint32(LoadCmdUUID), "LoadCmdUUID"},
+	{uint32(LoadCmdEncryptionInfo), "LoadCmdEncryptionInfo"},
+	{uint32(LoadCmdVersionMinMacOSX), "LoadCmdVersionMinMacOSX"},
+	{uint32(LoadCmdVersionMinIPhoneOS), "LoadCmdVersionMinIPhoneOS"},
+	{uint32(LoadCmdSourceVersion), "LoadCmdSourceVersion"},
+	{uint32(LoadCmdEncryptionInfo64), "LoadCmdEncryptionInfo64"},
+	{uint32(LoadCmdLinkerOption), "LoadCmdLinkerOption"},
+	{uint32(LoadCmdVersionMinTvOS), "LoadCmdVersionMinTvOS"},
+	{uint32(LoadCmdVersionMinWatchOS), "LoadCmdVersionMinWatchOS"},
+	{uint32(LoadCmdBuildVersion), "LoadCmdBuildVersion"},
+	{uint32(LoadCmdMain), "LoadCmdMain"},
+	{uint32(LoadCmdLoadWeakDylib), "LoadCmdLoadWeakDylib"},
+	{uint32(LoadCmdReexportDylib), "LoadCmdReexportDylib"},
+	{uint32(LoadCmdLazyLoadDylib), "LoadCmdLazyLoadDylib"},
+	{uint32(LoadCmdLoadUpwardDylib), "LoadCmdLoadUpwardDylib"},
+	{uint32(LoadCmdDyldInfo), "LoadCmdDyldInfo"},
+	{uint32(LoadCmdDyldInfoOnly), "LoadCmdDyldInfoOnly"},
+	{uint32(LoadCmdDyldExportsTrie), "LoadCmdDyldExportsTrie"},
+	{uint32(LoadCmdDyldChainedFixups), "LoadCmdDyldChainedFixups"},
 }
 
 func (i LoadCmd) String() string   { return stringName(uint32(i), cmdStrings, false) }
 func (i LoadCmd) GoString() string { return stringName(uint32(i), cmdStrings, true) }
 
+// A Platform is the target platform of a Mach-O build version command.
+type Platform uint32
+
+const (
+	PlatformMacOS             Platform = 1
+	PlatformIOS               Platform = 2
+	PlatformTvOS              Platform = 3
+	PlatformWatchOS           Platform = 4
+	PlatformBridgeOS          Platform = 5
+	PlatformMacCatalyst       Platform = 6
+	PlatformIOSSimulator      Platform = 7
+	PlatformTvOSSimulator     Platform = 8
+	PlatformWatchOSSimulator  Platform = 9
+	PlatformDriverKit         Platform = 10
+	PlatformVisionOS          Platform = 11
+	PlatformVisionOSSimulator Platform = 12
+)
+
+var platformStrings = []intName{
+	{uint32(PlatformMacOS), "macOS"},
+	{uint32(PlatformIOS), "iOS"},
+	{uint32(PlatformTvOS), "tvOS"},
+	{uint32(PlatformWatchOS), "watchOS"},
+	{uint32(PlatformBridgeOS), "bridgeOS"},
+	{uint32(PlatformMacCatalyst), "Mac Catalyst"},
+	{uint32(PlatformIOSSimulator), "iOS Simulator"},
+	{uint32(PlatformTvOSSimulator), "tvOS Simulator"},
+	{uint32(PlatformWatchOSSimulator), "watchOS Simulator"},
+	{uint32(PlatformDriverKit), "DriverKit"},
+	{uint32(PlatformVisionOS), "visionOS"},
+	{uint32(PlatformVisionOSSimulator), "visionOS Simulator"},
+}
+
+func (i Platform) String() string { return stringName(uint32(i), platformStrings, false) }
+
+// A Tool is a tool of a Mach-O build version command.
+type Tool uint32
+
+const (
+	ToolClang Tool = 1
+	ToolSwift Tool = 2
+	ToolLD    Tool = 3
+	ToolLLD   Tool = 4
+)
+
+var toolStrings = []intName{
+	{uint32(ToolClang), "clang"},
+	{uint32(ToolSwift), "swift"},
+	{uint32(ToolLD), "ld"},
+	{uint32(ToolLLD), "lld"},
+}
+
+func (i Tool) String() string { return stringName(uint32(i), toolStrings, false) }
+
+// A Version is an X.Y.Z version of a Mach-O load command, encoded as
+// a 16-bit X, an 8-bit Y and an 8-bit Z.
+type Version uint32
+
+func (v Version) Major() int { return int(v >> 16) }
+func (v Version) Minor() int { return int(v >> 8 & 0xff) }
+func (v Version) Patch() int { return int(v & 0xff) }
+
+func (v Version) String() string {
+	s := strconv.Itoa(v.Major()) + "." + strconv.Itoa(v.Minor())
+	if v.Patch() != 0 {
+		s += "." + strconv.Itoa(v.Patch())
+	}
+	return s
+}
+
 type (
 	// A Segment32 is a 32-bit Mach-O segment load command.
 	Segment32 struct {
@@ -191,6 +309,113 @@ type (
 		Path uint32
 	}
 
+	// A DylinkerCmd is a Mach-O load or id dylinker command.
+	DylinkerCmd struct {
+		Cmd  LoadCmd
+		Len  uint32
+		Name uint32
+	}
+
+	// A UUIDCmd is a Mach-O uuid command.
+	UUIDCmd struct {
+		Cmd  LoadCmd
+		Len  uint32
+		UUID [16]byte
+	}
+
+	// A VersionMinCmd is a Mach-O minimum OS version command.
+	VersionMinCmd struct {
+		Cmd     LoadCmd
+		Len     uint32
+		Version Version
+		Sdk     Version
+	}
+
+	// A BuildVersionCmd is a Mach-O build version command. It is
+	// followed by Ntools BuildToolVersion entries.
+	BuildVersionCmd struct {
+		Cmd      LoadCmd
+		Len      uint32
+		Platform Platform
+		Minos    Version
+		Sdk      Version
+		Ntools   uint32
+	}
+
+	// A BuildToolVersion is a tool entry of a Mach-O build version command.
+	BuildToolVersion struct {
+		Tool    Tool
+		Version Version
+	}
+
+	// An EntryPointCmd is a Mach-O main command.
+	EntryPointCmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		EntryOff  uint64 // file offset of main()
+		StackSize uint64
+	}
+
+	// A SourceVersionCmd is a Mach-O source version command.
+	SourceVersionCmd struct {
+		Cmd     LoadCmd
+		Len     uint32
+		Version uint64 // A.B.C.D.E packed as a24.b10.c10.d10.e10
+	}
+
+	// An EncryptionInfoCmd is a Mach-O 32-bit encryption info command.
+	EncryptionInfoCmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		Cryptoff  uint32
+		Cryptsize uint32
+		Cryptid   uint32
+	}
+
+	// An EncryptionInfo64Cmd is a Mach-O 64-bit encryption info command.
+	EncryptionInfo64Cmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		Cryptoff  uint32
+		Cryptsize uint32
+		Cryptid   uint32
+		Pad       uint32
+	}
+
+	// A LinkerOptionCmd is a Mach-O linker option command. It is
+	// followed by Count NUL terminated strings.
+	LinkerOptionCmd struct {
+		Cmd   LoadCmd
+		Len   uint32
+		Count uint32
+	}
+
+	// A DyldInfoCmd is a Mach-O dyld info command, locating the
+	// rebase, bind and export data of the __LINKEDIT segment.
+	DyldInfoCmd struct {
+		Cmd          LoadCmd
+		Len          uint32
+		RebaseOff    uint32
+		RebaseSize   uint32
+		BindOff      uint32
+		BindSize     uint32
+		WeakBindOff  uint32
+		WeakBindSize uint32
+		LazyBindOff  uint32
+		LazyBindSize uint32
+		ExportOff    uint32
+		ExportSize   uint32
+	}
+
+	// A LinkeditDataCmd is a Mach-O command locating data of the
+	// __LINKEDIT segment, such as the exports trie.
+	LinkeditDataCmd struct {
+		Cmd      LoadCmd
+		Len      uint32
+		DataOff  uint32
+		DataSize uint32
+	}
+
 	// A Thread is a Mach-O thread state command.
 	Thread struct {
 		Cmd  LoadCmd
@@ -0,0 +1,297 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// APISetHost is a host DLL of an API set contract. Importer is the
+// module the host applies to, empty for the default host.
+type APISetHost struct {
+	Importer string
+	Host     string
+}
+
+// APISetEntry is an API set contract, such as
+// api-ms-win-core-file-l1-2-4, and the DLLs implementing it. The first
+// host is the default one; a contract without hosts is not implemented
+// on the system.
+type APISetEntry struct {
+	Name  string // lower case, without the .dll extension nor, before version 6, the api- prefix
+	Hosts []APISetHost
+}
+
+// APISetSchema is the API set namespace of apisetschema.dll.
+type APISetSchema struct {
+	Version uint32
+	Entries []APISetEntry // sorted by name
+}
+
+// IsAPISetName reports whether the DLL name is an API set contract
+// rather than a file.
+func IsAPISetName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "api-") || strings.HasPrefix(name, "ext-")
+}
+
+// Resolve returns the host DLL the loader maps the API set contract
+// name to, when it is imported by importer. Like the loader, it ignores
+// the last version number of the contract if there is no exact match.
+// It reports false if name is not an API set or the contract has no
+// host.
+func (s *APISetSchema) Resolve(name, importer string) (string, bool) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".dll")
+	if !IsAPISetName(name) {
+		return "", false
+	}
+	if s.Version < 6 {
+		// The loader strips the prefix before looking the name up.
+		name = name[len("api-"):]
+	}
+	e := s.lookup(name)
+	if e == nil || len(e.Hosts) == 0 {
+		return "", false
+	}
+	host := e.Hosts[0].Host
+	for _, h := range e.Hosts[1:] {
+		if strings.EqualFold(h.Importer, importer) {
+			host = h.Host
+			break
+		}
+	}
+	return host, host != ""
+}
+
+// lookup finds the entry of name, first exactly and then ignoring the
+// last version number.
+func (s *APISetSchema) lookup(name string) *APISetEntry {
+	i := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].Name >= name })
+	if i < len(s.Entries) && s.Entries[i].Name == name {
+		return &s.Entries[i]
+	}
+	j := strings.LastIndexByte(name, '-')
+	if j < 0 {
+		return nil
+	}
+	prefix := name[:j+1]
+	i = sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].Name >= prefix })
+	// Schemas hold a single version of each contract, the loader hashes
+	// the names up to the last hyphen.
+	for ; i < len(s.Entries) && strings.HasPrefix(s.Entries[i].Name, prefix); i++ {
+		if !strings.ContainsRune(s.Entries[i].Name[len(prefix):], '-') {
+			return &s.Entries[i]
+		}
+	}
+	return nil
+}
+
+// LookupAPISetSchema decodes the API set schema held in the .apiset
+// section of apisetschema.dll. It returns nil and no error if the image
+// has no such section.
+func (f *File) LookupAPISetSchema() (*APISetSchema, error) {
+	s := f.Section(".apiset")
+	if s == nil {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read .apiset section: %v", err)
+	}
+	return ParseAPISetSchema(data)
+}
+
+// ParseAPISetSchema decodes an API set namespace, as found in the
+// .apiset section of apisetschema.dll. It supports the versions 2
+// (Windows 7 and 8), 4 (Windows 8.1) and 6 (Windows 10 and later).
+func ParseAPISetSchema(data []byte) (*APISetSchema, error) {
+	if len(data) < 4 {
+		return nil, errors.New("API set schema too small")
+	}
+	r := apisetReader(data)
+	s := &APISetSchema{Version: binary.LittleEndian.Uint32(data)}
+	var err error
+	switch s.Version {
+	case 2:
+		err = r.parseV2(s)
+	case 4:
+		err = r.parseV4(s)
+	case 6:
+		err = r.parseV6(s)
+	default:
+		return nil, fmt.Errorf("unsupported API set schema version %d", s.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(s.Entries, func(i, j int) bool { return s.Entries[i].Name < s.Entries[j].Name })
+	return s, nil
+}
+
+// apisetReader reads the structures of an API set namespace, which are
+// addressed by offset from its start.
+type apisetReader []byte
+
+func (r apisetReader) u32(off uint32) (uint32, error) {
+	if uint64(off)+4 > uint64(len(r)) {
+		return 0, fmt.Errorf("API set schema offset %#x out of range", off)
+	}
+	return binary.LittleEndian.Uint32(r[off:]), nil
+}
+
+// fields reads n consecutive dwords at off.
+func (r apisetReader) fields(off uint32, n int) ([]uint32, error) {
+	if uint64(off)+4*uint64(n) > uint64(len(r)) {
+		return nil, fmt.Errorf("API set schema offset %#x out of range", off)
+	}
+	v := make([]uint32, n)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(r[off+4*uint32(i):])
+	}
+	return v, nil
+}
+
+// str reads the UTF-16 string of size bytes at off.
+func (r apisetReader) str(off, size uint32) (string, error) {
+	if uint64(off)+uint64(size) > uint64(len(r)) {
+		return "", fmt.Errorf("API set schema string %#x out of range", off)
+	}
+	u := make([]uint16, size/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(r[off+2*uint32(i):])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// maxAPISetEntries bounds the counts of malformed schemas.
+const maxAPISetEntries = 1 << 16
+
+// values reads count value entries of stride bytes at off, each holding
+// the importer name offset and length at field nameField, followed by
+// the host offset and length.
+func (r apisetReader) values(off, count, stride uint32, nameField int) ([]APISetHost, error) {
+	if count > maxAPISetEntries {
+		return nil, fmt.Errorf("API set schema value count %d too large", count)
+	}
+	var hosts []APISetHost
+	for i := uint32(0); i < count; i++ {
+		v, err := r.fields(off+i*stride, nameField+4)
+		if err != nil {
+			return nil, err
+		}
+		var h APISetHost
+		if h.Importer, err = r.str(v[nameField], v[nameField+1]); err != nil {
+			return nil, err
+		}
+		if h.Host, err = r.str(v[nameField+2], v[nameField+3]); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// parseV6 decodes an API_SET_NAMESPACE: Version, Size, Flags, Count,
+// EntryOffset, HashOffset and HashFactor, with 24 byte entries of
+// Flags, NameOffset, NameLength, HashedLength, ValueOffset and
+// ValueCount, and 20 byte values of Flags, NameOffset, NameLength,
+// ValueOffset and ValueLength.
+func (r apisetReader) parseV6(s *APISetSchema) error {
+	h, err := r.fields(0, 7)
+	if err != nil {
+		return err
+	}
+	count, entryOffset := h[3], h[4]
+	if count > maxAPISetEntries {
+		return fmt.Errorf("API set schema entry count %d too large", count)
+	}
+	for i := uint32(0); i < count; i++ {
+		v, err := r.fields(entryOffset+i*24, 6)
+		if err != nil {
+			return err
+		}
+		e := APISetEntry{}
+		if e.Name, err = r.str(v[1], v[2]); err != nil {
+			return err
+		}
+		if e.Hosts, err = r.values(v[4], v[5], 20, 1); err != nil {
+			return err
+		}
+		e.Name = strings.TrimSuffix(strings.ToLower(e.Name), ".dll")
+		s.Entries = append(s.Entries, e)
+	}
+	return nil
+}
+
+// parseV4 decodes an API_SET_NAMESPACE_ARRAY_V4: Version, Size, Flags
+// and Count, followed by 24 byte entries of Flags, NameOffset,
+// NameLength, AliasOffset, AliasLength and DataOffset. The data is a
+// value array of Flags and Count, followed by 20 byte values laid out
+// as in version 6. Names lack the "api-" prefix.
+func (r apisetReader) parseV4(s *APISetSchema) error {
+	count, err := r.u32(12)
+	if err != nil {
+		return err
+	}
+	if count > maxAPISetEntries {
+		return fmt.Errorf("API set schema entry count %d too large", count)
+	}
+	for i := uint32(0); i < count; i++ {
+		v, err := r.fields(16+i*24, 6)
+		if err != nil {
+			return err
+		}
+		e := APISetEntry{}
+		if e.Name, err = r.str(v[1], v[2]); err != nil {
+			return err
+		}
+		n, err := r.u32(v[5] + 4)
+		if err != nil {
+			return err
+		}
+		if e.Hosts, err = r.values(v[5]+8, n, 20, 1); err != nil {
+			return err
+		}
+		e.Name = strings.TrimSuffix(strings.ToLower(e.Name), ".dll")
+		s.Entries = append(s.Entries, e)
+	}
+	return nil
+}
+
+// parseV2 decodes an API_SET_NAMESPACE_ARRAY_V2: Version and Count,
+// followed by 12 byte entries of NameOffset, NameLength and DataOffset.
+// The data is a value array of Count, followed by 16 byte values of
+// NameOffset, NameLength, ValueOffset and ValueLength. Names lack the
+// "api-" prefix.
+func (r apisetReader) parseV2(s *APISetSchema) error {
+	count, err := r.u32(4)
+	if err != nil {
+		return err
+	}
+	if count > maxAPISetEntries {
+		return fmt.Errorf("API set schema entry count %d too large", count)
+	}
+	for i := uint32(0); i < count; i++ {
+		v, err := r.fields(8+i*12, 3)
+		if err != nil {
+			return err
+		}
+		e := APISetEntry{}
+		if e.Name, err = r.str(v[0], v[1]); err != nil {
+			return err
+		}
+		n, err := r.u32(v[2])
+		if err != nil {
+			return err
+		}
+		if e.Hosts, err = r.values(v[2]+4, n, 16, 0); err != nil {
+			return err
+		}
+		e.Name = strings.TrimSuffix(strings.ToLower(e.Name), ".dll")
+		s.Entries = append(s.Entries, e)
+	}
+	return nil
+}
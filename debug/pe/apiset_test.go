@@ -0,0 +1,184 @@
+package pe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testContract is an API set contract of a synthetic schema, with the
+// hosts as importer and host pairs.
+type testContract struct {
+	name  string
+	hosts [][2]string
+}
+
+// apisetV6 lays out a version 6 namespace: the header, the entries, the
+// values and then the strings.
+func apisetV6(contracts []testContract) []byte {
+	nvalues := 0
+	for _, c := range contracts {
+		nvalues += len(c.hosts)
+	}
+	entryOffset := 28
+	valueOffset := entryOffset + 24*len(contracts)
+	var strs le
+	strBase := valueOffset + 20*nvalues
+	str := func(s string) (uint32, uint32) {
+		off := strBase + strs.Len()
+		strs.utf16(s)
+		return uint32(off), uint32(2 * len(s))
+	}
+	var entries, values le
+	for _, c := range contracts {
+		off, n := str(c.name)
+		entries.u32(0)
+		entries.u32(off)
+		entries.u32(n)
+		entries.u32(2 * uint32(strings.LastIndexByte(c.name, '-'))) // hashed length
+		entries.u32(uint32(valueOffset + values.Len()))
+		entries.u32(uint32(len(c.hosts)))
+		for _, h := range c.hosts {
+			values.u32(0)
+			off, n := str(h[0])
+			values.u32(off)
+			values.u32(n)
+			off, n = str(h[1])
+			values.u32(off)
+			values.u32(n)
+		}
+	}
+	var b le
+	b.u32(6)
+	b.u32(uint32(strBase + strs.Len()))
+	b.u32(0)
+	b.u32(uint32(len(contracts)))
+	b.u32(uint32(entryOffset))
+	b.u32(0) // no hash table, lookups do not use it
+	b.u32(0)
+	b.Write(entries.Bytes())
+	b.Write(values.Bytes())
+	b.Write(strs.Bytes())
+	return b.Bytes()
+}
+
+// apisetV2 lays out a version 2 namespace, whose contract names lack
+// the api- prefix.
+func apisetV2(contracts []testContract) []byte {
+	dataOffset := 8 + 12*len(contracts)
+	strBase := dataOffset
+	for _, c := range contracts {
+		strBase += 4 + 16*len(c.hosts)
+	}
+	var strs le
+	str := func(s string) (uint32, uint32) {
+		off := strBase + strs.Len()
+		strs.utf16(s)
+		return uint32(off), uint32(2 * len(s))
+	}
+	var entries, data le
+	for _, c := range contracts {
+		off, n := str(c.name)
+		entries.u32(off)
+		entries.u32(n)
+		entries.u32(uint32(dataOffset + data.Len()))
+		data.u32(uint32(len(c.hosts)))
+		for _, h := range c.hosts {
+			off, n := str(h[0])
+			data.u32(off)
+			data.u32(n)
+			off, n = str(h[1])
+			data.u32(off)
+			data.u32(n)
+		}
+	}
+	var b le
+	b.u32(2)
+	b.u32(uint32(len(contracts)))
+	b.Write(entries.Bytes())
+	b.Write(data.Bytes())
+	b.Write(strs.Bytes())
+	return b.Bytes()
+}
+
+func TestParseAPISetSchema(t *testing.T) {
+	data := apisetV6([]testContract{
+		{"api-ms-win-core-synch-l1-2-0", [][2]string{{"", "kernelbase.dll"}}},
+		{"api-ms-win-core-file-l1-2-4", [][2]string{{"", "kernelbase.dll"}, {"kernel32.dll", "kernel32legacy.dll"}}},
+		{"ext-ms-win-ntuser-window-l1-1-5", nil},
+		{"API-MS-Win-CRT-Runtime-L1-1-0", [][2]string{{"", "ucrtbase.dll"}}},
+	})
+	s, err := ParseAPISetSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != 6 || len(s.Entries) != 4 {
+		t.Fatalf("ParseAPISetSchema = version %d, %d entries", s.Version, len(s.Entries))
+	}
+	want := APISetEntry{
+		Name:  "api-ms-win-core-file-l1-2-4",
+		Hosts: []APISetHost{{"", "kernelbase.dll"}, {"kernel32.dll", "kernel32legacy.dll"}},
+	}
+	if !reflect.DeepEqual(s.Entries[0], want) {
+		t.Errorf("Entries[0] = %+v, want %+v", s.Entries[0], want)
+	}
+
+	tests := []struct {
+		name, importer string
+		host           string
+		ok             bool
+	}{
+		{"api-ms-win-core-file-l1-2-4.dll", "app.exe", "kernelbase.dll", true},
+		{"API-MS-WIN-CORE-FILE-L1-2-2.DLL", "", "kernelbase.dll", true},
+		{"api-ms-win-core-file-l1-2-4.dll", "KERNEL32.DLL", "kernel32legacy.dll", true},
+		{"api-ms-win-core-file-l1-1-0.dll", "", "", false},
+		{"api-ms-win-crt-runtime-l1-1-0.dll", "", "ucrtbase.dll", true},
+		{"ext-ms-win-ntuser-window-l1-1-5.dll", "", "", false},
+		{"kernel32.dll", "", "", false},
+	}
+	for _, tt := range tests {
+		host, ok := s.Resolve(tt.name, tt.importer)
+		if host != tt.host || ok != tt.ok {
+			t.Errorf("Resolve(%q, %q) = %q, %v, want %q, %v", tt.name, tt.importer, host, ok, tt.host, tt.ok)
+		}
+	}
+
+	if _, err := ParseAPISetSchema(data[:40]); err == nil {
+		t.Error("ParseAPISetSchema of a truncated schema succeeded")
+	}
+	if _, err := ParseAPISetSchema([]byte{3, 0, 0, 0}); err == nil {
+		t.Error("ParseAPISetSchema of version 3 succeeded")
+	}
+}
+
+func TestParseAPISetSchemaV2(t *testing.T) {
+	s, err := ParseAPISetSchema(apisetV2([]testContract{
+		{"MS-Win-Core-Console-L1-1-0", [][2]string{{"", "kernel32.dll"}}},
+		{"ms-win-core-string-l1-1-0", [][2]string{{"", "kernelbase.dll"}}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Entries[0].Name != "ms-win-core-console-l1-1-0" {
+		t.Errorf("Entries[0].Name = %q", s.Entries[0].Name)
+	}
+	if host, ok := s.Resolve("api-ms-win-core-string-l1-1-0.dll", ""); host != "kernelbase.dll" || !ok {
+		t.Errorf("Resolve = %q, %v, want kernelbase.dll", host, ok)
+	}
+}
+
+func TestLookupAPISetSchema(t *testing.T) {
+	data := apisetV6([]testContract{{"api-ms-win-core-synch-l1-2-0", [][2]string{{"", "kernelbase.dll"}}}})
+	ti := &testImage{sections: []testSection{{name: ".apiset", va: 0x1000, data: data}}}
+	s, err := ti.open(t).LookupAPISetSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil || len(s.Entries) != 1 {
+		t.Fatalf("LookupAPISetSchema = %+v", s)
+	}
+	ti = &testImage{sections: []testSection{{name: ".text", va: 0x1000, data: make([]byte, 0x10)}}}
+	if s, err := ti.open(t).LookupAPISetSchema(); s != nil || err != nil {
+		t.Errorf("LookupAPISetSchema without .apiset = %v, %v", s, err)
+	}
+}
@@ -0,0 +1,370 @@
+package pe
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// WIN_CERTIFICATE revisions and types.
+const (
+	WIN_CERT_REVISION_1_0 = 0x0100
+	WIN_CERT_REVISION_2_0 = 0x0200
+
+	WIN_CERT_TYPE_X509             = 0x0001
+	WIN_CERT_TYPE_PKCS_SIGNED_DATA = 0x0002
+	WIN_CERT_TYPE_RESERVED_1       = 0x0003
+	WIN_CERT_TYPE_TS_STACK_SIGNED  = 0x0004
+)
+
+// WinCertificate is an entry of the attribute certificate table
+// (WIN_CERTIFICATE).
+type WinCertificate struct {
+	Length          uint32
+	Revision        uint16
+	CertificateType uint16
+	Certificate     []byte
+}
+
+// maxCertificateTableSize bounds the certificate table of malformed
+// images.
+const maxCertificateTableSize = 1 << 26
+
+// LookupCertificates reads the attribute certificate table. Unlike the
+// other data directories, the security directory holds a file offset,
+// and the table is not mapped into memory. It returns nil and no error
+// if the image is not signed.
+func (f *File) LookupCertificates() ([]*WinCertificate, error) {
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY)
+	if !ok {
+		return nil, nil
+	}
+	if dd.Size > maxCertificateTableSize {
+		return nil, fmt.Errorf("certificate table size %d too large", dd.Size)
+	}
+	if f.originalReader == nil {
+		return nil, errors.New("pe: file reader is nil")
+	}
+	data, err := saferio.ReadDataAt(f.originalReader, uint64(dd.Size), int64(dd.VirtualAddress))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read certificate table: %v", err)
+	}
+	var certs []*WinCertificate
+	for len(data) >= 8 {
+		c := &WinCertificate{
+			Length:          binary.LittleEndian.Uint32(data[0:4]),
+			Revision:        binary.LittleEndian.Uint16(data[4:6]),
+			CertificateType: binary.LittleEndian.Uint16(data[6:8]),
+		}
+		if c.Length < 8 || uint64(c.Length) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid WIN_CERTIFICATE length %d", c.Length)
+		}
+		c.Certificate = data[8:c.Length]
+		certs = append(certs, c)
+		// Entries are aligned to 8 bytes.
+		n := (uint64(c.Length) + 7) &^ 7
+		if n > uint64(len(data)) {
+			break
+		}
+		data = data[n:]
+	}
+	return certs, nil
+}
+
+var (
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidMessageDigest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidMD5    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 5}
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// hashForOID returns the hash function identified by oid, or 0.
+func hashForOID(oid asn1.ObjectIdentifier) crypto.Hash {
+	switch {
+	case oid.Equal(oidMD5):
+		return crypto.MD5
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512
+	}
+	return 0
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type spcAttributeTypeAndOptionalValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"optional"`
+}
+
+type spcDigestInfo struct {
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	Digest          []byte
+}
+
+type spcIndirectDataContent struct {
+	Data          spcAttributeTypeAndOptionalValue
+	MessageDigest spcDigestInfo
+}
+
+// AuthenticodeSignature is a decoded Authenticode PKCS#7 SignedData.
+type AuthenticodeSignature struct {
+	// DigestAlgorithm and Digest are the image digest the publisher
+	// signed, taken from the SpcIndirectDataContent.
+	DigestAlgorithm    crypto.Hash // 0 if the algorithm is unknown
+	DigestAlgorithmOID asn1.ObjectIdentifier
+	Digest             []byte
+
+	// Certificates holds every certificate embedded in the signature.
+	Certificates []*x509.Certificate
+	// Signer is the certificate of the signer, Chain the certificates
+	// linking it to the last issuer found in Certificates, starting with
+	// Signer. The chain is not checked against any trust store.
+	Signer *x509.Certificate
+	Chain  []*x509.Certificate
+
+	content    []byte // contents of the SpcIndirectDataContent
+	signerInfo pkcs7SignerInfo
+}
+
+// ParseAuthenticode decodes the DER encoded PKCS#7 SignedData of a
+// WIN_CERT_TYPE_PKCS_SIGNED_DATA certificate.
+func ParseAuthenticode(der []byte) (*AuthenticodeSignature, error) {
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("fail to parse PKCS#7 content info: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content type %v is not SignedData", ci.ContentType)
+	}
+	// The RawValue of an explicit field keeps the [0] wrapper.
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("fail to parse PKCS#7 SignedData: %v", err)
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidSpcIndirectDataContent) {
+		return nil, fmt.Errorf("SignedData content type %v is not SpcIndirectDataContent", sd.ContentInfo.ContentType)
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &raw); err != nil {
+		return nil, fmt.Errorf("fail to parse SpcIndirectDataContent: %v", err)
+	}
+	var idc spcIndirectDataContent
+	if _, err := asn1.Unmarshal(raw.FullBytes, &idc); err != nil {
+		return nil, fmt.Errorf("fail to parse SpcIndirectDataContent: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("SignedData has %d signers, want 1", len(sd.SignerInfos))
+	}
+	s := &AuthenticodeSignature{
+		DigestAlgorithm:    hashForOID(idc.MessageDigest.DigestAlgorithm.Algorithm),
+		DigestAlgorithmOID: idc.MessageDigest.DigestAlgorithm.Algorithm,
+		Digest:             idc.MessageDigest.Digest,
+		// messageDigest covers the SpcIndirectDataContent value without
+		// its SEQUENCE tag and length.
+		content:    raw.Bytes,
+		signerInfo: sd.SignerInfos[0],
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse signature certificates: %v", err)
+		}
+		s.Certificates = certs
+	}
+	ias := s.signerInfo.IssuerAndSerialNumber
+	for _, c := range s.Certificates {
+		if c.SerialNumber.Cmp(ias.Serial) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+			s.Signer = c
+			break
+		}
+	}
+	if s.Signer == nil {
+		return nil, errors.New("signer certificate not found in signature")
+	}
+	s.Chain = buildChain(s.Signer, s.Certificates)
+	return s, nil
+}
+
+// buildChain follows the issuers of leaf through certs.
+func buildChain(leaf *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	for c := leaf; !bytes.Equal(c.RawIssuer, c.RawSubject); {
+		var next *x509.Certificate
+		for _, p := range certs {
+			// CheckSignatureFrom would reject the SHA-1 signatures
+			// still common in code signing chains.
+			if bytes.Equal(p.RawSubject, c.RawIssuer) && p.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil {
+				next = p
+				break
+			}
+		}
+		if next == nil || len(chain) > len(certs) {
+			break
+		}
+		chain = append(chain, next)
+		c = next
+	}
+	return chain
+}
+
+// VerifySignature checks that the signer signed the digest: the
+// messageDigest attribute must match the SpcIndirectDataContent and the
+// signature over the authenticated attributes must be valid for the
+// signer certificate. It does not check the chain against a trust store,
+// nor that the digest matches the image; see File.VerifyAuthenticode.
+func (s *AuthenticodeSignature) VerifySignature() error {
+	si := &s.signerInfo
+	h := hashForOID(si.DigestAlgorithm.Algorithm)
+	if h == 0 || !h.Available() {
+		return fmt.Errorf("unsupported signer digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+	if len(si.AuthenticatedAttributes.Bytes) == 0 {
+		return errors.New("signer has no authenticated attributes")
+	}
+	var digest []byte
+	for rest := si.AuthenticatedAttributes.Bytes; len(rest) > 0; {
+		var attr pkcs7Attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("fail to parse authenticated attribute: %v", err)
+		}
+		if attr.Type.Equal(oidMessageDigest) {
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+				return fmt.Errorf("fail to parse messageDigest attribute: %v", err)
+			}
+		}
+	}
+	if digest == nil {
+		return errors.New("signer has no messageDigest attribute")
+	}
+	hh := h.New()
+	hh.Write(s.content)
+	if !bytes.Equal(hh.Sum(nil), digest) {
+		return errors.New("messageDigest does not match the signed content")
+	}
+	// The signature covers the attributes encoded as a SET OF, not
+	// with the implicit [0] tag they are stored with.
+	signed := append([]byte(nil), si.AuthenticatedAttributes.FullBytes...)
+	signed[0] = 0x31
+	alg, err := signatureAlgorithm(h, si.DigestEncryptionAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	return s.Signer.CheckSignature(alg, signed, si.EncryptedDigest)
+}
+
+// signatureAlgorithm maps the digest and encryption algorithms of a
+// signer to an x509.SignatureAlgorithm. Some signers put the combined
+// signature algorithm in the encryption algorithm field.
+func signatureAlgorithm(h crypto.Hash, enc asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	type key struct {
+		hash  crypto.Hash
+		ecdsa bool
+	}
+	algs := map[key]x509.SignatureAlgorithm{
+		{crypto.MD5, false}:    x509.MD5WithRSA,
+		{crypto.SHA1, false}:   x509.SHA1WithRSA,
+		{crypto.SHA256, false}: x509.SHA256WithRSA,
+		{crypto.SHA384, false}: x509.SHA384WithRSA,
+		{crypto.SHA512, false}: x509.SHA512WithRSA,
+		{crypto.SHA1, true}:    x509.ECDSAWithSHA1,
+		{crypto.SHA256, true}:  x509.ECDSAWithSHA256,
+		{crypto.SHA384, true}:  x509.ECDSAWithSHA384,
+		{crypto.SHA512, true}:  x509.ECDSAWithSHA512,
+	}
+	var ecdsa bool
+	switch {
+	case enc.Equal(oidRSA):
+	case enc.Equal(oidECDSA):
+		ecdsa = true
+	case len(enc) == 7 && enc[:6].Equal(oidRSA[:6]):
+		// sha*WithRSAEncryption, 1.2.840.113549.1.1.x
+	case len(enc) >= 6 && enc[:6].Equal(asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3}),
+		enc.Equal(asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}):
+		// ecdsa-with-SHA*
+		ecdsa = true
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v", enc)
+	}
+	alg, ok := algs[key{h, ecdsa}]
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v with %v", enc, h)
+	}
+	return alg, nil
+}
+
+// LookupAuthenticode decodes the Authenticode signatures of the image,
+// one for each PKCS#7 entry of the certificate table. It returns nil
+// and no error if the image is not signed.
+func (f *File) LookupAuthenticode() ([]*AuthenticodeSignature, error) {
+	certs, err := f.LookupCertificates()
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*AuthenticodeSignature
+	for _, c := range certs {
+		if c.CertificateType != WIN_CERT_TYPE_PKCS_SIGNED_DATA {
+			continue
+		}
+		s, err := ParseAuthenticode(c.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, s)
+	}
+	return sigs, nil
+}
@@ -0,0 +1,219 @@
+package pe
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testSigner issues Authenticode signatures with a throwaway CA.
+type testSigner struct {
+	caKey, key *ecdsa.PrivateKey
+	ca, cert   *x509.Certificate
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	s := &testSigner{}
+	var err error
+	if s.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if s.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &s.caKey.PublicKey, s.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Example Publisher", Organization: []string{"Example Corp"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, tmpl, s.ca, &s.key.PublicKey, s.caKey); err != nil {
+		t.Fatal(err)
+	}
+	if s.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sign returns the DER PKCS#7 SignedData of an SpcIndirectDataContent
+// holding digest, computed with h.
+func (s *testSigner) sign(t *testing.T, h crypto.Hash, digestOID asn1.ObjectIdentifier, digest []byte) []byte {
+	t.Helper()
+	idc := mustMarshal(t, spcIndirectDataContent{
+		Data: spcAttributeTypeAndOptionalValue{
+			Type:  asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}, // SPC_PE_IMAGE_DATAOBJ
+			Value: asn1.RawValue{FullBytes: []byte{0x30, 0x00}},
+		},
+		MessageDigest: spcDigestInfo{
+			DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: digestOID},
+			Digest:          digest,
+		},
+	})
+	var idcRaw asn1.RawValue
+	if _, err := asn1.Unmarshal(idc, &idcRaw); err != nil {
+		t.Fatal(err)
+	}
+	contentDigest := sha256.Sum256(idcRaw.Bytes)
+
+	set := func(v []byte) asn1.RawValue {
+		return asn1.RawValue{FullBytes: mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: v})}
+	}
+	var attrs []byte
+	attrs = append(attrs, mustMarshal(t, pkcs7Attribute{
+		Type:   asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3},
+		Values: set(mustMarshal(t, oidSpcIndirectDataContent)),
+	})...)
+	attrs = append(attrs, mustMarshal(t, pkcs7Attribute{
+		Type:   oidMessageDigest,
+		Values: set(mustMarshal(t, contentDigest[:])),
+	})...)
+	signed := mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	sum := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := mustMarshal(t, pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo: pkcs7ContentInfo{
+			ContentType: oidSpcIndirectDataContent,
+			Content:     explicit0(idc),
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(append([]byte(nil), s.cert.Raw...), s.ca.Raw...)},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer},
+				Serial: s.cert.SerialNumber,
+			},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSA},
+			EncryptedDigest:           sig,
+		}},
+	})
+	return mustMarshal(t, pkcs7ContentInfo{ContentType: oidSignedData, Content: explicit0(sd)})
+}
+
+// explicit0 wraps b in an explicit [0] tag; encoding/asn1 ignores the
+// explicit parameter when marshaling a RawValue.
+func explicit0(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+// winCertificate wraps a PKCS#7 signature into a WIN_CERTIFICATE,
+// padded to 8 bytes.
+func winCertificate(sig []byte) []byte {
+	var b le
+	b.u32(uint32(8 + len(sig)))
+	b.u16(WIN_CERT_REVISION_2_0)
+	b.u16(WIN_CERT_TYPE_PKCS_SIGNED_DATA)
+	b.Write(sig)
+	b.pad(align8(b.Len()))
+	return b.Bytes()
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+func TestParseAuthenticode(t *testing.T) {
+	s := newTestSigner(t)
+	digest := make([]byte, 32)
+	for i := range digest {
+		digest[i] = byte(i)
+	}
+	sig, err := ParseAuthenticode(s.sign(t, crypto.SHA256, oidSHA256, digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.DigestAlgorithm != crypto.SHA256 || string(sig.Digest) != string(digest) {
+		t.Errorf("digest = %v %x", sig.DigestAlgorithm, sig.Digest)
+	}
+	if sig.Signer == nil || sig.Signer.Subject.CommonName != "Example Publisher" {
+		t.Fatalf("Signer = %v", sig.Signer)
+	}
+	if len(sig.Chain) != 2 || sig.Chain[1].Subject.CommonName != "Test Root CA" {
+		t.Errorf("Chain = %v", sig.Chain)
+	}
+	if err := sig.VerifySignature(); err != nil {
+		t.Errorf("VerifySignature: %v", err)
+	}
+
+	// Tampering with the signed content breaks the signature.
+	sig.content = append([]byte(nil), sig.content...)
+	sig.content[len(sig.content)-1] ^= 0xff
+	if err := sig.VerifySignature(); err == nil {
+		t.Error("VerifySignature of tampered content succeeded")
+	}
+}
+
+func TestLookupAuthenticode(t *testing.T) {
+	s := newTestSigner(t)
+	ti := &testImage{sections: []testSection{{name: ".text", va: 0x1000, data: make([]byte, 0x10)}}}
+	img := ti.build()
+	cert := winCertificate(s.sign(t, crypto.SHA256, oidSHA256, make([]byte, 32)))
+	ti.dirs = map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_SECURITY: {VirtualAddress: uint32(len(img)), Size: uint32(len(cert))},
+	}
+	img = append(ti.build(), cert...)
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := f.LookupCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Revision != WIN_CERT_REVISION_2_0 || certs[0].CertificateType != WIN_CERT_TYPE_PKCS_SIGNED_DATA {
+		t.Fatalf("LookupCertificates = %+v", certs)
+	}
+	sigs, err := f.LookupAuthenticode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 1 || sigs[0].Signer.Subject.Organization[0] != "Example Corp" {
+		t.Errorf("LookupAuthenticode = %+v", sigs)
+	}
+}
@@ -0,0 +1,265 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Base relocation types. Types 5, 7, 8 and 9 depend on the machine.
+const (
+	IMAGE_REL_BASED_ABSOLUTE            = 0
+	IMAGE_REL_BASED_HIGH                = 1
+	IMAGE_REL_BASED_LOW                 = 2
+	IMAGE_REL_BASED_HIGHLOW             = 3
+	IMAGE_REL_BASED_HIGHADJ             = 4
+	IMAGE_REL_BASED_MACHINE_SPECIFIC_5  = 5
+	IMAGE_REL_BASED_RESERVED            = 6
+	IMAGE_REL_BASED_MACHINE_SPECIFIC_7  = 7
+	IMAGE_REL_BASED_MACHINE_SPECIFIC_8  = 8
+	IMAGE_REL_BASED_MACHINE_SPECIFIC_9  = 9
+	IMAGE_REL_BASED_DIR64               = 10
+	IMAGE_REL_BASED_MIPS_JMPADDR        = 5
+	IMAGE_REL_BASED_ARM_MOV32           = 5
+	IMAGE_REL_BASED_RISCV_HIGH20        = 5
+	IMAGE_REL_BASED_THUMB_MOV32         = 7
+	IMAGE_REL_BASED_RISCV_LOW12I        = 7
+	IMAGE_REL_BASED_RISCV_LOW12S        = 8
+	IMAGE_REL_BASED_LOONGARCH32_MARK_LA = 8
+	IMAGE_REL_BASED_LOONGARCH64_MARK_LA = 8
+	IMAGE_REL_BASED_IA64_IMM64          = 9
+	IMAGE_REL_BASED_MIPS_JMPADDR16      = 9
+)
+
+// BaseRelocEntry is a fixup of a base relocation block.
+type BaseRelocEntry struct {
+	Type   uint8
+	Offset uint16 // offset from the page RVA of the block
+	RVA    uint32 // RVA of the location to fix up
+	Param  uint16 // low 16 bits of the target of a HIGHADJ fixup
+}
+
+// BaseRelocBlock is a block of the base relocation table, holding the
+// fixups of a 4K page.
+type BaseRelocBlock struct {
+	PageRVA     uint32
+	SizeOfBlock uint32
+	Entries     []BaseRelocEntry
+}
+
+const baseRelocBlockHeaderSize = 8
+
+// LookupBaseRelocations decodes the base relocation table of the image.
+// It returns nil and no error if the image has no base relocations, in
+// which case it can only be loaded at its preferred image base.
+func (f *File) LookupBaseRelocations() ([]*BaseRelocBlock, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_BASERELOC)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read base relocation directory: %v", err)
+	}
+	var blocks []*BaseRelocBlock
+	for len(data) >= baseRelocBlockHeaderSize {
+		b := &BaseRelocBlock{
+			PageRVA:     binary.LittleEndian.Uint32(data[0:4]),
+			SizeOfBlock: binary.LittleEndian.Uint32(data[4:8]),
+		}
+		if b.SizeOfBlock == 0 && b.PageRVA == 0 {
+			// Some linkers terminate the table with an empty block.
+			break
+		}
+		if b.SizeOfBlock < baseRelocBlockHeaderSize || uint64(b.SizeOfBlock) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid base relocation block size %d at page %#x", b.SizeOfBlock, b.PageRVA)
+		}
+		d := data[baseRelocBlockHeaderSize:b.SizeOfBlock]
+		b.Entries = make([]BaseRelocEntry, 0, len(d)/2)
+		for i := 0; i+2 <= len(d); i += 2 {
+			v := binary.LittleEndian.Uint16(d[i:])
+			e := BaseRelocEntry{Type: uint8(v >> 12), Offset: v & 0xfff}
+			e.RVA = b.PageRVA + uint32(e.Offset)
+			if e.Type == IMAGE_REL_BASED_HIGHADJ {
+				// The next slot holds the low half of the target.
+				if i+4 > len(d) {
+					return nil, fmt.Errorf("truncated HIGHADJ relocation at %#x", e.RVA)
+				}
+				i += 2
+				e.Param = binary.LittleEndian.Uint16(d[i:])
+			}
+			b.Entries = append(b.Entries, e)
+		}
+		blocks = append(blocks, b)
+		data = data[b.SizeOfBlock:]
+	}
+	return blocks, nil
+}
+
+// BaseRelocTypeString returns the name of the base relocation type typ
+// as interpreted for machine.
+func BaseRelocTypeString(machine uint16, typ uint8) string {
+	switch typ {
+	case IMAGE_REL_BASED_ABSOLUTE:
+		return "ABSOLUTE"
+	case IMAGE_REL_BASED_HIGH:
+		return "HIGH"
+	case IMAGE_REL_BASED_LOW:
+		return "LOW"
+	case IMAGE_REL_BASED_HIGHLOW:
+		return "HIGHLOW"
+	case IMAGE_REL_BASED_HIGHADJ:
+		return "HIGHADJ"
+	case IMAGE_REL_BASED_DIR64:
+		return "DIR64"
+	case IMAGE_REL_BASED_MACHINE_SPECIFIC_5:
+		if isARMMachine(machine) {
+			return "ARM_MOV32"
+		}
+		switch machine {
+		case IMAGE_FILE_MACHINE_RISCV32, IMAGE_FILE_MACHINE_RISCV64, IMAGE_FILE_MACHINE_RISCV128:
+			return "RISCV_HIGH20"
+		case IMAGE_FILE_MACHINE_R4000, IMAGE_FILE_MACHINE_MIPS16, IMAGE_FILE_MACHINE_MIPSFPU,
+			IMAGE_FILE_MACHINE_MIPSFPU16, IMAGE_FILE_MACHINE_WCEMIPSV2:
+			return "MIPS_JMPADDR"
+		}
+	case IMAGE_REL_BASED_MACHINE_SPECIFIC_7:
+		if isARMMachine(machine) {
+			return "THUMB_MOV32"
+		}
+		switch machine {
+		case IMAGE_FILE_MACHINE_RISCV32, IMAGE_FILE_MACHINE_RISCV64, IMAGE_FILE_MACHINE_RISCV128:
+			return "RISCV_LOW12I"
+		}
+	case IMAGE_REL_BASED_MACHINE_SPECIFIC_8:
+		switch machine {
+		case IMAGE_FILE_MACHINE_RISCV32, IMAGE_FILE_MACHINE_RISCV64, IMAGE_FILE_MACHINE_RISCV128:
+			return "RISCV_LOW12S"
+		case IMAGE_FILE_MACHINE_LOONGARCH32:
+			return "LOONGARCH32_MARK_LA"
+		case IMAGE_FILE_MACHINE_LOONGARCH64:
+			return "LOONGARCH64_MARK_LA"
+		}
+	case IMAGE_REL_BASED_MACHINE_SPECIFIC_9:
+		switch machine {
+		case IMAGE_FILE_MACHINE_IA64:
+			return "IA64_IMM64"
+		case IMAGE_FILE_MACHINE_R4000, IMAGE_FILE_MACHINE_MIPS16, IMAGE_FILE_MACHINE_MIPSFPU,
+			IMAGE_FILE_MACHINE_MIPSFPU16, IMAGE_FILE_MACHINE_WCEMIPSV2:
+			return "MIPS_JMPADDR16"
+		}
+	}
+	return "TYPE_" + strconv.Itoa(int(typ))
+}
+
+// ApplyBaseRelocations applies the fixups of blocks to image, which is
+// the image laid out in memory and indexed by RVA, as if it was loaded
+// delta bytes away from its preferred image base. ARM64 images only use
+// DIR64 fixups. Fixup types other than those of x86, x64, ARM and ARM64
+// images are reported as errors.
+func ApplyBaseRelocations(image []byte, machine uint16, blocks []*BaseRelocBlock, delta uint64) error {
+	for _, b := range blocks {
+		for _, e := range b.Entries {
+			if err := applyBaseReloc(image, machine, e, delta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isARMMachine(machine uint16) bool {
+	switch machine {
+	case IMAGE_FILE_MACHINE_ARM, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_THUMB:
+		return true
+	}
+	return false
+}
+
+func applyBaseReloc(image []byte, machine uint16, e BaseRelocEntry, delta uint64) error {
+	var n uint64
+	switch {
+	case e.Type == IMAGE_REL_BASED_ABSOLUTE:
+		return nil
+	case e.Type == IMAGE_REL_BASED_HIGH, e.Type == IMAGE_REL_BASED_LOW, e.Type == IMAGE_REL_BASED_HIGHADJ:
+		n = 2
+	case e.Type == IMAGE_REL_BASED_HIGHLOW:
+		n = 4
+	case e.Type == IMAGE_REL_BASED_DIR64:
+		n = 8
+	case e.Type == IMAGE_REL_BASED_ARM_MOV32 && isARMMachine(machine),
+		e.Type == IMAGE_REL_BASED_THUMB_MOV32 && isARMMachine(machine):
+		n = 8 // a MOVW and MOVT pair
+	default:
+		return fmt.Errorf("unsupported base relocation %s at %#x", BaseRelocTypeString(machine, e.Type), e.RVA)
+	}
+	if uint64(e.RVA)+n > uint64(len(image)) {
+		return fmt.Errorf("base relocation %s at %#x out of range", BaseRelocTypeString(machine, e.Type), e.RVA)
+	}
+	p := image[e.RVA:]
+	switch e.Type {
+	case IMAGE_REL_BASED_HIGH:
+		v := binary.LittleEndian.Uint16(p) + uint16(delta>>16)
+		binary.LittleEndian.PutUint16(p, v)
+	case IMAGE_REL_BASED_LOW:
+		v := binary.LittleEndian.Uint16(p) + uint16(delta)
+		binary.LittleEndian.PutUint16(p, v)
+	case IMAGE_REL_BASED_HIGHLOW:
+		v := binary.LittleEndian.Uint32(p) + uint32(delta)
+		binary.LittleEndian.PutUint32(p, v)
+	case IMAGE_REL_BASED_HIGHADJ:
+		v := uint32(binary.LittleEndian.Uint16(p))<<16 + uint32(int32(int16(e.Param)))
+		v += uint32(delta) + 0x8000
+		binary.LittleEndian.PutUint16(p, uint16(v>>16))
+	case IMAGE_REL_BASED_DIR64:
+		v := binary.LittleEndian.Uint64(p) + delta
+		binary.LittleEndian.PutUint64(p, v)
+	case IMAGE_REL_BASED_ARM_MOV32:
+		lo := binary.LittleEndian.Uint32(p)
+		hi := binary.LittleEndian.Uint32(p[4:])
+		v := uint32(armMovImm(hi))<<16 | uint32(armMovImm(lo))
+		v += uint32(delta)
+		binary.LittleEndian.PutUint32(p, armSetMovImm(lo, uint16(v)))
+		binary.LittleEndian.PutUint32(p[4:], armSetMovImm(hi, uint16(v>>16)))
+	case IMAGE_REL_BASED_THUMB_MOV32:
+		lo := thumbInsn(p)
+		hi := thumbInsn(p[4:])
+		v := uint32(thumbMovImm(hi))<<16 | uint32(thumbMovImm(lo))
+		v += uint32(delta)
+		putThumbInsn(p, thumbSetMovImm(lo, uint16(v)))
+		putThumbInsn(p[4:], thumbSetMovImm(hi, uint16(v>>16)))
+	}
+	return nil
+}
+
+// armMovImm returns the immediate of an A32 MOVW or MOVT, imm4:imm12.
+func armMovImm(insn uint32) uint16 {
+	return uint16(insn>>16&0xf)<<12 | uint16(insn&0xfff)
+}
+
+func armSetMovImm(insn uint32, imm uint16) uint32 {
+	insn &^= 0xf<<16 | 0xfff
+	return insn | uint32(imm>>12)<<16 | uint32(imm&0xfff)
+}
+
+// thumbInsn reads a 32-bit Thumb-2 instruction, stored as two
+// little-endian halfwords with the leading halfword first.
+func thumbInsn(p []byte) uint32 {
+	return uint32(binary.LittleEndian.Uint16(p))<<16 | uint32(binary.LittleEndian.Uint16(p[2:]))
+}
+
+func putThumbInsn(p []byte, insn uint32) {
+	binary.LittleEndian.PutUint16(p, uint16(insn>>16))
+	binary.LittleEndian.PutUint16(p[2:], uint16(insn))
+}
+
+// thumbMovImm returns the immediate of a T32 MOVW or MOVT,
+// imm4:i:imm3:imm8.
+func thumbMovImm(insn uint32) uint16 {
+	imm4 := uint16(insn >> 16 & 0xf)
+	i := uint16(insn >> 26 & 1)
+	imm3 := uint16(insn >> 12 & 7)
+	imm8 := uint16(insn & 0xff)
+	return imm4<<12 | i<<11 | imm3<<8 | imm8
+}
+
+func thumbSetMovImm(insn uint32, imm uint16) uint32 {
+	insn &^= 0xf<<16 | 1<<26 | 7<<12 | 0xff
+	return insn | uint32(imm>>12)<<16 | uint32(imm>>11&1)<<26 | uint32(imm>>8&7)<<12 | uint32(imm&0xff)
+}
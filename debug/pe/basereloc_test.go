@@ -0,0 +1,145 @@
+package pe
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestLookupBaseRelocations(t *testing.T) {
+	const va = 0x4000
+	var b le
+	// Page 0x1000: DIR64 at 0x10 and 0x18, padded with ABSOLUTE.
+	b.u32(0x1000)
+	b.u32(8 + 4*2)
+	b.u16(IMAGE_REL_BASED_DIR64<<12 | 0x10)
+	b.u16(IMAGE_REL_BASED_DIR64<<12 | 0x18)
+	b.u16(IMAGE_REL_BASED_HIGHADJ<<12 | 0x20)
+	b.u16(0x8123)
+	// Page 0x2000: HIGHLOW at 0xffc.
+	b.u32(0x2000)
+	b.u32(8 + 2*2)
+	b.u16(IMAGE_REL_BASED_HIGHLOW<<12 | 0xffc)
+	b.u16(IMAGE_REL_BASED_ABSOLUTE << 12)
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_BASERELOC: {VirtualAddress: va, Size: uint32(b.Len())},
+		},
+		sections: []testSection{{name: ".reloc", va: va, data: b.Bytes()}},
+	}
+	blocks, err := ti.open(t).LookupBaseRelocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(blocks))
+	}
+	if blocks[0].PageRVA != 0x1000 || blocks[0].SizeOfBlock != 16 || len(blocks[0].Entries) != 3 {
+		t.Errorf("block 0 = %+v", blocks[0])
+	}
+	if e := blocks[0].Entries[1]; e.Type != IMAGE_REL_BASED_DIR64 || e.Offset != 0x18 || e.RVA != 0x1018 {
+		t.Errorf("block 0 entry 1 = %+v", e)
+	}
+	if e := blocks[0].Entries[2]; e.Type != IMAGE_REL_BASED_HIGHADJ || e.Param != 0x8123 {
+		t.Errorf("block 0 entry 2 = %+v", e)
+	}
+	if e := blocks[1].Entries[0]; e.Type != IMAGE_REL_BASED_HIGHLOW || e.RVA != 0x2ffc {
+		t.Errorf("block 1 entry 0 = %+v", e)
+	}
+}
+
+func TestLookupBaseRelocationsBadSize(t *testing.T) {
+	var b le
+	b.u32(0x1000)
+	b.u32(0x100)
+	b.u16(IMAGE_REL_BASED_DIR64<<12 | 0x10)
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_BASERELOC: {VirtualAddress: 0x4000, Size: uint32(b.Len())},
+		},
+		sections: []testSection{{name: ".reloc", va: 0x4000, data: b.Bytes()}},
+	}
+	if _, err := ti.open(t).LookupBaseRelocations(); err == nil {
+		t.Error("LookupBaseRelocations of oversized block succeeded")
+	}
+}
+
+func TestBaseRelocTypeString(t *testing.T) {
+	tests := []struct {
+		machine uint16
+		typ     uint8
+		want    string
+	}{
+		{IMAGE_FILE_MACHINE_AMD64, IMAGE_REL_BASED_DIR64, "DIR64"},
+		{IMAGE_FILE_MACHINE_ARM64, IMAGE_REL_BASED_DIR64, "DIR64"},
+		{IMAGE_FILE_MACHINE_I386, IMAGE_REL_BASED_HIGHLOW, "HIGHLOW"},
+		{IMAGE_FILE_MACHINE_ARMNT, 5, "ARM_MOV32"},
+		{IMAGE_FILE_MACHINE_ARMNT, 7, "THUMB_MOV32"},
+		{IMAGE_FILE_MACHINE_RISCV64, 5, "RISCV_HIGH20"},
+		{IMAGE_FILE_MACHINE_LOONGARCH64, 8, "LOONGARCH64_MARK_LA"},
+		{IMAGE_FILE_MACHINE_AMD64, 5, "TYPE_5"},
+	}
+	for _, tt := range tests {
+		if got := BaseRelocTypeString(tt.machine, tt.typ); got != tt.want {
+			t.Errorf("BaseRelocTypeString(%#x, %d) = %s, want %s", tt.machine, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestApplyBaseRelocations(t *testing.T) {
+	image := make([]byte, 0x40)
+	binary.LittleEndian.PutUint64(image[0x00:], 0x140001000)
+	binary.LittleEndian.PutUint32(image[0x08:], 0x00401000)
+	// HIGHADJ of 0x1234_8123: the high half is stored rounded up.
+	binary.LittleEndian.PutUint16(image[0x0c:], 0x1235)
+	// movw r0, #0x1000; movt r0, #0x40 (A32).
+	binary.LittleEndian.PutUint32(image[0x10:], armSetMovImm(0xe3000000, 0x1000))
+	binary.LittleEndian.PutUint32(image[0x14:], armSetMovImm(0xe3400000, 0x0040))
+	// movw r0, #0x1000; movt r0, #0x40 (T32).
+	putThumbInsn(image[0x18:], thumbSetMovImm(0xf2400000, 0x1000))
+	putThumbInsn(image[0x1c:], thumbSetMovImm(0xf2c00000, 0x0040))
+
+	const delta = 0x10000
+	blocks := []*BaseRelocBlock{{Entries: []BaseRelocEntry{
+		{Type: IMAGE_REL_BASED_DIR64, RVA: 0x00},
+		{Type: IMAGE_REL_BASED_HIGHLOW, RVA: 0x08},
+		{Type: IMAGE_REL_BASED_HIGHADJ, RVA: 0x0c, Param: 0x8123},
+		{Type: IMAGE_REL_BASED_ABSOLUTE, RVA: 0x3f},
+	}}}
+	if err := ApplyBaseRelocations(image, IMAGE_FILE_MACHINE_AMD64, blocks, delta); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint64(image[0x00:]); got != 0x140011000 {
+		t.Errorf("DIR64 = %#x", got)
+	}
+	if got := binary.LittleEndian.Uint32(image[0x08:]); got != 0x00411000 {
+		t.Errorf("HIGHLOW = %#x", got)
+	}
+	if got := binary.LittleEndian.Uint16(image[0x0c:]); got != 0x1236 {
+		t.Errorf("HIGHADJ = %#x", got)
+	}
+
+	arm := []*BaseRelocBlock{{Entries: []BaseRelocEntry{
+		{Type: IMAGE_REL_BASED_ARM_MOV32, RVA: 0x10},
+		{Type: IMAGE_REL_BASED_THUMB_MOV32, RVA: 0x18},
+	}}}
+	if err := ApplyBaseRelocations(image, IMAGE_FILE_MACHINE_ARMNT, arm, 0x12345678); err != nil {
+		t.Fatal(err)
+	}
+	if lo, hi := armMovImm(binary.LittleEndian.Uint32(image[0x10:])), armMovImm(binary.LittleEndian.Uint32(image[0x14:])); lo != 0x6678 || hi != 0x1274 {
+		t.Errorf("ARM_MOV32 = %#x:%#x, want 0x1274:0x6678", hi, lo)
+	}
+	if lo, hi := thumbMovImm(thumbInsn(image[0x18:])), thumbMovImm(thumbInsn(image[0x1c:])); lo != 0x6678 || hi != 0x1274 {
+		t.Errorf("THUMB_MOV32 = %#x:%#x, want 0x1274:0x6678", hi, lo)
+	}
+	if got := thumbInsn(image[0x18:]) &^ (0xf<<16 | 1<<26 | 7<<12 | 0xff); got != 0xf2400000 {
+		t.Errorf("THUMB_MOV32 clobbered opcode bits: %#x", got)
+	}
+
+	if err := ApplyBaseRelocations(image, IMAGE_FILE_MACHINE_AMD64, arm, 1); err == nil {
+		t.Error("ARM_MOV32 applied to an AMD64 image")
+	}
+	out := []*BaseRelocBlock{{Entries: []BaseRelocEntry{{Type: IMAGE_REL_BASED_DIR64, RVA: 0x3c}}}}
+	if err := ApplyBaseRelocations(image, IMAGE_FILE_MACHINE_AMD64, out, 1); err == nil {
+		t.Error("out of range DIR64 applied")
+	}
+}
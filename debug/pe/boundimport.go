@@ -0,0 +1,74 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// BoundForwarderRef is a module a bound import forwards to
+// (IMAGE_BOUND_FORWARDER_REF).
+type BoundForwarderRef struct {
+	TimeDateStamp uint32
+	ModuleName    string
+}
+
+// BoundImport is an entry of the bound import directory
+// (IMAGE_BOUND_IMPORT_DESCRIPTOR): the time stamp of the module the
+// import address table was bound against.
+type BoundImport struct {
+	TimeDateStamp uint32
+	ModuleName    string
+	Forwarders    []BoundForwarderRef
+}
+
+// Stale reports whether the binding does not match dll, the module the
+// loader resolves ModuleName to. The loader then ignores the bound
+// addresses and resolves the imports again.
+func (b *BoundImport) Stale(dll *File) bool {
+	return b.TimeDateStamp != dll.FileHeader.TimeDateStamp
+}
+
+// LookupBoundImports decodes the bound import directory. It returns nil
+// and no error if the image has no bound imports.
+func (f *File) LookupBoundImports() ([]BoundImport, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read bound import directory: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	// Module names are offsets from the start of the directory.
+	name := func(off uint16) (string, error) {
+		if int(off) >= len(data) {
+			return "", fmt.Errorf("bound import module name offset %#x out of range", off)
+		}
+		return cstring(data[off:]), nil
+	}
+	var imports []BoundImport
+	for d := data; len(d) >= 8; {
+		b := BoundImport{TimeDateStamp: binary.LittleEndian.Uint32(d[0:4])}
+		off := binary.LittleEndian.Uint16(d[4:6])
+		n := int(binary.LittleEndian.Uint16(d[6:8]))
+		if b.TimeDateStamp == 0 && off == 0 {
+			break
+		}
+		if b.ModuleName, err = name(off); err != nil {
+			return nil, err
+		}
+		d = d[8:]
+		if n*8 > len(d) {
+			return nil, fmt.Errorf("bound import %s has %d forwarders, out of directory", b.ModuleName, n)
+		}
+		for i := 0; i < n; i++ {
+			r := BoundForwarderRef{TimeDateStamp: binary.LittleEndian.Uint32(d[0:4])}
+			if r.ModuleName, err = name(binary.LittleEndian.Uint16(d[4:6])); err != nil {
+				return nil, err
+			}
+			b.Forwarders = append(b.Forwarders, r)
+			d = d[8:]
+		}
+		imports = append(imports, b)
+	}
+	return imports, nil
+}
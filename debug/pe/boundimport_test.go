@@ -0,0 +1,66 @@
+package pe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupBoundImports(t *testing.T) {
+	var b le
+	b.u32(0x4a5bc60f)
+	b.u16(0x20)
+	b.u16(1)
+	b.u32(0x4a5bc5e4)
+	b.u16(0x2d)
+	b.u16(0)
+	b.u32(0x4a5bc60c)
+	b.u16(0x37)
+	b.u16(0)
+	b.pad(0x20) // terminator
+	b.WriteString("kernel32.dll\x00ntdll.dll\x00user32.dll\x00")
+	b.pad(0x48)
+
+	// Linkers put the bound import directory in the headers, after the
+	// section table; the DOS stub is mapped the same way.
+	ti := &testImage{
+		dosStub: b.Bytes(),
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT: {VirtualAddress: 0x40, Size: uint32(b.Len())},
+		},
+		sections: []testSection{{name: ".text", va: 0x1000, data: make([]byte, 0x10)}},
+	}
+	f := ti.open(t)
+	got, err := f.LookupBoundImports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BoundImport{
+		{TimeDateStamp: 0x4a5bc60f, ModuleName: "kernel32.dll", Forwarders: []BoundForwarderRef{{0x4a5bc5e4, "ntdll.dll"}}},
+		{TimeDateStamp: 0x4a5bc60c, ModuleName: "user32.dll"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupBoundImports = %+v, want %+v", got, want)
+	}
+	ft, err := f.LookupFunctionTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bi := ft.Bound["user32.dll"]; bi.TimeDateStamp != 0x4a5bc60c {
+		t.Errorf("FunctionTable.Bound = %+v", ft.Bound)
+	}
+
+	// A garbage bound import directory does not hide the imports.
+	ti.dirs[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT] = DataDirectory{VirtualAddress: 0x5000, Size: 0x20}
+	ft, err = ti.open(t).LookupFunctionTable()
+	if err != nil {
+		t.Fatalf("LookupFunctionTable with an invalid bound import directory: %v", err)
+	}
+	if ft.Bound != nil || ft.BoundErr == nil {
+		t.Errorf("invalid bound import directory: Bound = %+v, BoundErr = %v", ft.Bound, ft.BoundErr)
+	}
+
+	dll := &File{FileHeader: FileHeader{TimeDateStamp: 0x4a5bc60f}}
+	if got[0].Stale(dll) || !got[1].Stale(dll) {
+		t.Error("Stale reports wrong bindings")
+	}
+}
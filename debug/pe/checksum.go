@@ -0,0 +1,75 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ComputeCheckSum computes the image checksum the way CheckSumMappedFile
+// does: the 16-bit one's complement sum of the file, with the CheckSum
+// field read as zero, plus the file length.
+func (f *File) ComputeCheckSum() (uint32, error) {
+	if f.OptionalHeader == nil {
+		return 0, errors.New("pe: image has no optional header")
+	}
+	size, err := f.fileSize()
+	if err != nil {
+		return 0, err
+	}
+	if size > 0xffffffff {
+		return 0, fmt.Errorf("pe: file size %d too large", size)
+	}
+	csOff := f.checkSumOffset()
+	var sum uint32
+	buf := make([]byte, 64*1024)
+	for off := int64(0); off < size; {
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		b := buf[:n]
+		if _, err := f.originalReader.ReadAt(b, off); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("fail to read image: %v", err)
+		}
+		// The buffer is even sized, so off stays 2-byte aligned.
+		for i := 0; i+1 < len(b); i += 2 {
+			if o := off + int64(i); o >= csOff && o < csOff+4 {
+				continue
+			}
+			sum += uint32(binary.LittleEndian.Uint16(b[i:]))
+			sum = (sum & 0xffff) + (sum >> 16)
+		}
+		if len(b)%2 != 0 {
+			sum += uint32(b[len(b)-1])
+			sum = (sum & 0xffff) + (sum >> 16)
+		}
+		off += n
+	}
+	return sum + uint32(size), nil
+}
+
+// VerifyCheckSum compares OptionalHeader.CheckSum with the computed
+// checksum. The loader only enforces the checksum of drivers and some
+// system images; many other images leave it zero, which is reported as
+// a mismatch too.
+func (f *File) VerifyCheckSum() error {
+	var want uint32
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		want = oh.CheckSum
+	case *OptionalHeader64:
+		want = oh.CheckSum
+	default:
+		return errors.New("pe: image has no optional header")
+	}
+	got, err := f.ComputeCheckSum()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("pe: checksum %#08x does not match computed %#08x", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pe
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestComputeCheckSum(t *testing.T) {
+	for _, tt := range []struct {
+		file string
+		want uint32
+	}{
+		{"testdata/gcc-386-mingw-exec", 84667},
+		{"testdata/gcc-386-mingw-no-symbols-exec", 21254},
+		{"testdata/gcc-amd64-mingw-exec", 290585},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.ComputeCheckSum()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+		} else if got != tt.want {
+			t.Errorf("%s: ComputeCheckSum = %d, want %d", tt.file, got, tt.want)
+		}
+		// The linker wrote the checksum of these images.
+		if err := f.VerifyCheckSum(); err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+		}
+		f.Close()
+	}
+}
+
+func TestVerifyCheckSumMismatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image has an odd length, so its last byte was summed as a
+	// word on its own; the appended byte becomes the high half of it.
+	data = append(data, 0x7f)
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.ComputeCheckSum(); got != 290585+0x7f00+1 {
+		t.Errorf("ComputeCheckSum = %d, want %d", got, 290585+0x7f00+1)
+	}
+	if err := f.VerifyCheckSum(); err == nil {
+		t.Error("VerifyCheckSum of modified image succeeded")
+	}
+}
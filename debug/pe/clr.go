@@ -0,0 +1,244 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// CLR header flags (COMIMAGE_FLAGS).
+const (
+	COMIMAGE_FLAGS_ILONLY            = 0x00000001
+	COMIMAGE_FLAGS_32BITREQUIRED     = 0x00000002
+	COMIMAGE_FLAGS_IL_LIBRARY        = 0x00000004
+	COMIMAGE_FLAGS_STRONGNAMESIGNED  = 0x00000008
+	COMIMAGE_FLAGS_NATIVE_ENTRYPOINT = 0x00000010
+	COMIMAGE_FLAGS_TRACKDEBUGDATA    = 0x00010000
+	COMIMAGE_FLAGS_32BITPREFERRED    = 0x00020000
+)
+
+// CLRHeader is the runtime header of a managed image
+// (IMAGE_COR20_HEADER).
+type CLRHeader struct {
+	Cb                      uint32
+	MajorRuntimeVersion     uint16
+	MinorRuntimeVersion     uint16
+	MetaData                DataDirectory
+	Flags                   uint32
+	EntryPointToken         uint32 // or the entry point RVA with COMIMAGE_FLAGS_NATIVE_ENTRYPOINT
+	Resources               DataDirectory
+	StrongNameSignature     DataDirectory
+	CodeManagerTable        DataDirectory
+	VTableFixups            DataDirectory
+	ExportAddressTableJumps DataDirectory
+	ManagedNativeHeader     DataDirectory
+}
+
+// LookupCLRHeader decodes the CLR header of the image. It returns nil
+// and no error if the image is not a managed image.
+func (f *File) LookupCLRHeader() (*CLRHeader, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read CLR header: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	h := &CLRHeader{}
+	if len(data) < binary.Size(h) {
+		return nil, fmt.Errorf("CLR header %d buffer size too small", len(data))
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, h); err != nil {
+		return nil, fmt.Errorf("fail to read CLR header: %v", err)
+	}
+	return h, nil
+}
+
+// metadataSignature is the signature of the metadata root, "BSJB".
+const metadataSignature = 0x424a5342
+
+// CLRStream is a stream header of the metadata root. Offset is relative
+// to the metadata root.
+type CLRStream struct {
+	Name   string
+	Offset uint32
+	Size   uint32
+}
+
+// CLRMetadata is the metadata of a managed image: the metadata root,
+// its heaps and the decoded tables.
+type CLRMetadata struct {
+	Header       *CLRHeader
+	MajorVersion uint16
+	MinorVersion uint16
+	Version      string // runtime version, such as "v4.0.30319"
+	Flags        uint16
+	Streams      []CLRStream
+	Tables       *MetadataTables
+
+	strings []byte
+	us      []byte
+	blob    []byte
+	guid    []byte
+}
+
+// LookupCLRMetadata decodes the metadata of a managed image. It returns
+// nil and no error if the image is not a managed image.
+func (f *File) LookupCLRMetadata() (*CLRMetadata, error) {
+	h, err := f.LookupCLRHeader()
+	if err != nil || h == nil {
+		return nil, err
+	}
+	if h.MetaData.VirtualAddress == 0 || h.MetaData.Size == 0 {
+		return nil, errors.New("CLR header has no metadata")
+	}
+	data, err := f.readRVA(h.MetaData.VirtualAddress, h.MetaData.Size)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read CLR metadata: %v", err)
+	}
+	md, err := parseCLRMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	md.Header = h
+	return md, nil
+}
+
+func parseCLRMetadata(data []byte) (*CLRMetadata, error) {
+	if len(data) < 16 || binary.LittleEndian.Uint32(data[0:4]) != metadataSignature {
+		return nil, errors.New("invalid CLR metadata signature")
+	}
+	md := &CLRMetadata{
+		MajorVersion: binary.LittleEndian.Uint16(data[4:6]),
+		MinorVersion: binary.LittleEndian.Uint16(data[6:8]),
+	}
+	n := binary.LittleEndian.Uint32(data[12:16])
+	if uint64(n) > uint64(len(data)-16) {
+		return nil, fmt.Errorf("CLR metadata version length %d out of range", n)
+	}
+	md.Version = cstring(data[16 : 16+n])
+	off := 16 + align4(int(n))
+	if off+4 > len(data) {
+		return nil, errors.New("CLR metadata root truncated")
+	}
+	md.Flags = binary.LittleEndian.Uint16(data[off:])
+	count := int(binary.LittleEndian.Uint16(data[off+2:]))
+	off += 4
+	var tables []byte
+	for i := 0; i < count; i++ {
+		if off+8 > len(data) {
+			return nil, fmt.Errorf("CLR stream header %d truncated", i)
+		}
+		s := CLRStream{
+			Offset: binary.LittleEndian.Uint32(data[off:]),
+			Size:   binary.LittleEndian.Uint32(data[off+4:]),
+		}
+		end := bytes.IndexByte(data[off+8:], 0)
+		if end < 0 || end > 32 {
+			return nil, fmt.Errorf("invalid CLR stream name at %#x", off+8)
+		}
+		s.Name = string(data[off+8 : off+8+end])
+		off += 8 + align4(end+1)
+		if uint64(s.Offset)+uint64(s.Size) > uint64(len(data)) {
+			return nil, fmt.Errorf("CLR stream %s out of metadata", s.Name)
+		}
+		md.Streams = append(md.Streams, s)
+		b := data[s.Offset : s.Offset+s.Size]
+		switch s.Name {
+		case "#Strings":
+			md.strings = b
+		case "#US":
+			md.us = b
+		case "#Blob":
+			md.blob = b
+		case "#GUID":
+			md.guid = b
+		case "#~", "#-":
+			tables = b
+		}
+	}
+	if tables != nil {
+		t, err := md.parseTables(tables)
+		if err != nil {
+			return nil, err
+		}
+		md.Tables = t
+	}
+	return md, nil
+}
+
+// String returns the string at index i of the #Strings heap.
+func (md *CLRMetadata) String(i uint32) (string, error) {
+	if uint64(i) >= uint64(len(md.strings)) {
+		if i == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("#Strings index %#x out of range", i)
+	}
+	return cstring(md.strings[i:]), nil
+}
+
+// Blob returns the blob at index i of the #Blob heap.
+func (md *CLRMetadata) Blob(i uint32) ([]byte, error) {
+	return heapBlob(md.blob, i, "#Blob")
+}
+
+// UserString returns the string literal at index i of the #US heap.
+func (md *CLRMetadata) UserString(i uint32) (string, error) {
+	b, err := heapBlob(md.us, i, "#US")
+	if err != nil {
+		return "", err
+	}
+	// The UTF-16 characters are followed by a flag byte.
+	u := make([]uint16, len(b)/2)
+	for j := range u {
+		u[j] = binary.LittleEndian.Uint16(b[2*j:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// GUID returns the GUID at the 1-based index i of the #GUID heap. The
+// index 0 stands for no GUID.
+func (md *CLRMetadata) GUID(i uint32) (GUID, error) {
+	var g GUID
+	if i == 0 {
+		return g, nil
+	}
+	if uint64(i)*16 > uint64(len(md.guid)) {
+		return g, fmt.Errorf("#GUID index %d out of range", i)
+	}
+	copy(g[:], md.guid[(i-1)*16:])
+	return g, nil
+}
+
+// heapBlob reads the length prefixed blob at index i of heap.
+func heapBlob(heap []byte, i uint32, name string) ([]byte, error) {
+	if uint64(i) >= uint64(len(heap)) {
+		if i == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s index %#x out of range", name, i)
+	}
+	n, size, ok := decodeCompressedUint(heap[i:])
+	if !ok || uint64(n) > uint64(len(heap)-int(i)-size) {
+		return nil, fmt.Errorf("invalid %s entry at %#x", name, i)
+	}
+	start := int(i) + size
+	return heap[start : start+int(n)], nil
+}
+
+// decodeCompressedUint decodes an ECMA-335 compressed unsigned integer
+// and returns it with its encoded size.
+func decodeCompressedUint(b []byte) (uint32, int, bool) {
+	switch {
+	case len(b) >= 1 && b[0]&0x80 == 0:
+		return uint32(b[0]), 1, true
+	case len(b) >= 2 && b[0]&0xc0 == 0x80:
+		return uint32(b[0]&0x3f)<<8 | uint32(b[1]), 2, true
+	case len(b) >= 4 && b[0]&0xe0 == 0xc0:
+		return uint32(b[0]&0x1f)<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), 4, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,225 @@
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testHeap builds a #Strings heap.
+type testHeap struct {
+	le
+	index map[string]uint16
+}
+
+func (h *testHeap) add(s string) uint16 {
+	if h.Len() == 0 {
+		h.u8(0)
+		h.index = map[string]uint16{"": 0}
+	}
+	if i, ok := h.index[s]; ok {
+		return i
+	}
+	i := uint16(h.Len())
+	h.index[s] = i
+	h.WriteString(s)
+	h.u8(0)
+	return i
+}
+
+// clrImage returns an image holding a COR20 header and the metadata of
+// a small assembly Demo, with a type Demo.Program and two methods.
+func clrImage() *testImage {
+	var strs testHeap
+	strs.add("")
+	var blob le
+	blob.u8(0)
+	blob.u8(3) // Main signature: default, no parameters, void
+	blob.Write([]byte{0x00, 0x00, 0x01})
+	blob.u8(8) // public key token
+	blob.Write([]byte{0xb0, 0x3f, 0x5f, 0x7f, 0x11, 0xd5, 0x0a, 0x3a})
+	var us le
+	us.u8(0)
+	us.u8(11)
+	us.utf16("Hello")
+	us.u8(0)
+	var guids le
+	guids.Write([]byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 0x12, 0x34, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc})
+
+	var tables le
+	tables.u32(0)
+	tables.u8(2)
+	tables.u8(0)
+	tables.u8(0) // HeapSizes: all heap indexes are 2 bytes
+	tables.u8(1)
+	valid := uint64(1)<<CLRTableModule | 1<<CLRTableTypeDef | 1<<CLRTableMethodDef |
+		1<<CLRTableModuleRef | 1<<CLRTableAssembly | 1<<CLRTableAssemblyRef
+	tables.u64(valid)
+	tables.u64(0)
+	for _, n := range []uint32{1, 2, 2, 1, 1, 1} {
+		tables.u32(n)
+	}
+	// Module
+	tables.u16(0)
+	tables.u16(strs.add("Demo.dll"))
+	tables.u16(1)
+	tables.u16(0)
+	tables.u16(0)
+	// TypeDef
+	tables.u32(0)
+	tables.u16(strs.add("<Module>"))
+	tables.u16(0)
+	tables.u16(0)
+	tables.u16(1)
+	tables.u16(1)
+	tables.u32(0x00100001) // public, beforefieldinit
+	tables.u16(strs.add("Program"))
+	tables.u16(strs.add("Demo"))
+	tables.u16(1<<2 | 1) // TypeRef row 1
+	tables.u16(1)
+	tables.u16(1)
+	// MethodDef
+	for _, name := range []string{"Main", ".ctor"} {
+		tables.u32(0x2050)
+		tables.u16(0)
+		tables.u16(0x0096)
+		tables.u16(strs.add(name))
+		tables.u16(1)
+		tables.u16(1)
+	}
+	// ModuleRef
+	tables.u16(strs.add("kernel32.dll"))
+	// Assembly
+	tables.u32(0x8004)
+	for _, v := range []uint16{1, 2, 3, 4} {
+		tables.u16(v)
+	}
+	tables.u32(0)
+	tables.u16(0)
+	tables.u16(strs.add("Demo"))
+	tables.u16(0)
+	// AssemblyRef
+	for _, v := range []uint16{8, 0, 0, 0} {
+		tables.u16(v)
+	}
+	tables.u32(0)
+	tables.u16(5)
+	tables.u16(strs.add("System.Runtime"))
+	tables.u16(0)
+	tables.u16(0)
+	tables.pad(align4(tables.Len()))
+	strs.pad(align4(strs.Len()))
+	blob.pad(align4(blob.Len()))
+	us.pad(align4(us.Len()))
+
+	streams := []struct {
+		name string
+		data []byte
+	}{
+		{"#~", tables.Bytes()},
+		{"#Strings", strs.Bytes()},
+		{"#US", us.Bytes()},
+		{"#GUID", guids.Bytes()},
+		{"#Blob", blob.Bytes()},
+	}
+	version := "v4.0.30319\x00\x00"
+	rootSize := 16 + len(version) + 4
+	for _, s := range streams {
+		rootSize += 8 + align4(len(s.name)+1)
+	}
+	var md le
+	md.u32(metadataSignature)
+	md.u16(1)
+	md.u16(1)
+	md.u32(0)
+	md.u32(uint32(len(version)))
+	md.WriteString(version)
+	md.u16(0)
+	md.u16(uint16(len(streams)))
+	off := rootSize
+	for _, s := range streams {
+		md.u32(uint32(off))
+		md.u32(uint32(len(s.data)))
+		md.WriteString(s.name)
+		md.pad(md.Len() + align4(len(s.name)+1) - len(s.name))
+		off += len(s.data)
+	}
+	for _, s := range streams {
+		md.Write(s.data)
+	}
+
+	var b le
+	b.u32(72)
+	b.u16(2)
+	b.u16(5)
+	b.u32(0x1048)
+	b.u32(uint32(md.Len()))
+	b.u32(COMIMAGE_FLAGS_ILONLY)
+	b.u32(0x06000001)
+	b.pad(72)
+	b.Write(md.Bytes())
+	return &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR: {VirtualAddress: 0x1000, Size: 72},
+		},
+		sections: []testSection{{name: ".text", va: 0x1000, data: b.Bytes()}},
+	}
+}
+
+func TestLookupCLRMetadata(t *testing.T) {
+	f := clrImage().open(t)
+	h, err := f.LookupCLRHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.MajorRuntimeVersion != 2 || h.Flags != COMIMAGE_FLAGS_ILONLY || h.EntryPointToken != 0x06000001 {
+		t.Errorf("CLR header = %+v", h)
+	}
+	md, err := f.LookupCLRMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Version != "v4.0.30319" || len(md.Streams) != 5 {
+		t.Errorf("metadata root = %q %v", md.Version, md.Streams)
+	}
+	if s, err := md.UserString(1); err != nil || s != "Hello" {
+		t.Errorf("UserString(1) = %q, %v", s, err)
+	}
+	if g, err := md.GUID(1); err != nil || g.String() != "{12345678-1234-1234-1234-123456789ABC}" {
+		t.Errorf("GUID(1) = %v, %v", g, err)
+	}
+
+	mt := md.Tables
+	if mt.Assembly == nil || mt.Assembly.Name != "Demo" || mt.Assembly.Version.String() != "1.2.3.4" {
+		t.Errorf("Assembly = %+v", mt.Assembly)
+	}
+	if len(mt.TypeDefs) != 2 || mt.TypeDefs[1].FullName() != "Demo.Program" || mt.TypeDefs[1].Extends != 0x01000001 {
+		t.Errorf("TypeDefs = %+v", mt.TypeDefs)
+	}
+	if ms := mt.Methods(1); len(ms) != 2 || ms[0].Name != "Main" || ms[1].Name != ".ctor" || !bytes.Equal(ms[0].Signature, []byte{0, 0, 1}) {
+		t.Errorf("Methods(1) = %+v", ms)
+	}
+	if ms := mt.Methods(0); len(ms) != 0 {
+		t.Errorf("Methods(0) = %+v", ms)
+	}
+	if len(mt.AssemblyRefs) != 1 {
+		t.Fatalf("AssemblyRefs = %+v", mt.AssemblyRefs)
+	}
+	ref := mt.AssemblyRefs[0]
+	if ref.Name != "System.Runtime" || ref.Version.Major != 8 || len(ref.PublicKeyOrToken) != 8 {
+		t.Errorf("AssemblyRefs[0] = %+v", ref)
+	}
+	if len(mt.ModuleRefs) != 1 || mt.ModuleRefs[0].Name != "kernel32.dll" {
+		t.Errorf("ModuleRefs = %+v", mt.ModuleRefs)
+	}
+}
+
+func TestLookupCLRMetadataNative(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if md, err := f.LookupCLRMetadata(); md != nil || err != nil {
+		t.Errorf("LookupCLRMetadata of native image = %v, %v", md, err)
+	}
+}
@@ -0,0 +1,430 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Metadata table numbers (ECMA-335 II.22).
+const (
+	CLRTableModule                 = 0x00
+	CLRTableTypeRef                = 0x01
+	CLRTableTypeDef                = 0x02
+	CLRTableFieldPtr               = 0x03
+	CLRTableField                  = 0x04
+	CLRTableMethodPtr              = 0x05
+	CLRTableMethodDef              = 0x06
+	CLRTableParamPtr               = 0x07
+	CLRTableParam                  = 0x08
+	CLRTableInterfaceImpl          = 0x09
+	CLRTableMemberRef              = 0x0a
+	CLRTableConstant               = 0x0b
+	CLRTableCustomAttribute        = 0x0c
+	CLRTableFieldMarshal           = 0x0d
+	CLRTableDeclSecurity           = 0x0e
+	CLRTableClassLayout            = 0x0f
+	CLRTableFieldLayout            = 0x10
+	CLRTableStandAloneSig          = 0x11
+	CLRTableEventMap               = 0x12
+	CLRTableEventPtr               = 0x13
+	CLRTableEvent                  = 0x14
+	CLRTablePropertyMap            = 0x15
+	CLRTablePropertyPtr            = 0x16
+	CLRTableProperty               = 0x17
+	CLRTableMethodSemantics        = 0x18
+	CLRTableMethodImpl             = 0x19
+	CLRTableModuleRef              = 0x1a
+	CLRTableTypeSpec               = 0x1b
+	CLRTableImplMap                = 0x1c
+	CLRTableFieldRVA               = 0x1d
+	CLRTableENCLog                 = 0x1e
+	CLRTableENCMap                 = 0x1f
+	CLRTableAssembly               = 0x20
+	CLRTableAssemblyProcessor      = 0x21
+	CLRTableAssemblyOS             = 0x22
+	CLRTableAssemblyRef            = 0x23
+	CLRTableAssemblyRefProcessor   = 0x24
+	CLRTableAssemblyRefOS          = 0x25
+	CLRTableFile                   = 0x26
+	CLRTableExportedType           = 0x27
+	CLRTableManifestResource       = 0x28
+	CLRTableNestedClass            = 0x29
+	CLRTableGenericParam           = 0x2a
+	CLRTableMethodSpec             = 0x2b
+	CLRTableGenericParamConstraint = 0x2c
+)
+
+// Column kinds of the table schema. A simple index into table t is
+// colTable+t, a coded index c is colCoded+c.
+const (
+	colU16 = iota
+	colU32
+	colString
+	colGUID
+	colBlob
+	colTable = 0x40
+	colCoded = 0x80
+)
+
+// Coded index kinds (ECMA-335 II.24.2.6).
+const (
+	codedTypeDefOrRef = iota
+	codedHasConstant
+	codedHasCustomAttribute
+	codedHasFieldMarshal
+	codedHasDeclSecurity
+	codedMemberRefParent
+	codedHasSemantics
+	codedMethodDefOrRef
+	codedMemberForwarded
+	codedImplementation
+	codedCustomAttributeType
+	codedResolutionScope
+	codedTypeOrMethodDef
+)
+
+// codedIndexes lists the tables of each coded index kind, in tag order.
+// -1 marks unused tags.
+var codedIndexes = [...]struct {
+	bits   uint
+	tables []int
+}{
+	codedTypeDefOrRef:        {2, []int{CLRTableTypeDef, CLRTableTypeRef, CLRTableTypeSpec}},
+	codedHasConstant:         {2, []int{CLRTableField, CLRTableParam, CLRTableProperty}},
+	codedHasCustomAttribute:  {5, []int{CLRTableMethodDef, CLRTableField, CLRTableTypeRef, CLRTableTypeDef, CLRTableParam, CLRTableInterfaceImpl, CLRTableMemberRef, CLRTableModule, CLRTableDeclSecurity, CLRTableProperty, CLRTableEvent, CLRTableStandAloneSig, CLRTableModuleRef, CLRTableTypeSpec, CLRTableAssembly, CLRTableAssemblyRef, CLRTableFile, CLRTableExportedType, CLRTableManifestResource, CLRTableGenericParam, CLRTableGenericParamConstraint, CLRTableMethodSpec}},
+	codedHasFieldMarshal:     {1, []int{CLRTableField, CLRTableParam}},
+	codedHasDeclSecurity:     {2, []int{CLRTableTypeDef, CLRTableMethodDef, CLRTableAssembly}},
+	codedMemberRefParent:     {3, []int{CLRTableTypeDef, CLRTableTypeRef, CLRTableModuleRef, CLRTableMethodDef, CLRTableTypeSpec}},
+	codedHasSemantics:        {1, []int{CLRTableEvent, CLRTableProperty}},
+	codedMethodDefOrRef:      {1, []int{CLRTableMethodDef, CLRTableMemberRef}},
+	codedMemberForwarded:     {1, []int{CLRTableField, CLRTableMethodDef}},
+	codedImplementation:      {2, []int{CLRTableFile, CLRTableAssemblyRef, CLRTableExportedType}},
+	codedCustomAttributeType: {3, []int{-1, -1, CLRTableMethodDef, CLRTableMemberRef, -1}},
+	codedResolutionScope:     {2, []int{CLRTableModule, CLRTableModuleRef, CLRTableAssemblyRef, CLRTableTypeRef}},
+	codedTypeOrMethodDef:     {1, []int{CLRTableTypeDef, CLRTableMethodDef}},
+}
+
+// tableSchema lists the column kinds of each metadata table.
+var tableSchema = [...][]int{
+	CLRTableModule:                 {colU16, colString, colGUID, colGUID, colGUID},
+	CLRTableTypeRef:                {colCoded + codedResolutionScope, colString, colString},
+	CLRTableTypeDef:                {colU32, colString, colString, colCoded + codedTypeDefOrRef, colTable + CLRTableField, colTable + CLRTableMethodDef},
+	CLRTableFieldPtr:               {colTable + CLRTableField},
+	CLRTableField:                  {colU16, colString, colBlob},
+	CLRTableMethodPtr:              {colTable + CLRTableMethodDef},
+	CLRTableMethodDef:              {colU32, colU16, colU16, colString, colBlob, colTable + CLRTableParam},
+	CLRTableParamPtr:               {colTable + CLRTableParam},
+	CLRTableParam:                  {colU16, colU16, colString},
+	CLRTableInterfaceImpl:          {colTable + CLRTableTypeDef, colCoded + codedTypeDefOrRef},
+	CLRTableMemberRef:              {colCoded + codedMemberRefParent, colString, colBlob},
+	CLRTableConstant:               {colU16, colCoded + codedHasConstant, colBlob},
+	CLRTableCustomAttribute:        {colCoded + codedHasCustomAttribute, colCoded + codedCustomAttributeType, colBlob},
+	CLRTableFieldMarshal:           {colCoded + codedHasFieldMarshal, colBlob},
+	CLRTableDeclSecurity:           {colU16, colCoded + codedHasDeclSecurity, colBlob},
+	CLRTableClassLayout:            {colU16, colU32, colTable + CLRTableTypeDef},
+	CLRTableFieldLayout:            {colU32, colTable + CLRTableField},
+	CLRTableStandAloneSig:          {colBlob},
+	CLRTableEventMap:               {colTable + CLRTableTypeDef, colTable + CLRTableEvent},
+	CLRTableEventPtr:               {colTable + CLRTableEvent},
+	CLRTableEvent:                  {colU16, colString, colCoded + codedTypeDefOrRef},
+	CLRTablePropertyMap:            {colTable + CLRTableTypeDef, colTable + CLRTableProperty},
+	CLRTablePropertyPtr:            {colTable + CLRTableProperty},
+	CLRTableProperty:               {colU16, colString, colBlob},
+	CLRTableMethodSemantics:        {colU16, colTable + CLRTableMethodDef, colCoded + codedHasSemantics},
+	CLRTableMethodImpl:             {colTable + CLRTableTypeDef, colCoded + codedMethodDefOrRef, colCoded + codedMethodDefOrRef},
+	CLRTableModuleRef:              {colString},
+	CLRTableTypeSpec:               {colBlob},
+	CLRTableImplMap:                {colU16, colCoded + codedMemberForwarded, colString, colTable + CLRTableModuleRef},
+	CLRTableFieldRVA:               {colU32, colTable + CLRTableField},
+	CLRTableENCLog:                 {colU32, colU32},
+	CLRTableENCMap:                 {colU32},
+	CLRTableAssembly:               {colU32, colU16, colU16, colU16, colU16, colU32, colBlob, colString, colString},
+	CLRTableAssemblyProcessor:      {colU32},
+	CLRTableAssemblyOS:             {colU32, colU32, colU32},
+	CLRTableAssemblyRef:            {colU16, colU16, colU16, colU16, colU32, colBlob, colString, colString, colBlob},
+	CLRTableAssemblyRefProcessor:   {colU32, colTable + CLRTableAssemblyRef},
+	CLRTableAssemblyRefOS:          {colU32, colU32, colU32, colTable + CLRTableAssemblyRef},
+	CLRTableFile:                   {colU32, colString, colBlob},
+	CLRTableExportedType:           {colU32, colU32, colString, colString, colCoded + codedImplementation},
+	CLRTableManifestResource:       {colU32, colU32, colString, colCoded + codedImplementation},
+	CLRTableNestedClass:            {colTable + CLRTableTypeDef, colTable + CLRTableTypeDef},
+	CLRTableGenericParam:           {colU16, colU16, colCoded + codedTypeOrMethodDef, colString},
+	CLRTableMethodSpec:             {colCoded + codedMethodDefOrRef, colBlob},
+	CLRTableGenericParamConstraint: {colTable + CLRTableGenericParam, colCoded + codedTypeDefOrRef},
+}
+
+// TypeDef is a row of the TypeDef table.
+type TypeDef struct {
+	Flags      uint32
+	Name       string
+	Namespace  string
+	Extends    uint32 // token of the base type, 0 if none
+	FieldList  uint32 // first row of the Field table
+	MethodList uint32 // first row of the MethodDef table
+}
+
+// FullName returns the namespace qualified name of the type.
+func (t *TypeDef) FullName() string {
+	if t.Namespace == "" {
+		return t.Name
+	}
+	return t.Namespace + "." + t.Name
+}
+
+// MethodDef is a row of the MethodDef table.
+type MethodDef struct {
+	RVA       uint32
+	ImplFlags uint16
+	Flags     uint16
+	Name      string
+	Signature []byte
+	ParamList uint32 // first row of the Param table
+}
+
+// AssemblyDef is the row of the Assembly table, the identity of the
+// assembly.
+type AssemblyDef struct {
+	HashAlgID uint32
+	Version   Version
+	Flags     uint32
+	PublicKey []byte
+	Name      string
+	Culture   string
+}
+
+// AssemblyRef is a row of the AssemblyRef table, an assembly the image
+// references.
+type AssemblyRef struct {
+	Version          Version
+	Flags            uint32
+	PublicKeyOrToken []byte
+	Name             string
+	Culture          string
+	HashValue        []byte
+}
+
+// ModuleRef is a row of the ModuleRef table: a module of the assembly or
+// a native library called through P/Invoke.
+type ModuleRef struct {
+	Name string
+}
+
+// MetadataTables is the decoded #~ stream.
+type MetadataTables struct {
+	MajorVersion uint8
+	MinorVersion uint8
+	HeapSizes    uint8
+	Valid        uint64 // bit mask of the present tables
+	Sorted       uint64 // bit mask of the sorted tables
+	Rows         [64]uint32
+
+	Assembly     *AssemblyDef // nil for a module that is not an assembly
+	TypeDefs     []TypeDef
+	MethodDefs   []MethodDef
+	AssemblyRefs []AssemblyRef
+	ModuleRefs   []ModuleRef
+}
+
+// Methods returns the methods of TypeDefs[i]: the rows from its
+// MethodList up to the MethodList of the next type.
+func (mt *MetadataTables) Methods(i int) []MethodDef {
+	start := mt.TypeDefs[i].MethodList
+	end := uint32(len(mt.MethodDefs)) + 1
+	if i+1 < len(mt.TypeDefs) {
+		end = mt.TypeDefs[i+1].MethodList
+	}
+	if start == 0 || start > end || end > uint32(len(mt.MethodDefs))+1 {
+		return nil
+	}
+	return mt.MethodDefs[start-1 : end-1]
+}
+
+// tableReader reads the rows of the #~ stream.
+type tableReader struct {
+	rows    *[64]uint32
+	heaps   uint8
+	offsets [64]int // offset of each table in the stream
+	sizes   [64]int // row size of each table
+	data    []byte
+}
+
+func (r *tableReader) columnSize(col int) int {
+	switch {
+	case col == colU16:
+		return 2
+	case col == colU32:
+		return 4
+	case col == colString:
+		return 2 + 2*int(r.heaps&0x01)
+	case col == colGUID:
+		return 2 + int(r.heaps&0x02)
+	case col == colBlob:
+		return 2 + int(r.heaps&0x04)/2
+	case col >= colCoded:
+		c := codedIndexes[col-colCoded]
+		var max uint32
+		for _, t := range c.tables {
+			if t >= 0 && r.rows[t] > max {
+				max = r.rows[t]
+			}
+		}
+		if max < 1<<(16-c.bits) {
+			return 2
+		}
+		return 4
+	default:
+		if r.rows[col-colTable] < 1<<16 {
+			return 2
+		}
+		return 4
+	}
+}
+
+// row decodes the 1-based row i of table t into its column values.
+// Coded indexes are converted to tokens.
+func (r *tableReader) row(t int, i uint32) ([]uint32, error) {
+	if i == 0 || i > r.rows[t] {
+		return nil, fmt.Errorf("metadata table %#x row %d out of range", t, i)
+	}
+	off := r.offsets[t] + int(i-1)*r.sizes[t]
+	cols := tableSchema[t]
+	vals := make([]uint32, len(cols))
+	for j, col := range cols {
+		size := r.columnSize(col)
+		var v uint32
+		if size == 2 {
+			v = uint32(binary.LittleEndian.Uint16(r.data[off:]))
+		} else {
+			v = binary.LittleEndian.Uint32(r.data[off:])
+		}
+		off += size
+		if col >= colCoded {
+			c := codedIndexes[col-colCoded]
+			tag := v & (1<<c.bits - 1)
+			if v>>c.bits != 0 && int(tag) < len(c.tables) && c.tables[tag] >= 0 {
+				v = uint32(c.tables[tag])<<24 | v>>c.bits
+			} else {
+				v = 0
+			}
+		}
+		vals[j] = v
+	}
+	return vals, nil
+}
+
+func (md *CLRMetadata) parseTables(data []byte) (*MetadataTables, error) {
+	if len(data) < 24 {
+		return nil, fmt.Errorf("metadata tables %d buffer size too small", len(data))
+	}
+	mt := &MetadataTables{
+		MajorVersion: data[4],
+		MinorVersion: data[5],
+		HeapSizes:    data[6],
+		Valid:        binary.LittleEndian.Uint64(data[8:16]),
+		Sorted:       binary.LittleEndian.Uint64(data[16:24]),
+	}
+	off := 24
+	for t := 0; t < 64; t++ {
+		if mt.Valid&(1<<t) == 0 {
+			continue
+		}
+		if t >= len(tableSchema) {
+			return nil, fmt.Errorf("unknown metadata table %#x", t)
+		}
+		if off+4 > len(data) {
+			return nil, errors.New("metadata table row counts truncated")
+		}
+		mt.Rows[t] = binary.LittleEndian.Uint32(data[off:])
+		off += 4
+	}
+	if mt.HeapSizes&0x40 != 0 {
+		// Edit and continue deltas carry extra data after the row counts.
+		off += 4
+	}
+	r := &tableReader{rows: &mt.Rows, heaps: mt.HeapSizes, data: data}
+	for t := range tableSchema {
+		for _, col := range tableSchema[t] {
+			r.sizes[t] += r.columnSize(col)
+		}
+		r.offsets[t] = off
+		n := uint64(r.sizes[t]) * uint64(mt.Rows[t])
+		if n > uint64(len(data)-off) {
+			return nil, fmt.Errorf("metadata table %#x out of stream", t)
+		}
+		off += int(n)
+	}
+
+	var err error
+	str := func(i uint32) string {
+		s, e := md.String(i)
+		if e != nil && err == nil {
+			err = e
+		}
+		return s
+	}
+	blob := func(i uint32) []byte {
+		b, e := md.Blob(i)
+		if e != nil && err == nil {
+			err = e
+		}
+		return b
+	}
+	rows := func(t int, fn func(v []uint32)) {
+		for i := uint32(1); i <= mt.Rows[t] && err == nil; i++ {
+			v, e := r.row(t, i)
+			if e != nil {
+				err = e
+				return
+			}
+			fn(v)
+		}
+	}
+	rows(CLRTableAssembly, func(v []uint32) {
+		mt.Assembly = &AssemblyDef{
+			HashAlgID: v[0],
+			Version:   Version{uint16(v[1]), uint16(v[2]), uint16(v[3]), uint16(v[4])},
+			Flags:     v[5],
+			PublicKey: blob(v[6]),
+			Name:      str(v[7]),
+			Culture:   str(v[8]),
+		}
+	})
+	rows(CLRTableTypeDef, func(v []uint32) {
+		mt.TypeDefs = append(mt.TypeDefs, TypeDef{
+			Flags:      v[0],
+			Name:       str(v[1]),
+			Namespace:  str(v[2]),
+			Extends:    v[3],
+			FieldList:  v[4],
+			MethodList: v[5],
+		})
+	})
+	rows(CLRTableMethodDef, func(v []uint32) {
+		mt.MethodDefs = append(mt.MethodDefs, MethodDef{
+			RVA:       v[0],
+			ImplFlags: uint16(v[1]),
+			Flags:     uint16(v[2]),
+			Name:      str(v[3]),
+			Signature: blob(v[4]),
+			ParamList: v[5],
+		})
+	})
+	rows(CLRTableAssemblyRef, func(v []uint32) {
+		mt.AssemblyRefs = append(mt.AssemblyRefs, AssemblyRef{
+			Version:          Version{uint16(v[0]), uint16(v[1]), uint16(v[2]), uint16(v[3])},
+			Flags:            v[4],
+			PublicKeyOrToken: blob(v[5]),
+			Name:             str(v[6]),
+			Culture:          str(v[7]),
+			HashValue:        blob(v[8]),
+		})
+	})
+	rows(CLRTableModuleRef, func(v []uint32) {
+		mt.ModuleRefs = append(mt.ModuleRefs, ModuleRef{Name: str(v[0])})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail to read metadata tables: %v", err)
+	}
+	return mt, nil
+}
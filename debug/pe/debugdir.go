@@ -0,0 +1,321 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// Debug directory entry types.
+const (
+	IMAGE_DEBUG_TYPE_UNKNOWN               = 0
+	IMAGE_DEBUG_TYPE_COFF                  = 1
+	IMAGE_DEBUG_TYPE_CODEVIEW              = 2
+	IMAGE_DEBUG_TYPE_FPO                   = 3
+	IMAGE_DEBUG_TYPE_MISC                  = 4
+	IMAGE_DEBUG_TYPE_EXCEPTION             = 5
+	IMAGE_DEBUG_TYPE_FIXUP                 = 6
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC           = 7
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC         = 8
+	IMAGE_DEBUG_TYPE_BORLAND               = 9
+	IMAGE_DEBUG_TYPE_RESERVED10            = 10
+	IMAGE_DEBUG_TYPE_CLSID                 = 11
+	IMAGE_DEBUG_TYPE_VC_FEATURE            = 12
+	IMAGE_DEBUG_TYPE_POGO                  = 13
+	IMAGE_DEBUG_TYPE_ILTCG                 = 14
+	IMAGE_DEBUG_TYPE_MPX                   = 15
+	IMAGE_DEBUG_TYPE_REPRO                 = 16
+	IMAGE_DEBUG_TYPE_EMBEDDED_PORTABLE_PDB = 17
+	IMAGE_DEBUG_TYPE_SPGO                  = 18
+	IMAGE_DEBUG_TYPE_PDBCHECKSUM           = 19
+	IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS = 20
+)
+
+// Extended DLL characteristics, found in an
+// IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS entry.
+const (
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT                                 = 0x01
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT_STRICT_MODE                     = 0x02
+	IMAGE_DLLCHARACTERISTICS_EX_CET_SET_CONTEXT_IP_VALIDATION_RELAXED_MODE = 0x04
+	IMAGE_DLLCHARACTERISTICS_EX_CET_DYNAMIC_APIS_ALLOW_IN_PROC             = 0x08
+	IMAGE_DLLCHARACTERISTICS_EX_FORWARD_CFI_COMPAT                         = 0x40
+	IMAGE_DLLCHARACTERISTICS_EX_HOTPATCH_COMPATIBLE                        = 0x80
+)
+
+// GUID is a Windows GUID in its in-memory layout: the first three
+// fields are little-endian.
+type GUID [16]byte
+
+// String formats g as {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}.
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+// DebugDirectory is an entry of the debug directory
+// (IMAGE_DEBUG_DIRECTORY).
+type DebugDirectory struct {
+	Characteristics  uint32
+	TimeDateStamp    uint32
+	MajorVersion     uint16
+	MinorVersion     uint16
+	Type             uint32
+	SizeOfData       uint32
+	AddressOfRawData uint32 // RVA of the data, 0 if it is not mapped
+	PointerToRawData uint32 // file offset of the data
+
+	f *File
+}
+
+const debugDirectorySize = 28
+
+// maxDebugDataSize bounds the data of a debug directory entry.
+const maxDebugDataSize = 1 << 24
+
+// LookupDebugDirectories decodes the entries of the debug directory.
+// It returns nil and no error if the image has none.
+func (f *File) LookupDebugDirectories() ([]*DebugDirectory, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read debug directory: %v", err)
+	}
+	var dirs []*DebugDirectory
+	for ; len(data) >= debugDirectorySize; data = data[debugDirectorySize:] {
+		dirs = append(dirs, &DebugDirectory{
+			Characteristics:  binary.LittleEndian.Uint32(data[0:4]),
+			TimeDateStamp:    binary.LittleEndian.Uint32(data[4:8]),
+			MajorVersion:     binary.LittleEndian.Uint16(data[8:10]),
+			MinorVersion:     binary.LittleEndian.Uint16(data[10:12]),
+			Type:             binary.LittleEndian.Uint32(data[12:16]),
+			SizeOfData:       binary.LittleEndian.Uint32(data[16:20]),
+			AddressOfRawData: binary.LittleEndian.Uint32(data[20:24]),
+			PointerToRawData: binary.LittleEndian.Uint32(data[24:28]),
+			f:                f,
+		})
+	}
+	return dirs, nil
+}
+
+// Data reads the data of the debug directory entry d, from the image if
+// it is mapped and from the file otherwise.
+func (d *DebugDirectory) Data() ([]byte, error) {
+	if d.SizeOfData > maxDebugDataSize {
+		return nil, fmt.Errorf("debug data size %d too large", d.SizeOfData)
+	}
+	if d.AddressOfRawData != 0 {
+		return d.f.readRVA(d.AddressOfRawData, d.SizeOfData)
+	}
+	if d.f.originalReader == nil {
+		return nil, fmt.Errorf("debug data at file offset %#x is not mapped", d.PointerToRawData)
+	}
+	return saferio.ReadDataAt(d.f.originalReader, uint64(d.SizeOfData), int64(d.PointerToRawData))
+}
+
+// CodeView signatures.
+const (
+	CVSignatureRSDS = 0x53445352 // "RSDS", PDB 7.0
+	CVSignatureNB10 = 0x3031424e // "NB10", PDB 2.0
+)
+
+// CodeViewInfo is a decoded CodeView record of a debug directory entry
+// of type IMAGE_DEBUG_TYPE_CODEVIEW.
+type CodeViewInfo struct {
+	Signature uint32 // CVSignatureRSDS or CVSignatureNB10
+	GUID      GUID   // PDB 7.0 only
+	PDBSig    uint32 // PDB 2.0 only
+	Age       uint32
+	PDBPath   string
+}
+
+// SymbolServerKey returns the key a symbol server stores the PDB under,
+// the GUID (or the PDB 2.0 signature) followed by the age, in hex.
+func (cv *CodeViewInfo) SymbolServerKey() string {
+	if cv.Signature == CVSignatureNB10 {
+		return fmt.Sprintf("%08X%X", cv.PDBSig, cv.Age)
+	}
+	s := cv.GUID.String()
+	return strings.NewReplacer("{", "", "}", "", "-", "").Replace(s) + fmt.Sprintf("%X", cv.Age)
+}
+
+// CodeView decodes the CodeView record of d.
+func (d *DebugDirectory) CodeView() (*CodeViewInfo, error) {
+	if d.Type != IMAGE_DEBUG_TYPE_CODEVIEW {
+		return nil, fmt.Errorf("debug directory type %d is not CODEVIEW", d.Type)
+	}
+	b, err := d.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read CodeView record: %v", err)
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("CodeView record %d buffer size too small", len(b))
+	}
+	cv := &CodeViewInfo{Signature: binary.LittleEndian.Uint32(b)}
+	switch cv.Signature {
+	case CVSignatureRSDS:
+		if len(b) < 24 {
+			return nil, fmt.Errorf("RSDS record %d buffer size too small", len(b))
+		}
+		copy(cv.GUID[:], b[4:20])
+		cv.Age = binary.LittleEndian.Uint32(b[20:24])
+		cv.PDBPath = cstring(b[24:])
+	case CVSignatureNB10:
+		if len(b) < 16 {
+			return nil, fmt.Errorf("NB10 record %d buffer size too small", len(b))
+		}
+		cv.PDBSig = binary.LittleEndian.Uint32(b[8:12])
+		cv.Age = binary.LittleEndian.Uint32(b[12:16])
+		cv.PDBPath = cstring(b[16:])
+	default:
+		return nil, fmt.Errorf("unknown CodeView signature %#x", cv.Signature)
+	}
+	return cv, nil
+}
+
+// LookupCodeView returns the first CodeView record of the debug
+// directory. It returns nil and no error if the image has none.
+func (f *File) LookupCodeView() (*CodeViewInfo, error) {
+	dirs, err := f.LookupDebugDirectories()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if d.Type == IMAGE_DEBUG_TYPE_CODEVIEW {
+			return d.CodeView()
+		}
+	}
+	return nil, nil
+}
+
+// POGO signatures.
+const (
+	POGOSignatureLTCG = 0x4c544347 // "LTCG"
+	POGOSignaturePGI  = 0x50474900 // "PGI\0", instrumented build
+	POGOSignaturePGO  = 0x50474f00 // "PGO\0", optimized build
+	POGOSignaturePGU  = 0x50475500 // "PGU\0", optimized build with an updated profile
+)
+
+// POGOEntry describes a section contribution listed in POGO data.
+type POGOEntry struct {
+	RVA  uint32
+	Size uint32
+	Name string
+}
+
+// POGOInfo is the decoded data of an IMAGE_DEBUG_TYPE_POGO entry.
+type POGOInfo struct {
+	Signature uint32
+	Entries   []POGOEntry
+}
+
+// POGO decodes the profile guided optimization data of d.
+func (d *DebugDirectory) POGO() (*POGOInfo, error) {
+	if d.Type != IMAGE_DEBUG_TYPE_POGO {
+		return nil, fmt.Errorf("debug directory type %d is not POGO", d.Type)
+	}
+	b, err := d.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read POGO data: %v", err)
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("POGO data %d buffer size too small", len(b))
+	}
+	p := &POGOInfo{Signature: binary.LittleEndian.Uint32(b)}
+	b = b[4:]
+	for len(b) >= 8 {
+		e := POGOEntry{
+			RVA:  binary.LittleEndian.Uint32(b[0:4]),
+			Size: binary.LittleEndian.Uint32(b[4:8]),
+		}
+		b = b[8:]
+		n := bytes.IndexByte(b, 0)
+		if n < 0 {
+			return nil, fmt.Errorf("POGO entry name at %#x not terminated", e.RVA)
+		}
+		e.Name = string(b[:n])
+		p.Entries = append(p.Entries, e)
+		// Names are padded to 32 bits, including the terminator.
+		if n = align4(n + 1); n > len(b) {
+			n = len(b)
+		}
+		b = b[n:]
+	}
+	return p, nil
+}
+
+// Repro returns the hash that identifies a reproducible build. Old
+// linkers store no data and put the hash in TimeDateStamp, in which case
+// Repro returns nil.
+func (d *DebugDirectory) Repro() ([]byte, error) {
+	if d.Type != IMAGE_DEBUG_TYPE_REPRO {
+		return nil, fmt.Errorf("debug directory type %d is not REPRO", d.Type)
+	}
+	if d.SizeOfData == 0 {
+		return nil, nil
+	}
+	b, err := d.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read REPRO data: %v", err)
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("REPRO data %d buffer size too small", len(b))
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, fmt.Errorf("REPRO hash size %d too large", n)
+	}
+	return b[4 : 4+n], nil
+}
+
+// VCFeature holds the counts of an IMAGE_DEBUG_TYPE_VC_FEATURE entry:
+// the number of object files built with compilers predating VC++ 11, by
+// the C/C++ compiler, with /GS, with /sdl and with /guard:N.
+type VCFeature struct {
+	PreVCPP11 uint32
+	CCPP      uint32
+	GS        uint32
+	SDL       uint32
+	GuardN    uint32
+}
+
+// VCFeature decodes the compiler feature counts of d.
+func (d *DebugDirectory) VCFeature() (*VCFeature, error) {
+	if d.Type != IMAGE_DEBUG_TYPE_VC_FEATURE {
+		return nil, fmt.Errorf("debug directory type %d is not VC_FEATURE", d.Type)
+	}
+	b, err := d.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read VC_FEATURE data: %v", err)
+	}
+	if len(b) < 20 {
+		return nil, fmt.Errorf("VC_FEATURE data %d buffer size too small", len(b))
+	}
+	return &VCFeature{
+		PreVCPP11: binary.LittleEndian.Uint32(b[0:4]),
+		CCPP:      binary.LittleEndian.Uint32(b[4:8]),
+		GS:        binary.LittleEndian.Uint32(b[8:12]),
+		SDL:       binary.LittleEndian.Uint32(b[12:16]),
+		GuardN:    binary.LittleEndian.Uint32(b[16:20]),
+	}, nil
+}
+
+// ExDllCharacteristics returns the IMAGE_DLLCHARACTERISTICS_EX flags of
+// an IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS entry.
+func (d *DebugDirectory) ExDllCharacteristics() (uint32, error) {
+	if d.Type != IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS {
+		return 0, fmt.Errorf("debug directory type %d is not EX_DLLCHARACTERISTICS", d.Type)
+	}
+	b, err := d.Data()
+	if err != nil {
+		return 0, fmt.Errorf("fail to read EX_DLLCHARACTERISTICS data: %v", err)
+	}
+	if len(b) < 4 {
+		return 0, fmt.Errorf("EX_DLLCHARACTERISTICS data %d buffer size too small", len(b))
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
@@ -0,0 +1,104 @@
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLookupDebugDirectories(t *testing.T) {
+	guid := GUID{0x78, 0x56, 0x34, 0x12, 0xbc, 0x9a, 0xf0, 0xde, 1, 2, 3, 4, 5, 6, 7, 8}
+	var b le
+	entry := func(typ, size, rva uint32) {
+		b.u32(0)
+		b.u32(0x5f000000)
+		b.u16(0)
+		b.u16(0)
+		b.u32(typ)
+		b.u32(size)
+		b.u32(rva)
+		b.u32(0)
+	}
+	entry(IMAGE_DEBUG_TYPE_CODEVIEW, uint32(24+len("c:\\src\\app.pdb")+1), 0x2100)
+	entry(IMAGE_DEBUG_TYPE_POGO, 4+8+8+8+12, 0x2200)
+	entry(IMAGE_DEBUG_TYPE_REPRO, 4+4, 0x2300)
+	entry(IMAGE_DEBUG_TYPE_VC_FEATURE, 20, 0x2340)
+	entry(IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS, 4, 0x2380)
+	b.pad(0x100)
+	b.u32(CVSignatureRSDS)
+	b.Write(guid[:])
+	b.u32(3)
+	b.WriteString("c:\\src\\app.pdb\x00")
+	b.pad(0x200)
+	b.u32(POGOSignaturePGU)
+	b.u32(0x1000)
+	b.u32(0x20)
+	b.WriteString(".text\x00\x00\x00")
+	b.u32(0x1020)
+	b.u32(0x10)
+	b.WriteString(".text$mn\x00\x00\x00\x00")
+	b.pad(0x300)
+	b.u32(4)
+	b.WriteString("hash")
+	b.pad(0x340)
+	for i := uint32(1); i <= 5; i++ {
+		b.u32(i)
+	}
+	b.pad(0x380)
+	b.u32(IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT)
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_DEBUG: {VirtualAddress: 0x2000, Size: 5 * 28},
+		},
+		sections: []testSection{{name: ".rdata", va: 0x2000, data: b.Bytes()}},
+	}
+	f := ti.open(t)
+	dirs, err := f.LookupDebugDirectories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 5 {
+		t.Fatalf("got %d debug directories, want 5", len(dirs))
+	}
+
+	cv, err := f.LookupCodeView()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv.GUID != guid || cv.Age != 3 || cv.PDBPath != "c:\\src\\app.pdb" {
+		t.Errorf("CodeView = %+v", cv)
+	}
+	if got, want := cv.GUID.String(), "{12345678-9ABC-DEF0-0102-030405060708}"; got != want {
+		t.Errorf("GUID = %s, want %s", got, want)
+	}
+	if got, want := cv.SymbolServerKey(), "123456789ABCDEF001020304050607083"; got != want {
+		t.Errorf("SymbolServerKey = %s, want %s", got, want)
+	}
+
+	p, err := dirs[1].POGO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Signature != POGOSignaturePGU || len(p.Entries) != 2 || p.Entries[0].Name != ".text" || p.Entries[1] != (POGOEntry{0x1020, 0x10, ".text$mn"}) {
+		t.Errorf("POGO = %+v", p)
+	}
+
+	h, err := dirs[2].Repro()
+	if err != nil || !bytes.Equal(h, []byte("hash")) {
+		t.Errorf("Repro = %q, %v", h, err)
+	}
+
+	vc, err := dirs[3].VCFeature()
+	if err != nil || *vc != (VCFeature{1, 2, 3, 4, 5}) {
+		t.Errorf("VCFeature = %+v, %v", vc, err)
+	}
+
+	ex, err := dirs[4].ExDllCharacteristics()
+	if err != nil || ex != IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT {
+		t.Errorf("ExDllCharacteristics = %#x, %v", ex, err)
+	}
+
+	if _, err := dirs[1].CodeView(); err == nil {
+		t.Error("CodeView of a POGO entry succeeded")
+	}
+}
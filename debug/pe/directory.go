@@ -0,0 +1,183 @@
+package pe
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// dataDirectory returns the data directory entry idx. It reports false if
+// the image has no optional header, the entry is not present or it is empty.
+func (f *File) dataDirectory(idx int) (DataDirectory, bool) {
+	var dd DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		if uint32(idx) >= oh.NumberOfRvaAndSizes || idx >= len(oh.DataDirectory) {
+			return dd, false
+		}
+		dd = oh.DataDirectory[idx]
+	case *OptionalHeader64:
+		if uint32(idx) >= oh.NumberOfRvaAndSizes || idx >= len(oh.DataDirectory) {
+			return dd, false
+		}
+		dd = oh.DataDirectory[idx]
+	default:
+		return dd, false
+	}
+	return dd, dd.VirtualAddress != 0 && dd.Size != 0
+}
+
+// mappedSize returns the size of the section in memory: its virtual
+// size, or its raw size for the linkers that leave the former 0.
+func (s *Section) mappedSize() uint32 {
+	if s.VirtualSize == 0 {
+		return s.Size
+	}
+	return s.VirtualSize
+}
+
+// sectionForRVA returns the section containing rva, or nil if there is none.
+func (f *File) sectionForRVA(rva uint32) *Section {
+	for _, s := range f.Sections {
+		// Use the distance from s.VirtualAddress to avoid overflow.
+		if s.VirtualAddress <= rva && rva-s.VirtualAddress < s.mappedSize() {
+			return s
+		}
+	}
+	return nil
+}
+
+// imageReader reads the image as it is laid out in memory, addressed
+// by RVA. The uninitialized tail of a section reads as zeros.
+type imageReader struct {
+	f *File
+}
+
+func (ir imageReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		rva := off + int64(n)
+		if rva < 0 || rva > 0xffffffff {
+			return n, fmt.Errorf("RVA %#x out of range", rva)
+		}
+		s := ir.f.sectionForRVA(uint32(rva))
+		if s == nil {
+			// The headers are mapped at RVA 0, some directories such as
+			// the bound imports live there.
+			hs := ir.f.sizeOfHeaders()
+			if rva >= int64(hs) || ir.f.originalReader == nil {
+				return n, fmt.Errorf("RVA %#x is not in any section", rva)
+			}
+			want := len(p) - n
+			if int64(want) > int64(hs)-rva {
+				want = int(int64(hs) - rva)
+			}
+			m, err := ir.f.originalReader.ReadAt(p[n:n+want], rva)
+			if m < want {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return n + m, err
+			}
+			n += want
+			continue
+		}
+		soff := uint32(rva) - s.VirtualAddress
+		end := s.mappedSize()
+		want := len(p) - n
+		if uint64(want) > uint64(end-soff) {
+			want = int(end - soff)
+		}
+		chunk := p[n : n+want]
+		raw := 0
+		if soff < s.Size && s.Offset != 0 {
+			if uint64(len(chunk)) > uint64(s.Size-soff) {
+				raw = int(s.Size - soff)
+			} else {
+				raw = len(chunk)
+			}
+			m, err := s.sr.ReadAt(chunk[:raw], int64(soff))
+			if m < raw {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return n + m, err
+			}
+		}
+		for i := raw; i < len(chunk); i++ {
+			chunk[i] = 0
+		}
+		n += want
+	}
+	return n, nil
+}
+
+// readRVA reads size bytes of the image starting at rva.
+func (f *File) readRVA(rva, size uint32) ([]byte, error) {
+	return saferio.ReadDataAt(imageReader{f}, uint64(size), int64(rva))
+}
+
+// readDirectory reads the data of the data directory entry idx. It
+// returns nil data and no error if the entry is absent.
+func (f *File) readDirectory(idx int) ([]byte, DataDirectory, error) {
+	dd, ok := f.dataDirectory(idx)
+	if !ok {
+		return nil, dd, nil
+	}
+	b, err := f.readRVA(dd.VirtualAddress, dd.Size)
+	if err != nil {
+		return nil, dd, err
+	}
+	return b, dd, nil
+}
+
+// sizeOfHeaders returns the size of the headers, which are mapped
+// at RVA 0 up to the first section.
+func (f *File) sizeOfHeaders() uint32 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return oh.SizeOfHeaders
+	case *OptionalHeader64:
+		return oh.SizeOfHeaders
+	}
+	return 0
+}
+
+// is64 reports whether the image is a PE32+ image.
+func (f *File) is64() bool {
+	_, ok := f.OptionalHeader.(*OptionalHeader64)
+	return ok
+}
+
+// imageBase returns the preferred load address of the image.
+func (f *File) imageBase() uint64 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+// vaToRVA converts the virtual address va to an RVA. It reports false
+// if va is not inside the image.
+func (f *File) vaToRVA(va uint64) (uint32, bool) {
+	base := f.imageBase()
+	if va < base || va-base > 0xffffffff {
+		return 0, false
+	}
+	return uint32(va - base), true
+}
+
+// SectionForVA returns the section containing the virtual address va,
+// assuming the image is loaded at its preferred base. It returns nil if
+// no section contains va.
+func (f *File) SectionForVA(va uint64) *Section {
+	rva, ok := f.vaToRVA(va)
+	if !ok {
+		return nil
+	}
+	return f.sectionForRVA(rva)
+}
@@ -0,0 +1,413 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// RuntimeFunction is an entry of the exception directory (.pdata),
+// describing the bounds and the unwind data of a function.
+//
+// On x64 UnwindData is the RVA of the UNWIND_INFO. On ARM64 the low two
+// bits of UnwindData select between an .xdata RVA and packed unwind data;
+// EndAddress is computed from the function length and is 0 if the
+// .xdata record could not be read.
+type RuntimeFunction struct {
+	BeginAddress uint32
+	EndAddress   uint32
+	UnwindData   uint32
+}
+
+// LookupRuntimeFunctions decodes the exception directory of an x64 or
+// ARM64 image. It returns nil and no error if the image has none.
+func (f *File) LookupRuntimeFunctions() ([]RuntimeFunction, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_EXCEPTION)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read exception directory: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var fns []RuntimeFunction
+	switch f.Machine {
+	case IMAGE_FILE_MACHINE_AMD64:
+		fns = make([]RuntimeFunction, 0, len(data)/12)
+		for ; len(data) >= 12; data = data[12:] {
+			fns = append(fns, RuntimeFunction{
+				BeginAddress: binary.LittleEndian.Uint32(data[0:4]),
+				EndAddress:   binary.LittleEndian.Uint32(data[4:8]),
+				UnwindData:   binary.LittleEndian.Uint32(data[8:12]),
+			})
+		}
+	case IMAGE_FILE_MACHINE_ARM64:
+		fns = make([]RuntimeFunction, 0, len(data)/8)
+		for ; len(data) >= 8; data = data[8:] {
+			rf := RuntimeFunction{
+				BeginAddress: binary.LittleEndian.Uint32(data[0:4]),
+				UnwindData:   binary.LittleEndian.Uint32(data[4:8]),
+			}
+			if n, err := f.arm64FunctionLength(rf.UnwindData); err == nil {
+				rf.EndAddress = rf.BeginAddress + n
+			}
+			fns = append(fns, rf)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported exception directory for machine %#x", f.Machine)
+	}
+	return fns, nil
+}
+
+// x64 unwind operations.
+const (
+	UWOP_PUSH_NONVOL     = 0
+	UWOP_ALLOC_LARGE     = 1
+	UWOP_ALLOC_SMALL     = 2
+	UWOP_SET_FPREG       = 3
+	UWOP_SAVE_NONVOL     = 4
+	UWOP_SAVE_NONVOL_FAR = 5
+	UWOP_EPILOG          = 6
+	UWOP_SPARE_CODE      = 7
+	UWOP_SAVE_XMM128     = 8
+	UWOP_SAVE_XMM128_FAR = 9
+	UWOP_PUSH_MACHFRAME  = 10
+)
+
+// x64 unwind info flags.
+const (
+	UNW_FLAG_NHANDLER  = 0x0
+	UNW_FLAG_EHANDLER  = 0x1
+	UNW_FLAG_UHANDLER  = 0x2
+	UNW_FLAG_CHAININFO = 0x4
+)
+
+// UnwindCode is a decoded x64 UNWIND_CODE. Operand holds the value
+// stored in the extra slots of the operation, scaled to bytes: the
+// allocation size of UWOP_ALLOC_LARGE and UWOP_ALLOC_SMALL, or the
+// stack offset of the save operations.
+type UnwindCode struct {
+	CodeOffset uint8
+	Op         uint8
+	OpInfo     uint8
+	Operand    uint32
+}
+
+// UnwindInfo is a decoded x64 UNWIND_INFO.
+type UnwindInfo struct {
+	Version       uint8
+	Flags         uint8
+	SizeOfProlog  uint8
+	CountOfCodes  uint8
+	FrameRegister uint8
+	FrameOffset   uint8 // scaled by 16 at run time
+	Codes         []UnwindCode
+
+	ExceptionHandler uint32 // RVA, if Flags has UNW_FLAG_EHANDLER or UNW_FLAG_UHANDLER
+	HandlerData      uint32 // RVA of the language specific handler data
+	Chained          *RuntimeFunction
+}
+
+// UnwindInfo decodes the x64 unwind information of rf.
+func (f *File) UnwindInfo(rf RuntimeFunction) (*UnwindInfo, error) {
+	if f.Machine != IMAGE_FILE_MACHINE_AMD64 {
+		return nil, fmt.Errorf("UNWIND_INFO is not defined for machine %#x", f.Machine)
+	}
+	rva := rf.UnwindData
+	b, err := f.readRVA(rva, 4)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read unwind info: %v", err)
+	}
+	ui := &UnwindInfo{
+		Version:       b[0] & 7,
+		Flags:         b[0] >> 3,
+		SizeOfProlog:  b[1],
+		CountOfCodes:  b[2],
+		FrameRegister: b[3] & 0xf,
+		FrameOffset:   b[3] >> 4,
+	}
+	// The code array is padded to an even number of slots.
+	slots := (uint32(ui.CountOfCodes) + 1) &^ 1
+	if b, err = f.readRVA(rva+4, slots*2); err != nil {
+		return nil, fmt.Errorf("fail to read unwind codes: %v", err)
+	}
+	slot := func(i int) uint32 {
+		return uint32(binary.LittleEndian.Uint16(b[i*2:]))
+	}
+	for i := 0; i < int(ui.CountOfCodes); {
+		c := UnwindCode{CodeOffset: b[i*2], Op: b[i*2+1] & 0xf, OpInfo: b[i*2+1] >> 4}
+		n := 1
+		switch c.Op {
+		case UWOP_ALLOC_LARGE:
+			if c.OpInfo == 0 {
+				n = 2
+			} else {
+				n = 3
+			}
+		case UWOP_SAVE_NONVOL, UWOP_SAVE_XMM128, UWOP_EPILOG:
+			n = 2
+		case UWOP_SAVE_NONVOL_FAR, UWOP_SAVE_XMM128_FAR, UWOP_SPARE_CODE:
+			n = 3
+		}
+		if i+n > int(ui.CountOfCodes) {
+			return nil, fmt.Errorf("unwind code %d at %#x truncated", c.Op, rva)
+		}
+		switch c.Op {
+		case UWOP_ALLOC_SMALL:
+			c.Operand = uint32(c.OpInfo)*8 + 8
+		case UWOP_ALLOC_LARGE:
+			if c.OpInfo == 0 {
+				c.Operand = slot(i+1) * 8
+			} else {
+				c.Operand = slot(i+1) | slot(i+2)<<16
+			}
+		case UWOP_SAVE_NONVOL:
+			c.Operand = slot(i+1) * 8
+		case UWOP_SAVE_XMM128:
+			c.Operand = slot(i+1) * 16
+		case UWOP_SAVE_NONVOL_FAR, UWOP_SAVE_XMM128_FAR:
+			c.Operand = slot(i+1) | slot(i+2)<<16
+		case UWOP_EPILOG:
+			c.Operand = slot(i + 1)
+		}
+		ui.Codes = append(ui.Codes, c)
+		i += n
+	}
+	tail := rva + 4 + slots*2
+	switch {
+	case ui.Flags&UNW_FLAG_CHAININFO != 0:
+		b, err := f.readRVA(tail, 12)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read chained unwind info: %v", err)
+		}
+		ui.Chained = &RuntimeFunction{
+			BeginAddress: binary.LittleEndian.Uint32(b[0:4]),
+			EndAddress:   binary.LittleEndian.Uint32(b[4:8]),
+			UnwindData:   binary.LittleEndian.Uint32(b[8:12]),
+		}
+	case ui.Flags&(UNW_FLAG_EHANDLER|UNW_FLAG_UHANDLER) != 0:
+		b, err := f.readRVA(tail, 4)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read exception handler: %v", err)
+		}
+		ui.ExceptionHandler = binary.LittleEndian.Uint32(b)
+		ui.HandlerData = tail + 4
+	}
+	return ui, nil
+}
+
+// ARM64 .pdata flags, stored in the low two bits of UnwindData.
+const (
+	PDATA_REF_TO_FULL_XDATA = 0
+	PDATA_PACKED_UNWIND     = 1
+	PDATA_PACKED_FRAGMENT   = 2
+)
+
+// ARM64EpilogScope is an epilog scope of an ARM64 .xdata record.
+type ARM64EpilogScope struct {
+	StartOffset uint32 // in bytes from the start of the function
+	StartIndex  uint16 // index of the first unwind code byte of the epilog
+}
+
+// ARM64UnwindCode is a decoded ARM64 unwind code.
+type ARM64UnwindCode struct {
+	Name  string
+	Bytes []byte
+}
+
+// ARM64UnwindInfo is the decoded unwind information of an ARM64
+// function, either packed into the .pdata entry or held in an .xdata
+// record. FunctionLength and FrameSize are in bytes.
+type ARM64UnwindInfo struct {
+	Flag           uint8
+	FunctionLength uint32
+
+	// Packed unwind data.
+	RegF      uint8
+	RegI      uint8
+	H         bool
+	CR        uint8
+	FrameSize uint32
+
+	// Unpacked .xdata record.
+	Version          uint8
+	X                bool // an exception handler follows the codes
+	E                bool // a single epilog is packed into the header
+	EpilogCount      uint16
+	CodeWords        uint8
+	EpilogStartIndex uint16 // unwind code index of the single epilog if E is set
+	Epilogs          []ARM64EpilogScope
+	Codes            []ARM64UnwindCode
+	ExceptionHandler uint32 // RVA, if X is set
+	HandlerData      uint32 // RVA of the language specific handler data
+}
+
+// Packed reports whether the unwind data is packed into the .pdata entry.
+func (ui *ARM64UnwindInfo) Packed() bool {
+	return ui.Flag != PDATA_REF_TO_FULL_XDATA
+}
+
+// arm64FunctionLength returns the length in bytes of the function
+// whose .pdata entry has the given unwind data.
+func (f *File) arm64FunctionLength(unwindData uint32) (uint32, error) {
+	if unwindData&3 != PDATA_REF_TO_FULL_XDATA {
+		return (unwindData >> 2 & 0x7ff) * 4, nil
+	}
+	b, err := f.readRVA(unwindData, 4)
+	if err != nil {
+		return 0, err
+	}
+	return (binary.LittleEndian.Uint32(b) & 0x3ffff) * 4, nil
+}
+
+// ARM64UnwindInfo decodes the ARM64 unwind information of rf.
+func (f *File) ARM64UnwindInfo(rf RuntimeFunction) (*ARM64UnwindInfo, error) {
+	if f.Machine != IMAGE_FILE_MACHINE_ARM64 {
+		return nil, fmt.Errorf("ARM64 unwind data is not defined for machine %#x", f.Machine)
+	}
+	w := rf.UnwindData
+	ui := &ARM64UnwindInfo{Flag: uint8(w & 3)}
+	if ui.Packed() {
+		ui.FunctionLength = (w >> 2 & 0x7ff) * 4
+		ui.RegF = uint8(w >> 13 & 7)
+		ui.RegI = uint8(w >> 16 & 0xf)
+		ui.H = w>>20&1 != 0
+		ui.CR = uint8(w >> 21 & 3)
+		ui.FrameSize = (w >> 23 & 0x1ff) * 16
+		return ui, nil
+	}
+	rva := w
+	b, err := f.readRVA(rva, 4)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read xdata: %v", err)
+	}
+	h := binary.LittleEndian.Uint32(b)
+	rva += 4
+	ui.FunctionLength = (h & 0x3ffff) * 4
+	ui.Version = uint8(h >> 18 & 3)
+	ui.X = h>>20&1 != 0
+	ui.E = h>>21&1 != 0
+	ui.EpilogCount = uint16(h >> 22 & 0x1f)
+	ui.CodeWords = uint8(h >> 27)
+	codeWords := uint32(ui.CodeWords)
+	if ui.EpilogCount == 0 && ui.CodeWords == 0 {
+		// Both counts live in an extension word.
+		if b, err = f.readRVA(rva, 4); err != nil {
+			return nil, fmt.Errorf("fail to read xdata: %v", err)
+		}
+		x := binary.LittleEndian.Uint32(b)
+		rva += 4
+		ui.EpilogCount = uint16(x)
+		codeWords = x >> 16 & 0xff
+		ui.CodeWords = uint8(codeWords)
+	}
+	if ui.E {
+		ui.EpilogStartIndex = ui.EpilogCount
+	} else if ui.EpilogCount > 0 {
+		if b, err = f.readRVA(rva, uint32(ui.EpilogCount)*4); err != nil {
+			return nil, fmt.Errorf("fail to read epilog scopes: %v", err)
+		}
+		for i := 0; i < int(ui.EpilogCount); i++ {
+			s := binary.LittleEndian.Uint32(b[i*4:])
+			ui.Epilogs = append(ui.Epilogs, ARM64EpilogScope{
+				StartOffset: (s & 0x3ffff) * 4,
+				StartIndex:  uint16(s >> 22),
+			})
+		}
+		rva += uint32(ui.EpilogCount) * 4
+	}
+	if codeWords > 0 {
+		if b, err = f.readRVA(rva, codeWords*4); err != nil {
+			return nil, fmt.Errorf("fail to read unwind codes: %v", err)
+		}
+		ui.Codes = decodeARM64UnwindCodes(b)
+		rva += codeWords * 4
+	}
+	if ui.X {
+		if b, err = f.readRVA(rva, 4); err != nil {
+			return nil, fmt.Errorf("fail to read exception handler: %v", err)
+		}
+		ui.ExceptionHandler = binary.LittleEndian.Uint32(b)
+		ui.HandlerData = rva + 4
+	}
+	return ui, nil
+}
+
+// arm64UnwindOp returns the name and length of the ARM64 unwind code
+// starting with byte c.
+func arm64UnwindOp(c byte) (string, int) {
+	switch {
+	case c < 0x20:
+		return "alloc_s", 1
+	case c < 0x40:
+		return "save_r19r20_x", 1
+	case c < 0x80:
+		return "save_fplr", 1
+	case c < 0xc0:
+		return "save_fplr_x", 1
+	case c < 0xc8:
+		return "alloc_m", 2
+	case c < 0xcc:
+		return "save_regp", 2
+	case c < 0xd0:
+		return "save_regp_x", 2
+	case c < 0xd4:
+		return "save_reg", 2
+	case c < 0xd6:
+		return "save_reg_x", 2
+	case c < 0xd8:
+		return "save_lrpair", 2
+	case c < 0xda:
+		return "save_fregp", 2
+	case c < 0xdc:
+		return "save_fregp_x", 2
+	case c < 0xde:
+		return "save_freg", 2
+	case c == 0xde:
+		return "save_freg_x", 2
+	case c == 0xdf:
+		return "alloc_z", 2
+	}
+	switch c {
+	case 0xe0:
+		return "alloc_l", 4
+	case 0xe1:
+		return "set_fp", 1
+	case 0xe2:
+		return "add_fp", 2
+	case 0xe3:
+		return "nop", 1
+	case 0xe4:
+		return "end", 1
+	case 0xe5:
+		return "end_c", 1
+	case 0xe6:
+		return "save_next", 1
+	case 0xe7:
+		return "save_any_reg", 3
+	case 0xe8:
+		return "MSFT_OP_TRAP_FRAME", 1
+	case 0xe9:
+		return "MSFT_OP_MACHINE_FRAME", 1
+	case 0xea:
+		return "MSFT_OP_CONTEXT", 1
+	case 0xeb:
+		return "MSFT_OP_EC_CONTEXT", 1
+	case 0xec:
+		return "MSFT_OP_CLEAR_UNWOUND_TO_CALL", 1
+	case 0xfc:
+		return "pac_sign_lr", 1
+	}
+	return "reserved", 1
+}
+
+func decodeARM64UnwindCodes(b []byte) []ARM64UnwindCode {
+	var codes []ARM64UnwindCode
+	for len(b) > 0 {
+		name, n := arm64UnwindOp(b[0])
+		if n > len(b) {
+			n = len(b)
+		}
+		codes = append(codes, ARM64UnwindCode{Name: name, Bytes: b[:n]})
+		b = b[n:]
+	}
+	return codes
+}
@@ -0,0 +1,188 @@
+package pe
+
+import "testing"
+
+func TestUnwindInfoAMD64(t *testing.T) {
+	var b le
+	// .pdata at 0x2000: two functions.
+	b.u32(0x1000)
+	b.u32(0x1040)
+	b.u32(0x2100)
+	b.u32(0x1040)
+	b.u32(0x1080)
+	b.u32(0x2200)
+	b.pad(0x100)
+	// UNWIND_INFO with a handler: version 1, prolog 0x10, 4 codes.
+	b.u8(1 | UNW_FLAG_EHANDLER<<3)
+	b.u8(0x10)
+	b.u8(4)
+	b.u8(0x25) // frame register 5 (rbp), offset 2
+	b.u8(0x0c)
+	b.u8(UWOP_ALLOC_LARGE | 0<<4)
+	b.u16(0x30) // 0x30*8 bytes
+	b.u8(0x04)
+	b.u8(UWOP_ALLOC_SMALL | 3<<4)
+	b.u8(0x01)
+	b.u8(UWOP_PUSH_NONVOL | 5<<4)
+	b.u32(0x1800) // handler
+	b.pad(0x200)
+	// Chained UNWIND_INFO with one SAVE_NONVOL code (padded to 2 slots).
+	b.u8(1 | UNW_FLAG_CHAININFO<<3)
+	b.u8(0)
+	b.u8(2)
+	b.u8(0)
+	b.u8(0x08)
+	b.u8(UWOP_SAVE_NONVOL | 3<<4)
+	b.u16(0x10)
+	b.u32(0x1000)
+	b.u32(0x1040)
+	b.u32(0x2100)
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_EXCEPTION: {VirtualAddress: 0x2000, Size: 24},
+		},
+		sections: []testSection{{name: ".pdata", va: 0x2000, data: b.Bytes()}},
+	}
+	f := ti.open(t)
+	fns, err := f.LookupRuntimeFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fns) != 2 || fns[1] != (RuntimeFunction{0x1040, 0x1080, 0x2200}) {
+		t.Fatalf("LookupRuntimeFunctions = %v", fns)
+	}
+	ui, err := f.UnwindInfo(fns[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ui.Version != 1 || ui.Flags != UNW_FLAG_EHANDLER || ui.SizeOfProlog != 0x10 || ui.FrameRegister != 5 || ui.FrameOffset != 2 {
+		t.Errorf("UnwindInfo = %+v", ui)
+	}
+	want := []UnwindCode{
+		{0x0c, UWOP_ALLOC_LARGE, 0, 0x180},
+		{0x04, UWOP_ALLOC_SMALL, 3, 32},
+		{0x01, UWOP_PUSH_NONVOL, 5, 0},
+	}
+	if len(ui.Codes) != len(want) {
+		t.Fatalf("Codes = %v, want %v", ui.Codes, want)
+	}
+	for i := range want {
+		if ui.Codes[i] != want[i] {
+			t.Errorf("Codes[%d] = %+v, want %+v", i, ui.Codes[i], want[i])
+		}
+	}
+	if ui.ExceptionHandler != 0x1800 || ui.HandlerData != 0x2110 {
+		t.Errorf("ExceptionHandler, HandlerData = %#x, %#x", ui.ExceptionHandler, ui.HandlerData)
+	}
+
+	ui, err = f.UnwindInfo(fns[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ui.Codes) != 1 || ui.Codes[0].Operand != 0x80 {
+		t.Errorf("Codes = %+v", ui.Codes)
+	}
+	if ui.Chained == nil || *ui.Chained != fns[0] {
+		t.Errorf("Chained = %+v, want %+v", ui.Chained, fns[0])
+	}
+}
+
+func TestUnwindInfoARM64(t *testing.T) {
+	var b le
+	// Packed: FunctionLength 0x10 words, RegF 1, RegI 2, H, CR 3, FrameSize 4.
+	packed := uint32(PDATA_PACKED_UNWIND | 0x10<<2 | 1<<13 | 2<<16 | 1<<20 | 3<<21 | 4<<23)
+	b.u32(0x1000)
+	b.u32(packed)
+	b.u32(0x1040)
+	b.u32(0x2100)
+	b.u32(0x1100)
+	b.u32(0x2200)
+	b.pad(0x100)
+	// .xdata: FunctionLength 0x30 words, X, one epilog scope, one code word.
+	b.u32(0x30 | 1<<20 | 1<<22 | 1<<27)
+	b.u32(0x2c | 2<<22) // epilog at word 0x2c, code index 2
+	b.u8(0xc8)          // save_regp
+	b.u8(0x02)
+	b.u8(0x02) // alloc_s
+	b.u8(0xe4) // end
+	b.u32(0x1900)
+	b.pad(0x200)
+	// .xdata with extension word: 0 epilogs, 2 code words, E set.
+	b.u32(0x8 | 1<<21)
+	b.u32(0 | 2<<16)
+	b.u8(0xe0) // alloc_l
+	b.u8(0x00)
+	b.u8(0x01)
+	b.u8(0x00)
+	b.u8(0xe1) // set_fp
+	b.u8(0xe4) // end
+	b.u8(0xe3)
+	b.u8(0xe3)
+
+	ti := &testImage{
+		machine: IMAGE_FILE_MACHINE_ARM64,
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_EXCEPTION: {VirtualAddress: 0x2000, Size: 24},
+		},
+		sections: []testSection{{name: ".pdata", va: 0x2000, data: b.Bytes()}},
+	}
+	f := ti.open(t)
+	fns, err := f.LookupRuntimeFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fns) != 3 || fns[0].EndAddress != 0x1040 || fns[1].EndAddress != 0x1040+0xc0 || fns[2].EndAddress != 0x1100+0x20 {
+		t.Fatalf("LookupRuntimeFunctions = %v", fns)
+	}
+
+	ui, err := f.ARM64UnwindInfo(fns[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ui.Packed() || ui.FunctionLength != 0x40 || ui.RegF != 1 || ui.RegI != 2 || !ui.H || ui.CR != 3 || ui.FrameSize != 64 {
+		t.Errorf("packed ARM64UnwindInfo = %+v", ui)
+	}
+
+	ui, err = f.ARM64UnwindInfo(fns[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ui.Packed() || ui.FunctionLength != 0xc0 || !ui.X || ui.E || ui.EpilogCount != 1 || ui.CodeWords != 1 {
+		t.Errorf("ARM64UnwindInfo = %+v", ui)
+	}
+	if len(ui.Epilogs) != 1 || ui.Epilogs[0] != (ARM64EpilogScope{0xb0, 2}) {
+		t.Errorf("Epilogs = %v", ui.Epilogs)
+	}
+	var names []string
+	for _, c := range ui.Codes {
+		names = append(names, c.Name)
+	}
+	if len(names) != 3 || names[0] != "save_regp" || names[1] != "alloc_s" || names[2] != "end" {
+		t.Errorf("Codes = %v", names)
+	}
+	if ui.ExceptionHandler != 0x1900 || ui.HandlerData != 0x2110 {
+		t.Errorf("ExceptionHandler, HandlerData = %#x, %#x", ui.ExceptionHandler, ui.HandlerData)
+	}
+
+	ui, err = f.ARM64UnwindInfo(fns[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ui.E || ui.EpilogStartIndex != 0 || ui.CodeWords != 2 || len(ui.Codes) != 5 || ui.Codes[0].Name != "alloc_l" || len(ui.Codes[0].Bytes) != 4 {
+		t.Errorf("ARM64UnwindInfo = %+v", ui)
+	}
+}
+
+func TestLookupRuntimeFunctionsUnsupported(t *testing.T) {
+	ti := &testImage{
+		pe32: true,
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_EXCEPTION: {VirtualAddress: 0x2000, Size: 8},
+		},
+		sections: []testSection{{name: ".pdata", va: 0x2000, data: make([]byte, 8)}},
+	}
+	if _, err := ti.open(t).LookupRuntimeFunctions(); err == nil {
+		t.Error("LookupRuntimeFunctions of an i386 image succeeded")
+	}
+}
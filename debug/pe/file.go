@@ -41,6 +41,8 @@ type File struct {
 	OverlayOffset  int64
 	originalReader io.ReaderAt
 	closer         io.Closer
+
+	optionalHeaderOffset int64 // file offset of the optional header
 }
 
 // Open opens the named file using os.Open and prepares it for use as a PE binary.
@@ -137,6 +139,7 @@ func NewFile(r io.ReaderAt) (*File, error) {
 	}
 
 	// Read optional header.
+	f.optionalHeaderOffset = base + int64(binary.Size(f.FileHeader))
 	f.OptionalHeader, err = readOptionalHeader(sr, f.FileHeader.SizeOfOptionalHeader)
 	if err != nil {
 		return nil, err
@@ -33,9 +33,15 @@ func (e Exports) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
 
 // Function function
 type Function struct {
-	Name    string
-	Index   int
-	Ordinal int
+	Name     string
+	Index    int // hint of a named import
+	Ordinal  int
+	ThunkRVA uint32 // RVA of the import lookup (original first thunk) entry
+	IATRVA   uint32 // RVA of the IAT slot the loader writes the address to
+	// BoundAddress is the bound IAT entry of a delay-load import, 0 if
+	// the descriptor has no bound IAT. Regular imports are bound in
+	// place, in the IAT.
+	BoundAddress uint64
 }
 
 // Functions functions
@@ -43,13 +49,45 @@ type Functions []Function
 
 // FunctionTable function table
 type FunctionTable struct {
-	Imports map[string]Functions
-	Delay   map[string]Functions
-	Exports []ExportedSymbol
+	Imports          map[string]Functions
+	ImportOrder      []string // DLL names of Imports in import directory order
+	Delay            map[string]Functions
+	DelayDescriptors map[string]ImportDelayDirectory // delay-load descriptors by DLL name, with RVAs
+	Exports          []ExportedSymbol
+	Bound            map[string]BoundImport // bound imports by module name, nil if the image is not bound
+	// ImportDescriptors has the descriptors of the import directory in
+	// order: a DLL split across descriptors, merged in Imports, appears
+	// once for each.
+	ImportDescriptors []ImportDescriptor
+	// BoundErr is the error reading the bound imports. They are only
+	// informational, stale or garbage directories leave Bound nil.
+	BoundErr error
+}
+
+// An ImportDescriptor is an entry of the import directory, with the
+// functions of its import lookup table.
+type ImportDescriptor struct {
+	DllName   string
+	Functions Functions
+}
+
+// LookupIATSlot returns the import whose IAT slot is at rva, so that an
+// indirect call through the slot can be named dll!function.
+func (ft *FunctionTable) LookupIATSlot(rva uint32) (string, Function, bool) {
+	for _, m := range []map[string]Functions{ft.Imports, ft.Delay} {
+		for dll, fs := range m {
+			for _, fn := range fs {
+				if fn.IATRVA == rva {
+					return dll, fn, true
+				}
+			}
+		}
+	}
+	return "", Function{}, false
 }
 
 func getFunctionHit(section []byte, start int) uint16 {
-	if start < 0 || start-2 > len(section) {
+	if start < 0 || start+2 > len(section) {
 		return 0
 	}
 	return binary.LittleEndian.Uint16(section[start:])
@@ -135,11 +173,21 @@ func (f *File) LookupExports() ([]ExportedSymbol, error) {
 	ied.AddressOfFunctions = binary.LittleEndian.Uint32(d[28:32])
 	ied.AddressOfNames = binary.LittleEndian.Uint32(d[32:36])
 	ied.AddressOfNameOrdinals = binary.LittleEndian.Uint32(d[36:40])
-	if ied.NumberOfNames == 0 {
+	// DLLs such as the MFC ones export by ordinal only, without names.
+	if ied.NumberOfFunctions == 0 {
 		return nil, nil
 	}
 	exportDataEnd := idd.VirtualAddress + idd.Size
 	sectionEnd := ds.VirtualAddress + ds.VirtualSize
+	// The export address table is in the section, which bounds the
+	// number of functions.
+	var maxFunctions uint32
+	if ied.AddressOfFunctions < sectionEnd {
+		maxFunctions = (sectionEnd - ied.AddressOfFunctions) / 4
+	}
+	if ied.NumberOfFunctions > maxFunctions {
+		ied.NumberOfFunctions = maxFunctions
+	}
 	exports := make([]ExportedSymbol, ied.NumberOfFunctions) // make function
 	if ied.AddressOfFunctions > ds.VirtualAddress && ied.AddressOfFunctions+ied.NumberOfFunctions*4 < sectionEnd {
 		d = sdata[ied.AddressOfFunctions-ds.VirtualAddress:]
@@ -251,47 +299,76 @@ func (f *File) importedSymbols(ft *FunctionTable) error {
 	//  Needs test before rewrite.
 	for _, dt := range ida {
 		dt.dll, _ = getString(sdata, int(dt.Name-ds.VirtualAddress))
-		// seek to OriginalFirstThunk
-		d = sdata[dt.OriginalFirstThunk-ds.VirtualAddress:]
-		var fs Functions
-		for len(d) > 0 {
-			if pe64 { // 64bit
-				va := binary.LittleEndian.Uint64(d[0:8])
-				d = d[8:]
-				if va == 0 {
-					break
-				}
-				if va&0x8000000000000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-					fs = append(fs, Function{Ordinal: int(va & 0xFFFF)})
-				} else {
-					fn, _ := getString(sdata, int(uint32(va)-ds.VirtualAddress+2))
-					hit := getFunctionHit(sdata, int(uint32(va)-ds.VirtualAddress))
-					fs = append(fs, Function{Name: fn, Index: int(hit)})
-				}
-			} else { // 32bit
-				va := binary.LittleEndian.Uint32(d[0:4])
-				d = d[4:]
-				if va == 0 {
-					break
-				}
-				if va&0x80000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-					//ord := va&0x0000FFFF
-					fs = append(fs, Function{Ordinal: int(va & 0xFFFF)})
-				} else {
-					fn, _ := getString(sdata, int(va-ds.VirtualAddress+2))
-					hit := getFunctionHit(sdata, int(uint32(va)-ds.VirtualAddress))
-					fs = append(fs, Function{Name: fn, Index: int(hit)})
-				}
-			}
+		fs := readThunks(sdata, ds, dt.OriginalFirstThunk, dt.FirstThunk, pe64)
+		if _, ok := ft.Imports[dt.dll]; !ok {
+			ft.ImportOrder = append(ft.ImportOrder, dt.dll)
 		}
-		ft.Imports[dt.dll] = fs
+		ft.Imports[dt.dll] = append(ft.Imports[dt.dll], fs...)
+		ft.ImportDescriptors = append(ft.ImportDescriptors, ImportDescriptor{DllName: dt.dll, Functions: fs})
 	}
 
 	return nil
 }
 
+// dlattrRva is set in the Attributes of delay-load descriptors that
+// hold RVAs instead of VAs.
+const dlattrRva = 0x1
+
+func thunkSize(pe64 bool) uint32 {
+	if pe64 {
+		return 8
+	}
+	return 4
+}
+
+// readThunk reads the thunk at rva, 0 if it is out of the image.
+func (f *File) readThunk(rva uint32, pe64 bool) uint64 {
+	b, err := f.readRVA(rva, thunkSize(pe64))
+	if err != nil {
+		return 0
+	}
+	if pe64 {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return uint64(binary.LittleEndian.Uint32(b))
+}
+
+// readThunks decodes the import lookup table at intRVA, sdata being the
+// data of section ds that holds it and the hint/name entries. iatRVA is
+// the RVA of the matching import address table.
+func readThunks(sdata []byte, ds *Section, intRVA, iatRVA uint32, pe64 bool) Functions {
+	if intRVA < ds.VirtualAddress || uint64(intRVA-ds.VirtualAddress) >= uint64(len(sdata)) {
+		return nil
+	}
+	d := sdata[intRVA-ds.VirtualAddress:]
+	size := thunkSize(pe64)
+	var fs Functions
+	for i := uint32(0); len(d) >= int(size); i++ {
+		var va uint64
+		var ordinal bool
+		if pe64 { // 64bit
+			va = binary.LittleEndian.Uint64(d[0:8])
+			ordinal = va&0x8000000000000000 != 0
+		} else { // 32bit
+			va = uint64(binary.LittleEndian.Uint32(d[0:4]))
+			ordinal = va&0x80000000 != 0
+		}
+		d = d[size:]
+		if va == 0 {
+			break
+		}
+		fn := Function{ThunkRVA: intRVA + i*size, IATRVA: iatRVA + i*size}
+		if ordinal {
+			fn.Ordinal = int(va & 0xFFFF)
+		} else {
+			fn.Name, _ = getString(sdata, int(uint32(va)-ds.VirtualAddress+2))
+			fn.Index = int(getFunctionHit(sdata, int(uint32(va)-ds.VirtualAddress)))
+		}
+		fs = append(fs, fn)
+	}
+	return fs
+}
+
 // ImportDelayDirectory delay
 type ImportDelayDirectory struct {
 	Attributes                 uint32
@@ -383,46 +460,26 @@ func (f *File) importedDelaySymbols(ft *FunctionTable) error {
 	//  Why ds.Data() called again and again in the loop?
 	//  Needs test before rewrite.
 	for _, dt := range ida {
-		dt.DllName, _ = getString(sdata, int(dt.DllNameRVA-ds.VirtualAddress))
-		// seek to OriginalFirstThunk
-		if dt.ImportAddressTableRVA > ds.VirtualAddress {
-			break
-		}
-		d = sdata[dt.ImportNameTableRVA-ds.VirtualAddress:]
-		var fs Functions
-		for len(d) > 0 {
-			if pe64 { // 64bit
-				va := binary.LittleEndian.Uint64(d[0:8])
-				d = d[8:]
-				if va == 0 {
-					break
-				}
-				if va&0x8000000000000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-					fs = append(fs, Function{Ordinal: int(va & 0xFFFF)})
-				} else {
-					fn, _ := getString(sdata, int(uint32(va)-ds.VirtualAddress+2))
-					hit := getFunctionHit(sdata, int(uint32(va)-ds.VirtualAddress))
-					fs = append(fs, Function{Name: fn, Index: int(hit)})
-				}
-			} else { // 32bit
-				va := binary.LittleEndian.Uint32(d[0:4])
-				d = d[4:]
-				if va == 0 {
-					break
-				}
-				if va&0x80000000 > 0 { // is Ordinal
-					// TODO add dynimport ordinal support.
-					//ord := va&0x0000FFFF
-					fs = append(fs, Function{Ordinal: int(va & 0xFFFF)})
-				} else {
-					fn, _ := getString(sdata, int(va-ds.VirtualAddress+2))
-					hit := getFunctionHit(sdata, int(uint32(va)-ds.VirtualAddress))
-					fs = append(fs, Function{Name: fn, Index: int(hit)})
+		if dt.Attributes&dlattrRva == 0 {
+			// Descriptors of Visual C++ 6.0 hold VAs.
+			for _, p := range []*uint32{&dt.DllNameRVA, &dt.ModuleHandleRVA, &dt.ImportAddressTableRVA, &dt.ImportNameTableRVA, &dt.BoundImportAddressTableRVA, &dt.UnloadInformationTableRVA} {
+				if *p != 0 {
+					*p, _ = f.vaToRVA(uint64(*p))
 				}
 			}
 		}
-		ft.Imports[dt.DllName] = fs
+		if dt.DllNameRVA < ds.VirtualAddress || dt.ImportNameTableRVA < ds.VirtualAddress {
+			continue
+		}
+		dt.DllName, _ = getString(sdata, int(dt.DllNameRVA-ds.VirtualAddress))
+		fs := readThunks(sdata, ds, dt.ImportNameTableRVA, dt.ImportAddressTableRVA, pe64)
+		if dt.BoundImportAddressTableRVA != 0 {
+			for i := range fs {
+				fs[i].BoundAddress = f.readThunk(dt.BoundImportAddressTableRVA+uint32(i)*thunkSize(pe64), pe64)
+			}
+		}
+		ft.DelayDescriptors[dt.DllName] = dt
+		ft.Delay[dt.DllName] = fs
 	}
 
 	return nil
@@ -431,8 +488,9 @@ func (f *File) importedDelaySymbols(ft *FunctionTable) error {
 // LookupFunctionTable table
 func (f *File) LookupFunctionTable() (*FunctionTable, error) {
 	ft := &FunctionTable{
-		Imports: make(map[string]Functions),
-		Delay:   make(map[string]Functions),
+		Imports:          make(map[string]Functions),
+		Delay:            make(map[string]Functions),
+		DelayDescriptors: make(map[string]ImportDelayDirectory),
 	}
 	if err := f.importedSymbols(ft); err != nil {
 		return nil, err
@@ -445,5 +503,16 @@ func (f *File) LookupFunctionTable() (*FunctionTable, error) {
 		return nil, err
 	}
 	ft.Exports = exports
+	bound, err := f.LookupBoundImports()
+	if err != nil {
+		ft.BoundErr = err
+		return ft, nil
+	}
+	for _, b := range bound {
+		if ft.Bound == nil {
+			ft.Bound = make(map[string]BoundImport)
+		}
+		ft.Bound[b.ModuleName] = b
+	}
 	return ft, nil
 }
@@ -0,0 +1,130 @@
+package pe
+
+import (
+	"testing"
+)
+
+func TestImportThunks(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ft, err := f.LookupFunctionTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := ft.Imports["KERNEL32.dll"]
+	if len(fs) < 2 {
+		t.Fatalf("KERNEL32.dll imports = %v", fs)
+	}
+	want := []Function{
+		{Name: "DeleteCriticalSection", Index: 215, ThunkRVA: 0xe03c, IATRVA: 0xe254},
+		{Name: "EnterCriticalSection", Index: 247, ThunkRVA: 0xe044, IATRVA: 0xe25c},
+	}
+	for i, w := range want {
+		if fs[i] != w {
+			t.Errorf("KERNEL32.dll import %d = %+v, want %+v", i, fs[i], w)
+		}
+	}
+	dll, fn, ok := ft.LookupIATSlot(0xe25c)
+	if !ok || dll != "KERNEL32.dll" || fn.Name != "EnterCriticalSection" {
+		t.Errorf("LookupIATSlot(0xe25c) = %s, %+v, %v", dll, fn, ok)
+	}
+	if len(ft.Delay) != 0 {
+		t.Errorf("Delay = %v, want none", ft.Delay)
+	}
+}
+
+func TestDelayImportThunks(t *testing.T) {
+	var b le
+	b.u32(dlattrRva)
+	b.u32(0x1040) // DllNameRVA
+	b.u32(0x2100) // ModuleHandleRVA
+	b.u32(0x2000) // ImportAddressTableRVA
+	b.u32(0x1050) // ImportNameTableRVA
+	b.u32(0x10a0) // BoundImportAddressTableRVA
+	b.u32(0)
+	b.u32(0x5e000000)
+	b.pad(0x40)
+	b.WriteString("USER32.dll\x00")
+	b.pad(0x50)
+	b.u64(0x1080)
+	b.u64(0x8000000000000010)
+	b.u64(0)
+	b.pad(0x80)
+	b.u16(0x0123)
+	b.WriteString("MessageBoxW\x00")
+	b.pad(0xa0)
+	b.u64(0x180001000)
+	b.u64(0x180002000)
+	b.u64(0)
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT: {VirtualAddress: 0x1000, Size: 0x40},
+		},
+		sections: []testSection{
+			{name: ".rdata", va: 0x1000, data: b.Bytes()},
+			{name: ".data", va: 0x2000, data: make([]byte, 0x108)},
+		},
+	}
+	ft, err := ti.open(t).LookupFunctionTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.Imports) != 0 {
+		t.Errorf("Imports = %v, want none", ft.Imports)
+	}
+	fs := ft.Delay["USER32.dll"]
+	want := Functions{
+		{Name: "MessageBoxW", Index: 0x123, ThunkRVA: 0x1050, IATRVA: 0x2000, BoundAddress: 0x180001000},
+		{Ordinal: 0x10, ThunkRVA: 0x1058, IATRVA: 0x2008, BoundAddress: 0x180002000},
+	}
+	if len(fs) != len(want) {
+		t.Fatalf("Delay[USER32.dll] = %+v", fs)
+	}
+	for i := range want {
+		if fs[i] != want[i] {
+			t.Errorf("delay import %d = %+v, want %+v", i, fs[i], want[i])
+		}
+	}
+	d, ok := ft.DelayDescriptors["USER32.dll"]
+	if !ok || d.ModuleHandleRVA != 0x2100 || d.BoundImportAddressTableRVA != 0x10a0 {
+		t.Errorf("DelayDescriptors = %+v", ft.DelayDescriptors)
+	}
+}
+
+func TestImportHintAtSectionEnd(t *testing.T) {
+	var b le
+	b.u32(dlattrRva)
+	b.u32(0x1040) // DllNameRVA
+	b.u32(0x2100) // ModuleHandleRVA
+	b.u32(0x2000) // ImportAddressTableRVA
+	b.u32(0x1050) // ImportNameTableRVA
+	b.pad(0x40)
+	b.WriteString("USER32.dll\x00")
+	b.pad(0x50)
+	b.u64(0x11ff) // hint in the last byte of the section
+	b.u64(0)
+	b.pad(0x1ff)
+	b.u8(0x23)
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT: {VirtualAddress: 0x1000, Size: 0x40},
+		},
+		sections: []testSection{
+			{name: ".rdata", va: 0x1000, data: b.Bytes()},
+			{name: ".data", va: 0x2000, data: make([]byte, 0x108)},
+		},
+	}
+	ft, err := ti.open(t).LookupFunctionTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Function{ThunkRVA: 0x1050, IATRVA: 0x2000}
+	if fs := ft.Delay["USER32.dll"]; len(fs) != 1 || fs[0] != want {
+		t.Errorf("Delay[USER32.dll] = %+v, want %+v", fs, want)
+	}
+}
@@ -0,0 +1,172 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testSection is a section of a synthetic image.
+type testSection struct {
+	name  string
+	va    uint32
+	data  []byte
+	chars uint32
+}
+
+// testImage describes a minimal synthetic PE image, used to exercise
+// the data directory parsers without checking in binaries.
+type testImage struct {
+	machine   uint16 // defaults to IMAGE_FILE_MACHINE_AMD64
+	pe32      bool   // build a PE32 image instead of PE32+
+	imageBase uint64
+	dirs      map[int]DataDirectory
+	sections  []testSection
+	dosStub   []byte // placed between the DOS header and the PE signature
+}
+
+const testFileAlignment = 0x200
+
+func testAlign(v, a uint32) uint32 {
+	return (v + a - 1) &^ (a - 1)
+}
+
+// build lays out the image and returns its bytes.
+func (ti *testImage) build() []byte {
+	machine := ti.machine
+	if machine == 0 {
+		machine = IMAGE_FILE_MACHINE_AMD64
+		if ti.pe32 {
+			machine = IMAGE_FILE_MACHINE_I386
+		}
+	}
+	ohSize := binary.Size(OptionalHeader64{})
+	if ti.pe32 {
+		ohSize = binary.Size(OptionalHeader32{})
+	}
+	peOffset := 0x40 + len(ti.dosStub)
+	headerSize := testAlign(uint32(peOffset+4+binary.Size(FileHeader{})+ohSize+len(ti.sections)*binary.Size(SectionHeader32{})), testFileAlignment)
+
+	var dd [16]DataDirectory
+	for i, d := range ti.dirs {
+		dd[i] = d
+	}
+	imageSize := uint32(0x1000)
+	for _, s := range ti.sections {
+		if end := testAlign(s.va+uint32(len(s.data)), 0x1000); end > imageSize {
+			imageSize = end
+		}
+	}
+
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], uint32(peOffset))
+	buf.Write(dos)
+	buf.Write(ti.dosStub)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, binary.LittleEndian, FileHeader{
+		Machine:              machine,
+		NumberOfSections:     uint16(len(ti.sections)),
+		SizeOfOptionalHeader: uint16(ohSize),
+		Characteristics:      IMAGE_FILE_EXECUTABLE_IMAGE,
+	})
+	if ti.pe32 {
+		binary.Write(&buf, binary.LittleEndian, OptionalHeader32{
+			Magic:               0x10b,
+			ImageBase:           uint32(ti.imageBase),
+			SectionAlignment:    0x1000,
+			FileAlignment:       testFileAlignment,
+			SizeOfImage:         imageSize,
+			SizeOfHeaders:       headerSize,
+			Subsystem:           IMAGE_SUBSYSTEM_WINDOWS_CUI,
+			NumberOfRvaAndSizes: 16,
+			DataDirectory:       dd,
+		})
+	} else {
+		binary.Write(&buf, binary.LittleEndian, OptionalHeader64{
+			Magic:               0x20b,
+			ImageBase:           ti.imageBase,
+			SectionAlignment:    0x1000,
+			FileAlignment:       testFileAlignment,
+			SizeOfImage:         imageSize,
+			SizeOfHeaders:       headerSize,
+			Subsystem:           IMAGE_SUBSYSTEM_WINDOWS_CUI,
+			NumberOfRvaAndSizes: 16,
+			DataDirectory:       dd,
+		})
+	}
+	offset := headerSize
+	for _, s := range ti.sections {
+		var sh SectionHeader32
+		copy(sh.Name[:], s.name)
+		sh.VirtualSize = uint32(len(s.data))
+		sh.VirtualAddress = s.va
+		sh.SizeOfRawData = testAlign(uint32(len(s.data)), testFileAlignment)
+		sh.PointerToRawData = offset
+		sh.Characteristics = s.chars
+		if sh.Characteristics == 0 {
+			sh.Characteristics = IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+		}
+		binary.Write(&buf, binary.LittleEndian, sh)
+		offset += sh.SizeOfRawData
+	}
+	buf.Write(make([]byte, int(headerSize)-buf.Len()))
+	for _, s := range ti.sections {
+		buf.Write(s.data)
+		buf.Write(make([]byte, int(testAlign(uint32(len(s.data)), testFileAlignment))-len(s.data)))
+	}
+	return buf.Bytes()
+}
+
+// open builds the image and parses it with NewFile.
+func (ti *testImage) open(t *testing.T) *File {
+	t.Helper()
+	f, err := NewFile(bytes.NewReader(ti.build()))
+	if err != nil {
+		t.Fatalf("NewFile of synthetic image: %v", err)
+	}
+	return f
+}
+
+func TestImageReader(t *testing.T) {
+	ti := &testImage{sections: []testSection{{name: ".data", va: 0x1000, data: []byte("0123456789abcdef")}}}
+	f := ti.open(t)
+	ir := imageReader{f}
+	b := make([]byte, 2)
+	if _, err := ir.ReadAt(b, 0x100e); err != nil || string(b) != "ef" {
+		t.Errorf("ReadAt(0x100e) = %q, %v", b, err)
+	}
+	// The raw data is padded to the file alignment, but the section
+	// ends at its virtual size for both helpers.
+	if s := f.sectionForRVA(0x1010); s != nil {
+		t.Errorf("sectionForRVA(0x1010) = %s", s.Name)
+	}
+	if _, err := ir.ReadAt(b, 0x100f); err == nil {
+		t.Error("ReadAt across the virtual size succeeded")
+	}
+}
+
+// le is a little-endian byte buffer for building directory contents.
+type le struct {
+	bytes.Buffer
+}
+
+func (b *le) u8(v uint8)   { b.WriteByte(v) }
+func (b *le) u16(v uint16) { binary.Write(b, binary.LittleEndian, v) }
+func (b *le) u32(v uint32) { binary.Write(b, binary.LittleEndian, v) }
+func (b *le) u64(v uint64) { binary.Write(b, binary.LittleEndian, v) }
+
+// utf16 writes s as UTF-16LE, without a terminator.
+func (b *le) utf16(s string) {
+	for _, r := range s {
+		b.u16(uint16(r))
+	}
+}
+
+// pad appends zeros up to offset n.
+func (b *le) pad(n int) {
+	for b.Len() < n {
+		b.WriteByte(0)
+	}
+}
@@ -0,0 +1,133 @@
+package pe
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+var (
+	ErrNotSigned     = errors.New("pe: image is not signed")
+	ErrImageTampered = errors.New("pe: image does not match its Authenticode digest")
+)
+
+// fileSize returns the size of the underlying file.
+func (f *File) fileSize() (int64, error) {
+	switch r := f.originalReader.(type) {
+	case nil:
+		return 0, errors.New("pe: file reader is nil")
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("pe: stat %v", err)
+		}
+		return fi.Size(), nil
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, fmt.Errorf("pe: seek %v", err)
+		}
+		defer r.Seek(cur, io.SeekStart)
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, fmt.Errorf("pe: seek %v", err)
+		}
+		return end, nil
+	}
+	return 0, errors.New("pe: cannot determine the file size")
+}
+
+// checkSumOffset returns the file offset of the CheckSum field of the
+// optional header, which is at the same place in PE32 and PE32+.
+func (f *File) checkSumOffset() int64 {
+	return f.optionalHeaderOffset + 64
+}
+
+// dataDirectoryOffset returns the file offset of the data directory
+// entry idx. It reports false if the optional header has no such entry.
+func (f *File) dataDirectoryOffset(idx int) (int64, bool) {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return f.optionalHeaderOffset + 96 + 8*int64(idx), uint32(idx) < oh.NumberOfRvaAndSizes
+	case *OptionalHeader64:
+		return f.optionalHeaderOffset + 112 + 8*int64(idx), uint32(idx) < oh.NumberOfRvaAndSizes
+	}
+	return 0, false
+}
+
+// AuthenticodeDigest computes the Authenticode digest of the image
+// with h. The digest covers the whole file except the CheckSum field,
+// the security directory entry and the attribute certificate table, so
+// it is not changed by signing the file.
+func (f *File) AuthenticodeDigest(h crypto.Hash) ([]byte, error) {
+	if h == 0 || !h.Available() {
+		return nil, fmt.Errorf("pe: hash function %v is not available", h)
+	}
+	if f.OptionalHeader == nil {
+		return nil, errors.New("pe: image has no optional header")
+	}
+	size, err := f.fileSize()
+	if err != nil {
+		return nil, err
+	}
+	// The excluded ranges, in file order.
+	type span struct{ off, n int64 }
+	skips := []span{{f.checkSumOffset(), 4}}
+	if off, ok := f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_SECURITY); ok {
+		skips = append(skips, span{off, 8})
+	}
+	if dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY); ok {
+		if int64(dd.VirtualAddress)+int64(dd.Size) > size || int64(dd.VirtualAddress) < skips[len(skips)-1].off+8 {
+			return nil, fmt.Errorf("pe: certificate table %#x+%#x out of file", dd.VirtualAddress, dd.Size)
+		}
+		skips = append(skips, span{int64(dd.VirtualAddress), int64(dd.Size)})
+	}
+	hh := h.New()
+	var pos int64
+	for _, s := range append(skips, span{size, 0}) {
+		if s.off > size {
+			return nil, fmt.Errorf("pe: header offset %#x out of file", s.off)
+		}
+		if _, err := io.Copy(hh, io.NewSectionReader(f.originalReader, pos, s.off-pos)); err != nil {
+			return nil, fmt.Errorf("fail to read image: %v", err)
+		}
+		pos = s.off + s.n
+	}
+	return hh.Sum(nil), nil
+}
+
+// VerifyAuthenticode checks the Authenticode signatures of the image:
+// each signature must be valid for its signer and its digest must match
+// the image. It returns ErrNotSigned if the image has no signature and
+// ErrImageTampered if a signature is valid but the image was modified
+// after signing. The signer chain is not checked against a trust store.
+func (f *File) VerifyAuthenticode() error {
+	sigs, err := f.LookupAuthenticode()
+	if err != nil {
+		return err
+	}
+	if len(sigs) == 0 {
+		return ErrNotSigned
+	}
+	for _, s := range sigs {
+		if err := s.VerifySignature(); err != nil {
+			return err
+		}
+		if s.DigestAlgorithm == 0 {
+			return fmt.Errorf("unsupported Authenticode digest algorithm %v", s.DigestAlgorithmOID)
+		}
+		digest, err := f.AuthenticodeDigest(s.DigestAlgorithm)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(digest, s.Digest) {
+			return ErrImageTampered
+		}
+	}
+	return nil
+}
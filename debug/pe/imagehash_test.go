@@ -0,0 +1,92 @@
+package pe
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+)
+
+// signedImage returns a test image signed by s with a correct
+// Authenticode digest.
+func signedImage(t *testing.T, s *testSigner) []byte {
+	t.Helper()
+	ti := &testImage{sections: []testSection{{name: ".text", va: 0x1000, data: bytes.Repeat([]byte{0xcc}, 0x10)}}}
+	img := ti.build()
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := f.AuthenticodeDigest(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := winCertificate(s.sign(t, crypto.SHA256, oidSHA256, digest))
+	ti.dirs = map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_SECURITY: {VirtualAddress: uint32(len(img)), Size: uint32(len(cert))},
+	}
+	return append(ti.build(), cert...)
+}
+
+func TestAuthenticodeDigest(t *testing.T) {
+	img := signedImage(t, newTestSigner(t))
+	digest := func(img []byte) []byte {
+		t.Helper()
+		f, err := NewFile(bytes.NewReader(img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := f.AuthenticodeDigest(crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := digest(img)
+
+	// The CheckSum and the certificate table are not covered; nor is
+	// the security directory entry, see signedImage.
+	mod := append([]byte(nil), img...)
+	mod[f.checkSumOffset()] ^= 0xff
+	mod[len(mod)-1] ^= 0xff
+	if g, _ := NewFile(bytes.NewReader(mod)); g.OptionalHeader.(*OptionalHeader64).CheckSum != 0xff {
+		t.Fatalf("CheckSum offset %#x is wrong", f.checkSumOffset())
+	}
+	if got := digest(mod); !bytes.Equal(got, want) {
+		t.Errorf("digest changed by excluded fields: %x, want %x", got, want)
+	}
+
+	mod = append([]byte(nil), img...)
+	mod[f.Sections[0].Offset] ^= 0xff
+	if got := digest(mod); bytes.Equal(got, want) {
+		t.Error("digest not changed by section data")
+	}
+}
+
+func TestVerifyAuthenticode(t *testing.T) {
+	img := signedImage(t, newTestSigner(t))
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.VerifyAuthenticode(); err != nil {
+		t.Fatalf("VerifyAuthenticode: %v", err)
+	}
+
+	img[f.Sections[0].Offset] = 0x90
+	if f, err = NewFile(bytes.NewReader(img)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.VerifyAuthenticode(); !errors.Is(err, ErrImageTampered) {
+		t.Errorf("VerifyAuthenticode of tampered image = %v, want ErrImageTampered", err)
+	}
+
+	ti := &testImage{sections: []testSection{{name: ".text", va: 0x1000, data: make([]byte, 0x10)}}}
+	if err := ti.open(t).VerifyAuthenticode(); err != ErrNotSigned {
+		t.Errorf("VerifyAuthenticode of unsigned image = %v, want ErrNotSigned", err)
+	}
+}
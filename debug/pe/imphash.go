@@ -0,0 +1,79 @@
+package pe
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ordinalName returns the name of the export ordinal of dll, or ordN if
+// it is not known.
+func ordinalName(dll string, ordinal int) string {
+	if name, ok := ordinalNames[strings.ToLower(dll)][uint16(ordinal)]; ok {
+		return name
+	}
+	return fmt.Sprintf("ord%d", ordinal)
+}
+
+// ImpHash computes the import hash of the image, compatible with
+// pefile's get_imphash: the MD5 of the comma separated, lower case
+// dll.function pairs in import directory order, descriptor by
+// descriptor even when a DLL has several. The .dll, .ocx and
+// .sys extensions are dropped from the module names, and imports by
+// ordinal are named by ordinal lookup. Delay-load imports are not
+// included. The hash of an image without imports is "", as for pefile.
+func (f *File) ImpHash() (string, error) {
+	ft, err := f.LookupFunctionTable()
+	if err != nil {
+		return "", err
+	}
+	if len(ft.ImportDescriptors) == 0 {
+		return "", nil
+	}
+	var items []string
+	for _, desc := range ft.ImportDescriptors {
+		dll := desc.DllName
+		lib := strings.ToLower(dll)
+		if i := strings.LastIndexByte(lib, '.'); i >= 0 {
+			switch lib[i+1:] {
+			case "dll", "ocx", "sys":
+				lib = lib[:i]
+			}
+		}
+		for _, fn := range desc.Functions {
+			name := fn.Name
+			if name == "" {
+				name = ordinalName(dll, fn.Ordinal)
+			}
+			items = append(items, lib+"."+strings.ToLower(name))
+		}
+	}
+	sum := md5.Sum([]byte(strings.Join(items, ",")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ExpHash computes a hash of the exports of the image, the counterpart
+// of ImpHash: the MD5 of the comma separated, lower case and sorted
+// export names. Exports without a name are included as ordN.
+func (f *File) ExpHash() (string, error) {
+	exports, err := f.LookupExports()
+	if err != nil {
+		return "", err
+	}
+	items := make([]string, 0, len(exports))
+	for _, e := range exports {
+		if e.Address == 0 && e.ForwardName == "" {
+			continue // unused slot of the export address table
+		}
+		name := e.Name
+		if name == "" {
+			name = fmt.Sprintf("ord%d", e.Ordinal)
+		}
+		items = append(items, strings.ToLower(name))
+	}
+	sort.Strings(items)
+	sum := md5.Sum([]byte(strings.Join(items, ",")))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,239 @@
+package pe
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestImpHash(t *testing.T) {
+	for _, tt := range []struct {
+		file, want string
+	}{
+		{"testdata/gcc-amd64-mingw-exec", "66a73da58ce4083636bcd1bf6a51870c"},
+		{"testdata/gcc-386-mingw-exec", "afe54265af0ee5570cb87b013a2f38da"},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.ImpHash()
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+		} else if got != tt.want {
+			t.Errorf("%s: ImpHash = %s, want %s", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestImpHashNoImports(t *testing.T) {
+	ti := &testImage{sections: []testSection{{name: ".text", va: 0x1000, data: make([]byte, 0x100)}}}
+	got, err := ti.open(t).ImpHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("ImpHash of an image without imports = %q, want \"\"", got)
+	}
+}
+
+func TestImpHashOrdinals(t *testing.T) {
+	var b le
+	for _, d := range [][2]uint32{{0x1080, 0x1060}, {0x10a0, 0x1070}} {
+		b.u32(d[0]) // OriginalFirstThunk
+		b.u32(0)
+		b.u32(0)
+		b.u32(d[1]) // Name
+		b.u32(d[0] + 0x1000)
+	}
+	b.pad(0x60)
+	b.WriteString("WS2_32.dll\x00")
+	b.pad(0x70)
+	b.WriteString("OLEAUT32.dll\x00")
+	b.pad(0x80)
+	b.u64(0x8000000000000000 | 115)
+	b.u64(0x10c0)
+	b.u64(0)
+	b.pad(0xa0)
+	b.u64(0x8000000000000000 | 9)
+	b.u64(0x8000000000000000 | 999)
+	b.u64(0)
+	b.pad(0xc0)
+	b.u16(0)
+	b.WriteString("WSAGetLastError\x00")
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_IMPORT: {VirtualAddress: 0x1000, Size: 0x3c},
+		},
+		sections: []testSection{
+			{name: ".idata", va: 0x1000, data: b.Bytes()},
+			{name: ".data", va: 0x2000, data: make([]byte, 0x100)},
+		},
+	}
+	got, err := ti.open(t).ImpHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := md5Hex("ws2_32.wsastartup,ws2_32.wsagetlasterror,oleaut32.variantclear,oleaut32.ord999")
+	if got != want {
+		t.Errorf("ImpHash = %s, want %s", got, want)
+	}
+}
+
+// TestImpHashSplitDescriptors checks that the descriptors of a DLL
+// split by another one are hashed in directory order, like pefile.
+func TestImpHashSplitDescriptors(t *testing.T) {
+	var b le
+	for _, d := range [][2]uint32{{0x1080, 0x1060}, {0x10a0, 0x1070}, {0x10c0, 0x1060}} {
+		b.u32(d[0]) // OriginalFirstThunk
+		b.u32(0)
+		b.u32(0)
+		b.u32(d[1]) // Name
+		b.u32(d[0] + 0x1000)
+	}
+	b.pad(0x60)
+	b.WriteString("WS2_32.dll\x00")
+	b.pad(0x70)
+	b.WriteString("OLEAUT32.dll\x00")
+	b.pad(0x80)
+	b.u64(0x8000000000000000 | 115)
+	b.u64(0)
+	b.pad(0xa0)
+	b.u64(0x8000000000000000 | 9)
+	b.u64(0)
+	b.pad(0xc0)
+	b.u64(0x10e0)
+	b.u64(0)
+	b.pad(0xe0)
+	b.u16(0)
+	b.WriteString("WSAGetLastError\x00")
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_IMPORT: {VirtualAddress: 0x1000, Size: 0x50},
+		},
+		sections: []testSection{
+			{name: ".idata", va: 0x1000, data: b.Bytes()},
+			{name: ".data", va: 0x2000, data: make([]byte, 0x100)},
+		},
+	}
+	f := ti.open(t)
+	got, err := f.ImpHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := md5Hex("ws2_32.wsastartup,oleaut32.variantclear,ws2_32.wsagetlasterror")
+	if got != want {
+		t.Errorf("ImpHash = %s, want %s", got, want)
+	}
+	ft, err := f.LookupFunctionTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.ImportDescriptors) != 3 || len(ft.ImportOrder) != 2 || len(ft.Imports["WS2_32.dll"]) != 2 {
+		t.Errorf("ImportDescriptors = %+v, ImportOrder = %v, Imports = %+v", ft.ImportDescriptors, ft.ImportOrder, ft.Imports)
+	}
+}
+
+func TestExpHash(t *testing.T) {
+	var b le
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0x1080) // Name
+	b.u32(1)      // Base
+	b.u32(3)      // NumberOfFunctions
+	b.u32(2)      // NumberOfNames
+	b.u32(0x1040)
+	b.u32(0x1050)
+	b.u32(0x1060)
+	b.pad(0x40)
+	b.u32(0x2000)
+	b.u32(0x2010)
+	b.u32(0x2020)
+	b.pad(0x50)
+	b.u32(0x1070)
+	b.u32(0x1078)
+	b.pad(0x60)
+	b.u16(1)
+	b.u16(0)
+	b.pad(0x70)
+	b.WriteString("alpha\x00")
+	b.pad(0x78)
+	b.WriteString("Zeta\x00")
+	b.pad(0x80)
+	b.WriteString("test.dll\x00")
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_EXPORT: {VirtualAddress: 0x1000, Size: 0x90},
+		},
+		sections: []testSection{{name: ".edata", va: 0x1000, data: b.Bytes()}},
+	}
+	got, err := ti.open(t).ExpHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := md5Hex("alpha,ord3,zeta"); got != want {
+		t.Errorf("ExpHash = %s, want %s", got, want)
+	}
+}
+
+func TestLookupExportsOrdinalOnly(t *testing.T) {
+	var b le
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(0x1060) // Name
+	b.u32(5)      // Base
+	b.u32(2)      // NumberOfFunctions
+	b.u32(0)      // NumberOfNames
+	b.u32(0x1040)
+	b.pad(0x40)
+	b.u32(0x2000)
+	b.u32(0x2010)
+	b.pad(0x60)
+	b.WriteString("mfc.dll\x00")
+
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_EXPORT: {VirtualAddress: 0x1000, Size: 0x68},
+		},
+		sections: []testSection{{name: ".edata", va: 0x1000, data: b.Bytes()}},
+	}
+	f := ti.open(t)
+	exports, err := f.LookupExports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportedSymbol{{Address: 0x2000, Ordinal: 5, Hint: -1}, {Address: 0x2010, Ordinal: 6, Hint: -1}}
+	if !reflect.DeepEqual(exports, want) {
+		t.Errorf("LookupExports = %+v, want %+v", exports, want)
+	}
+	got, err := f.ExpHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := md5Hex("ord5,ord6"); got != want {
+		t.Errorf("ExpHash = %s, want %s", got, want)
+	}
+
+	// The count of functions is bounded by the section.
+	binary.LittleEndian.PutUint32(ti.sections[0].data[20:], 0xffffffff)
+	exports, err = ti.open(t).LookupExports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ti.sections[0].data) / 4; len(exports) > n {
+		t.Errorf("LookupExports of 0xffffffff functions = %d exports, want at most %d", len(exports), n)
+	}
+}
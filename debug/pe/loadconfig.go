@@ -0,0 +1,413 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Control flow guard flags of LoadConfig.GuardFlags.
+const (
+	IMAGE_GUARD_CF_INSTRUMENTED                    = 0x00000100
+	IMAGE_GUARD_CFW_INSTRUMENTED                   = 0x00000200
+	IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT          = 0x00000400
+	IMAGE_GUARD_SECURITY_COOKIE_UNUSED             = 0x00000800
+	IMAGE_GUARD_PROTECT_DELAYLOAD_IAT              = 0x00001000
+	IMAGE_GUARD_DELAYLOAD_IAT_IN_ITS_OWN_SECTION   = 0x00002000
+	IMAGE_GUARD_CF_EXPORT_SUPPRESSION_INFO_PRESENT = 0x00004000
+	IMAGE_GUARD_CF_ENABLE_EXPORT_SUPPRESSION       = 0x00008000
+	IMAGE_GUARD_CF_LONGJUMP_TABLE_PRESENT          = 0x00010000
+	IMAGE_GUARD_RF_INSTRUMENTED                    = 0x00020000
+	IMAGE_GUARD_RF_ENABLE                          = 0x00040000
+	IMAGE_GUARD_RF_STRICT                          = 0x00080000
+	IMAGE_GUARD_RETPOLINE_PRESENT                  = 0x00100000
+	IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT      = 0x00400000
+	IMAGE_GUARD_XFG_ENABLED                        = 0x00800000
+	IMAGE_GUARD_CASTGUARD_PRESENT                  = 0x01000000
+	IMAGE_GUARD_MEMCPY_PRESENT                     = 0x02000000
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK        = 0xF0000000
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT       = 28
+)
+
+// Flags of GuardFunction entries.
+const (
+	IMAGE_GUARD_FLAG_FID_SUPPRESSED       = 0x01
+	IMAGE_GUARD_FLAG_EXPORT_SUPPRESSED    = 0x02
+	IMAGE_GUARD_FLAG_FID_LANGEXCPTHANDLER = 0x04
+	IMAGE_GUARD_FLAG_FID_XFG              = 0x08
+)
+
+// Symbols of dynamic value relocations.
+const (
+	IMAGE_DYNAMIC_RELOCATION_GUARD_RF_PROLOGUE                 = 1
+	IMAGE_DYNAMIC_RELOCATION_GUARD_RF_EPILOGUE                 = 2
+	IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER     = 3
+	IMAGE_DYNAMIC_RELOCATION_GUARD_INDIR_CONTROL_TRANSFER      = 4
+	IMAGE_DYNAMIC_RELOCATION_GUARD_SWITCHTABLE_BRANCH          = 5
+	IMAGE_DYNAMIC_RELOCATION_ARM64X                            = 6
+	IMAGE_DYNAMIC_RELOCATION_FUNCTION_OVERRIDE                 = 7
+	IMAGE_DYNAMIC_RELOCATION_ARM64_KERNEL_IMPORT_CALL_TRANSFER = 8
+)
+
+// LoadConfigCodeIntegrity is IMAGE_LOAD_CONFIG_CODE_INTEGRITY.
+type LoadConfigCodeIntegrity struct {
+	Flags         uint16
+	Catalog       uint16
+	CatalogOffset uint32
+	Reserved      uint32
+}
+
+// LoadConfig is the load configuration directory of an image
+// (IMAGE_LOAD_CONFIG_DIRECTORY32 or IMAGE_LOAD_CONFIG_DIRECTORY64).
+// The structure grew with every Windows release and Size tells how much
+// of it the linker emitted; fields past Size are zero. Pointer sized
+// fields are widened to 64 bits and hold VAs.
+type LoadConfig struct {
+	Size                                     uint32
+	TimeDateStamp                            uint32
+	MajorVersion                             uint16
+	MinorVersion                             uint16
+	GlobalFlagsClear                         uint32
+	GlobalFlagsSet                           uint32
+	CriticalSectionDefaultTimeout            uint32
+	DeCommitFreeBlockThreshold               uint64
+	DeCommitTotalFreeThreshold               uint64
+	LockPrefixTable                          uint64
+	MaximumAllocationSize                    uint64
+	VirtualMemoryThreshold                   uint64
+	ProcessAffinityMask                      uint64
+	ProcessHeapFlags                         uint32
+	CSDVersion                               uint16
+	DependentLoadFlags                       uint16
+	EditList                                 uint64
+	SecurityCookie                           uint64
+	SEHandlerTable                           uint64
+	SEHandlerCount                           uint64
+	GuardCFCheckFunctionPointer              uint64
+	GuardCFDispatchFunctionPointer           uint64
+	GuardCFFunctionTable                     uint64
+	GuardCFFunctionCount                     uint64
+	GuardFlags                               uint32
+	CodeIntegrity                            LoadConfigCodeIntegrity
+	GuardAddressTakenIatEntryTable           uint64
+	GuardAddressTakenIatEntryCount           uint64
+	GuardLongJumpTargetTable                 uint64
+	GuardLongJumpTargetCount                 uint64
+	DynamicValueRelocTable                   uint64
+	CHPEMetadataPointer                      uint64
+	GuardRFFailureRoutine                    uint64
+	GuardRFFailureRoutineFunctionPointer     uint64
+	DynamicValueRelocTableOffset             uint32
+	DynamicValueRelocTableSection            uint16
+	Reserved2                                uint16
+	GuardRFVerifyStackPointerFunctionPointer uint64
+	HotPatchTableOffset                      uint32
+	Reserved3                                uint32
+	EnclaveConfigurationPointer              uint64
+	VolatileMetadataPointer                  uint64
+	GuardEHContinuationTable                 uint64
+	GuardEHContinuationCount                 uint64
+	GuardXFGCheckFunctionPointer             uint64
+	GuardXFGDispatchFunctionPointer          uint64
+	GuardXFGTableDispatchFunctionPointer     uint64
+	CastGuardOsDeterminedFailureMode         uint64
+	GuardMemcpyFunctionPointer               uint64
+
+	f *File
+}
+
+// loadConfigReader reads the fields of a load configuration directory
+// in order, yielding zero for fields past its end.
+type loadConfigReader struct {
+	b    []byte
+	off  int
+	pe64 bool
+}
+
+func (r *loadConfigReader) u16() uint16 {
+	defer func() { r.off += 2 }()
+	if r.off+2 > len(r.b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(r.b[r.off:])
+}
+
+func (r *loadConfigReader) u32() uint32 {
+	defer func() { r.off += 4 }()
+	if r.off+4 > len(r.b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(r.b[r.off:])
+}
+
+func (r *loadConfigReader) ptr() uint64 {
+	if !r.pe64 {
+		return uint64(r.u32())
+	}
+	defer func() { r.off += 8 }()
+	if r.off+8 > len(r.b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(r.b[r.off:])
+}
+
+// maxLoadConfigSize bounds the Size field of malformed images.
+const maxLoadConfigSize = 0x1000
+
+// LookupLoadConfig decodes the load configuration directory of the
+// image. It returns nil and no error if the image has none.
+func (f *File) LookupLoadConfig() (*LoadConfig, error) {
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG)
+	if !ok {
+		return nil, nil
+	}
+	// The loader trusts the Size field of the structure rather than
+	// the size of the data directory entry, which old linkers got wrong.
+	b, err := f.readRVA(dd.VirtualAddress, 4)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read load config directory: %v", err)
+	}
+	size := binary.LittleEndian.Uint32(b)
+	if size < 4 || size > maxLoadConfigSize {
+		return nil, fmt.Errorf("invalid load config directory size %d", size)
+	}
+	b, err = f.readRVA(dd.VirtualAddress, size)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read load config directory: %v", err)
+	}
+	r := &loadConfigReader{b: b, pe64: f.is64()}
+	lc := &LoadConfig{f: f}
+	lc.Size = r.u32()
+	lc.TimeDateStamp = r.u32()
+	lc.MajorVersion = r.u16()
+	lc.MinorVersion = r.u16()
+	lc.GlobalFlagsClear = r.u32()
+	lc.GlobalFlagsSet = r.u32()
+	lc.CriticalSectionDefaultTimeout = r.u32()
+	lc.DeCommitFreeBlockThreshold = r.ptr()
+	lc.DeCommitTotalFreeThreshold = r.ptr()
+	lc.LockPrefixTable = r.ptr()
+	lc.MaximumAllocationSize = r.ptr()
+	lc.VirtualMemoryThreshold = r.ptr()
+	if r.pe64 {
+		lc.ProcessAffinityMask = r.ptr()
+		lc.ProcessHeapFlags = r.u32()
+	} else {
+		// The 32-bit structure swaps these two fields.
+		lc.ProcessHeapFlags = r.u32()
+		lc.ProcessAffinityMask = r.ptr()
+	}
+	lc.CSDVersion = r.u16()
+	lc.DependentLoadFlags = r.u16()
+	lc.EditList = r.ptr()
+	lc.SecurityCookie = r.ptr()
+	lc.SEHandlerTable = r.ptr()
+	lc.SEHandlerCount = r.ptr()
+	lc.GuardCFCheckFunctionPointer = r.ptr()
+	lc.GuardCFDispatchFunctionPointer = r.ptr()
+	lc.GuardCFFunctionTable = r.ptr()
+	lc.GuardCFFunctionCount = r.ptr()
+	lc.GuardFlags = r.u32()
+	lc.CodeIntegrity.Flags = r.u16()
+	lc.CodeIntegrity.Catalog = r.u16()
+	lc.CodeIntegrity.CatalogOffset = r.u32()
+	lc.CodeIntegrity.Reserved = r.u32()
+	lc.GuardAddressTakenIatEntryTable = r.ptr()
+	lc.GuardAddressTakenIatEntryCount = r.ptr()
+	lc.GuardLongJumpTargetTable = r.ptr()
+	lc.GuardLongJumpTargetCount = r.ptr()
+	lc.DynamicValueRelocTable = r.ptr()
+	lc.CHPEMetadataPointer = r.ptr()
+	lc.GuardRFFailureRoutine = r.ptr()
+	lc.GuardRFFailureRoutineFunctionPointer = r.ptr()
+	lc.DynamicValueRelocTableOffset = r.u32()
+	lc.DynamicValueRelocTableSection = r.u16()
+	lc.Reserved2 = r.u16()
+	lc.GuardRFVerifyStackPointerFunctionPointer = r.ptr()
+	lc.HotPatchTableOffset = r.u32()
+	lc.Reserved3 = r.u32()
+	lc.EnclaveConfigurationPointer = r.ptr()
+	lc.VolatileMetadataPointer = r.ptr()
+	lc.GuardEHContinuationTable = r.ptr()
+	lc.GuardEHContinuationCount = r.ptr()
+	lc.GuardXFGCheckFunctionPointer = r.ptr()
+	lc.GuardXFGDispatchFunctionPointer = r.ptr()
+	lc.GuardXFGTableDispatchFunctionPointer = r.ptr()
+	lc.CastGuardOsDeterminedFailureMode = r.ptr()
+	lc.GuardMemcpyFunctionPointer = r.ptr()
+	return lc, nil
+}
+
+// HasGuardCF reports whether the linker emitted control flow guard
+// instrumentation, as opposed to the image only claiming it with
+// IMAGE_DLLCHARACTERISTICS_GUARD_CF.
+func (lc *LoadConfig) HasGuardCF() bool {
+	return lc.GuardFlags&IMAGE_GUARD_CF_INSTRUMENTED != 0 && lc.GuardCFCheckFunctionPointer != 0
+}
+
+// GuardFunction is an entry of a guard table: the RVA of a valid
+// target and the IMAGE_GUARD_FLAG flags stored after it.
+type GuardFunction struct {
+	RVA   uint32
+	Flags uint8
+}
+
+// guardTable reads count entries of a guard table at va. Every entry
+// is an RVA followed by the number of metadata bytes encoded in
+// GuardFlags.
+func (lc *LoadConfig) guardTable(name string, va, count uint64) ([]GuardFunction, error) {
+	if va == 0 || count == 0 {
+		return nil, nil
+	}
+	stride := 4 + uint64(lc.GuardFlags&IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK>>IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT)
+	rva, ok := lc.f.vaToRVA(va)
+	if !ok || count > 0xffffffff/stride {
+		return nil, fmt.Errorf("invalid %s at %#x with %d entries", name, va, count)
+	}
+	b, err := lc.f.readRVA(rva, uint32(count*stride))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read %s: %v", name, err)
+	}
+	fns := make([]GuardFunction, count)
+	for i := range fns {
+		e := b[uint64(i)*stride:]
+		fns[i].RVA = binary.LittleEndian.Uint32(e)
+		if stride > 4 {
+			fns[i].Flags = e[4]
+		}
+	}
+	return fns, nil
+}
+
+// GuardCFFunctions returns the valid indirect call targets listed in
+// GuardCFFunctionTable.
+func (lc *LoadConfig) GuardCFFunctions() ([]GuardFunction, error) {
+	return lc.guardTable("guard CF function table", lc.GuardCFFunctionTable, lc.GuardCFFunctionCount)
+}
+
+// GuardAddressTakenIATEntries returns the IAT entries whose address is
+// taken, listed in GuardAddressTakenIatEntryTable.
+func (lc *LoadConfig) GuardAddressTakenIATEntries() ([]GuardFunction, error) {
+	return lc.guardTable("guard IAT table", lc.GuardAddressTakenIatEntryTable, lc.GuardAddressTakenIatEntryCount)
+}
+
+// GuardLongJumpTargets returns the valid longjmp targets.
+func (lc *LoadConfig) GuardLongJumpTargets() ([]GuardFunction, error) {
+	return lc.guardTable("guard longjmp table", lc.GuardLongJumpTargetTable, lc.GuardLongJumpTargetCount)
+}
+
+// GuardEHContinuations returns the valid exception handling
+// continuation targets.
+func (lc *LoadConfig) GuardEHContinuations() ([]GuardFunction, error) {
+	return lc.guardTable("EH continuation table", lc.GuardEHContinuationTable, lc.GuardEHContinuationCount)
+}
+
+// SEHandlers returns the RVAs of the safe exception handlers of a
+// 32-bit image.
+func (lc *LoadConfig) SEHandlers() ([]uint32, error) {
+	if lc.SEHandlerTable == 0 || lc.SEHandlerCount == 0 {
+		return nil, nil
+	}
+	rva, ok := lc.f.vaToRVA(lc.SEHandlerTable)
+	if !ok || lc.SEHandlerCount > 0xffffffff/4 {
+		return nil, fmt.Errorf("invalid SEH table at %#x with %d entries", lc.SEHandlerTable, lc.SEHandlerCount)
+	}
+	b, err := lc.f.readRVA(rva, uint32(lc.SEHandlerCount*4))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read SEH table: %v", err)
+	}
+	handlers := make([]uint32, lc.SEHandlerCount)
+	for i := range handlers {
+		handlers[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return handlers, nil
+}
+
+// DynamicRelocation is an entry of the dynamic value relocation table.
+// Fixups holds the undecoded fixup records, whose format depends on
+// Symbol; they are grouped in blocks like base relocations.
+type DynamicRelocation struct {
+	Symbol      uint64
+	SymbolGroup uint32 // version 2 only
+	Flags       uint32 // version 2 only
+	Fixups      []byte
+}
+
+// DynamicRelocationTable is IMAGE_DYNAMIC_RELOCATION_TABLE.
+type DynamicRelocationTable struct {
+	Version     uint32
+	Relocations []DynamicRelocation
+}
+
+// DynamicRelocations decodes the dynamic value relocation table. It
+// returns nil and no error if the image has none.
+func (lc *LoadConfig) DynamicRelocations() (*DynamicRelocationTable, error) {
+	var rva uint32
+	switch {
+	case lc.DynamicValueRelocTableSection != 0:
+		// The section number is 1-based and the offset relative to it.
+		i := int(lc.DynamicValueRelocTableSection) - 1
+		if i >= len(lc.f.Sections) {
+			return nil, fmt.Errorf("invalid dynamic relocation table section %d", lc.DynamicValueRelocTableSection)
+		}
+		rva = lc.f.Sections[i].VirtualAddress + lc.DynamicValueRelocTableOffset
+	case lc.DynamicValueRelocTable != 0:
+		var ok bool
+		if rva, ok = lc.f.vaToRVA(lc.DynamicValueRelocTable); !ok {
+			return nil, fmt.Errorf("invalid dynamic relocation table address %#x", lc.DynamicValueRelocTable)
+		}
+	default:
+		return nil, nil
+	}
+	b, err := lc.f.readRVA(rva, 8)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read dynamic relocation table: %v", err)
+	}
+	t := &DynamicRelocationTable{Version: binary.LittleEndian.Uint32(b)}
+	size := binary.LittleEndian.Uint32(b[4:])
+	if b, err = lc.f.readRVA(rva+8, size); err != nil {
+		return nil, fmt.Errorf("fail to read dynamic relocation table: %v", err)
+	}
+	pe64 := lc.f.is64()
+	for len(b) > 0 {
+		var r DynamicRelocation
+		switch t.Version {
+		case 1:
+			hdr := 8
+			if !pe64 {
+				hdr = 4
+			}
+			if len(b) < hdr+4 {
+				return nil, fmt.Errorf("dynamic relocation truncated")
+			}
+			if pe64 {
+				r.Symbol = binary.LittleEndian.Uint64(b)
+			} else {
+				r.Symbol = uint64(binary.LittleEndian.Uint32(b))
+			}
+			n := binary.LittleEndian.Uint32(b[hdr:])
+			b = b[hdr+4:]
+			if uint64(n) > uint64(len(b)) {
+				return nil, fmt.Errorf("dynamic relocation of symbol %d truncated", r.Symbol)
+			}
+			r.Fixups, b = b[:n], b[n:]
+		case 2:
+			if len(b) < 24 {
+				return nil, fmt.Errorf("dynamic relocation truncated")
+			}
+			headerSize := binary.LittleEndian.Uint32(b)
+			fixupSize := binary.LittleEndian.Uint32(b[4:])
+			r.Symbol = binary.LittleEndian.Uint64(b[8:])
+			r.SymbolGroup = binary.LittleEndian.Uint32(b[16:])
+			r.Flags = binary.LittleEndian.Uint32(b[20:])
+			if headerSize < 24 || uint64(headerSize)+uint64(fixupSize) > uint64(len(b)) {
+				return nil, fmt.Errorf("dynamic relocation of symbol %d truncated", r.Symbol)
+			}
+			r.Fixups = b[headerSize : headerSize+fixupSize]
+			b = b[headerSize+fixupSize:]
+		default:
+			return nil, fmt.Errorf("unsupported dynamic relocation table version %d", t.Version)
+		}
+		t.Relocations = append(t.Relocations, r)
+	}
+	return t, nil
+}
@@ -0,0 +1,147 @@
+package pe
+
+import "testing"
+
+func TestLookupLoadConfig64(t *testing.T) {
+	const base = 0x140000000
+	var b le
+	b.u32(0x140) // Size, up to GuardMemcpyFunctionPointer
+	b.pad(0x58)
+	b.u64(base + 0x3000) // SecurityCookie
+	b.pad(0x70)
+	b.u64(base + 0x1000) // GuardCFCheckFunctionPointer
+	b.u64(base + 0x1008) // GuardCFDispatchFunctionPointer
+	b.u64(base + 0x2200) // GuardCFFunctionTable
+	b.u64(3)             // GuardCFFunctionCount
+	b.u32(IMAGE_GUARD_CF_INSTRUMENTED | IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT |
+		IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT | 1<<IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT)
+	b.pad(0xc0)
+	b.u64(0)             // DynamicValueRelocTable
+	b.u64(base + 0x3100) // CHPEMetadataPointer
+	b.pad(0xe0)
+	b.u32(0x400) // DynamicValueRelocTableOffset
+	b.u16(2)     // DynamicValueRelocTableSection
+	b.pad(0x108)
+	b.u64(base + 0x2300) // GuardEHContinuationTable
+	b.u64(1)             // GuardEHContinuationCount
+	b.pad(0x140)
+
+	b.pad(0x200)
+	for i, rva := range []uint32{0x1010, 0x1020, 0x1030} {
+		b.u32(rva)
+		b.u8(uint8(i))
+	}
+	b.pad(0x300)
+	b.u32(0x1040)
+	b.u8(0)
+	// Dynamic value relocation table, version 1, at .rdata+0x400.
+	b.pad(0x400)
+	b.u32(1)
+	b.u32(12 + 12)
+	b.u64(IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER)
+	b.u32(12)
+	b.u32(0x1000) // block page
+	b.u32(12)     // block size
+	b.u32(0x12345678)
+
+	ti := &testImage{
+		imageBase: base,
+		dirs: map[int]DataDirectory{
+			// Old linkers put 0x40 here, the structure size wins.
+			IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG: {VirtualAddress: 0x2000, Size: 0x40},
+		},
+		sections: []testSection{
+			{name: ".text", va: 0x1000, data: make([]byte, 0x100)},
+			{name: ".rdata", va: 0x2000, data: b.Bytes()},
+		},
+	}
+	lc, err := ti.open(t).LookupLoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.Size != 0x140 || lc.SecurityCookie != base+0x3000 || lc.CHPEMetadataPointer != base+0x3100 {
+		t.Errorf("LoadConfig = %+v", lc)
+	}
+	if !lc.HasGuardCF() {
+		t.Error("HasGuardCF = false")
+	}
+	fns, err := lc.GuardCFFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fns) != 3 || fns[1] != (GuardFunction{0x1020, 1}) || fns[2] != (GuardFunction{0x1030, 2}) {
+		t.Errorf("GuardCFFunctions = %v", fns)
+	}
+	// With 4-byte entries a count of 1<<62 wraps the table size to 0.
+	huge := *lc
+	huge.GuardFlags &^= IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK
+	huge.GuardCFFunctionCount = 1 << 62
+	if fns, err := huge.GuardCFFunctions(); err == nil {
+		t.Errorf("GuardCFFunctions with %d entries = %v, want error", huge.GuardCFFunctionCount, fns)
+	}
+	eh, err := lc.GuardEHContinuations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eh) != 1 || eh[0].RVA != 0x1040 {
+		t.Errorf("GuardEHContinuations = %v", eh)
+	}
+	dyn, err := lc.DynamicRelocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dyn.Version != 1 || len(dyn.Relocations) != 1 {
+		t.Fatalf("DynamicRelocations = %+v", dyn)
+	}
+	if r := dyn.Relocations[0]; r.Symbol != IMAGE_DYNAMIC_RELOCATION_GUARD_IMPORT_CONTROL_TRANSFER || len(r.Fixups) != 12 {
+		t.Errorf("dynamic relocation = %+v", r)
+	}
+}
+
+func TestLookupLoadConfig32(t *testing.T) {
+	const base = 0x400000
+	var b le
+	b.u32(0x48) // Size of the Windows XP structure, up to SEHandlerCount
+	b.pad(0x2c)
+	b.u32(0x1234) // ProcessHeapFlags
+	b.u32(0x0f)   // ProcessAffinityMask
+	b.pad(0x3c)
+	b.u32(base + 0x3000) // SecurityCookie
+	b.u32(base + 0x2100) // SEHandlerTable
+	b.u32(2)             // SEHandlerCount
+	b.u32(base + 0x1000) // past Size, must be ignored
+	b.pad(0x100)
+	b.u32(0x1010)
+	b.u32(0x1020)
+	ti := &testImage{
+		pe32:      true,
+		imageBase: base,
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG: {VirtualAddress: 0x2000, Size: 0x48},
+		},
+		sections: []testSection{
+			{name: ".text", va: 0x1000, data: make([]byte, 0x100)},
+			{name: ".rdata", va: 0x2000, data: b.Bytes()},
+		},
+	}
+	lc, err := ti.open(t).LookupLoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.ProcessHeapFlags != 0x1234 || lc.ProcessAffinityMask != 0x0f || lc.SecurityCookie != base+0x3000 {
+		t.Errorf("LoadConfig = %+v", lc)
+	}
+	if lc.GuardCFCheckFunctionPointer != 0 || lc.HasGuardCF() {
+		t.Errorf("fields past Size decoded: %+v", lc)
+	}
+	h, err := lc.SEHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[0] != 0x1010 || h[1] != 0x1020 {
+		t.Errorf("SEHandlers = %v", h)
+	}
+	if dyn, err := lc.DynamicRelocations(); dyn != nil || err != nil {
+		t.Errorf("DynamicRelocations = %v, %v; want nil, nil", dyn, err)
+	}
+}
@@ -0,0 +1,186 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Requested execution levels of an application manifest.
+const (
+	ExecutionLevelAsInvoker            = "asInvoker"
+	ExecutionLevelHighestAvailable     = "highestAvailable"
+	ExecutionLevelRequireAdministrator = "requireAdministrator"
+)
+
+// AssemblyIdentity identifies a side-by-side assembly.
+type AssemblyIdentity struct {
+	Type                  string `xml:"type,attr"`
+	Name                  string `xml:"name,attr"`
+	Version               string `xml:"version,attr"`
+	ProcessorArchitecture string `xml:"processorArchitecture,attr"`
+	PublicKeyToken        string `xml:"publicKeyToken,attr"`
+	Language              string `xml:"language,attr"`
+}
+
+func (id AssemblyIdentity) String() string {
+	var b strings.Builder
+	b.WriteString(id.Name)
+	for _, s := range []string{id.Version, id.ProcessorArchitecture, id.PublicKeyToken, id.Language} {
+		if s != "" {
+			b.WriteByte(',')
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// Manifest is a decoded side-by-side application or assembly manifest.
+type Manifest struct {
+	Identity       AssemblyIdentity   // identity of the manifest itself
+	ExecutionLevel string             // requestedExecutionLevel, "" if not given
+	UIAccess       bool               // requestedExecutionLevel uiAccess
+	Dependencies   []AssemblyIdentity // dependentAssembly entries
+	DPIAware       string             // dpiAware value, such as "true/pm"
+	DPIAwareness   string             // dpiAwareness value, such as "PerMonitorV2"
+	LongPathAware  bool
+	SupportedOS    []string // supportedOS Id GUIDs
+	Files          []string // file names of an assembly manifest
+}
+
+// manifestXML mirrors the parts of the manifest schema we decode. The
+// tags have no namespace so they match the asm.v1, asm.v2 and asm.v3
+// spellings alike.
+type manifestXML struct {
+	Identity   AssemblyIdentity `xml:"assemblyIdentity"`
+	TrustInfo  []manifestTrust  `xml:"trustInfo"`
+	Dependency []struct {
+		Assemblies []struct {
+			Identity AssemblyIdentity `xml:"assemblyIdentity"`
+		} `xml:"dependentAssembly"`
+	} `xml:"dependency"`
+	Files []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"file"`
+	Application   []manifestApplication `xml:"application"`
+	Compatibility []struct {
+		Application []struct {
+			SupportedOS []struct {
+				ID string `xml:"Id,attr"`
+			} `xml:"supportedOS"`
+		} `xml:"application"`
+	} `xml:"compatibility"`
+}
+
+type manifestTrust struct {
+	Security []struct {
+		Privileges []struct {
+			Level []struct {
+				Level    string `xml:"level,attr"`
+				UIAccess string `xml:"uiAccess,attr"`
+			} `xml:"requestedExecutionLevel"`
+		} `xml:"requestedPrivileges"`
+	} `xml:"security"`
+}
+
+type manifestApplication struct {
+	WindowsSettings []struct {
+		DPIAware      []string `xml:"dpiAware"`
+		DPIAwareness  []string `xml:"dpiAwareness"`
+		LongPathAware []string `xml:"longPathAware"`
+	} `xml:"windowsSettings"`
+}
+
+// LookupManifest finds the first RT_MANIFEST resource of the image and
+// parses it. It returns nil and no error if the image has no manifest.
+func (f *File) LookupManifest() (*Manifest, error) {
+	rs, err := f.LookupResourcesByType(RT_MANIFEST)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, nil
+	}
+	data, err := rs[0].Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read manifest resource: %v", err)
+	}
+	return ParseManifest(data)
+}
+
+// manifestText returns the manifest as UTF-8, dropping a byte order
+// mark and converting UTF-16 manifests.
+func manifestText(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return data[3:]
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}), bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		var order binary.ByteOrder = binary.LittleEndian
+		if data[0] == 0xfe {
+			order = binary.BigEndian
+		}
+		u := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			u = append(u, order.Uint16(data[i:]))
+		}
+		return []byte(string(utf16.Decode(u)))
+	}
+	return data
+}
+
+// ParseManifest decodes a side-by-side manifest.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var mx manifestXML
+	d := xml.NewDecoder(bytes.NewReader(manifestText(data)))
+	// The text is already UTF-8 whatever the declaration says.
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := d.Decode(&mx); err != nil {
+		return nil, fmt.Errorf("fail to parse manifest: %v", err)
+	}
+	m := &Manifest{Identity: mx.Identity}
+	for _, t := range mx.TrustInfo {
+		for _, s := range t.Security {
+			for _, p := range s.Privileges {
+				for _, l := range p.Level {
+					m.ExecutionLevel = l.Level
+					m.UIAccess = strings.EqualFold(l.UIAccess, "true")
+				}
+			}
+		}
+	}
+	for _, dep := range mx.Dependency {
+		for _, a := range dep.Assemblies {
+			m.Dependencies = append(m.Dependencies, a.Identity)
+		}
+	}
+	for _, app := range mx.Application {
+		for _, ws := range app.WindowsSettings {
+			for _, s := range ws.DPIAware {
+				m.DPIAware = strings.TrimSpace(s)
+			}
+			for _, s := range ws.DPIAwareness {
+				m.DPIAwareness = strings.TrimSpace(s)
+			}
+			for _, s := range ws.LongPathAware {
+				m.LongPathAware = strings.EqualFold(strings.TrimSpace(s), "true")
+			}
+		}
+	}
+	for _, c := range mx.Compatibility {
+		for _, app := range c.Application {
+			for _, os := range app.SupportedOS {
+				m.SupportedOS = append(m.SupportedOS, os.ID)
+			}
+		}
+	}
+	for _, file := range mx.Files {
+		m.Files = append(m.Files, file.Name)
+	}
+	return m, nil
+}
@@ -0,0 +1,128 @@
+package pe
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+const testManifest = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="Example.App" version="1.0.0.0" processorArchitecture="amd64"/>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="requireAdministrator" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0"
+        processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+  </dependency>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Example.Private" version="2.1.0.0" processorArchitecture="amd64"/>
+    </dependentAssembly>
+  </dependency>
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true/pm</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">PerMonitorV2</dpiAwareness>
+      <longPathAware xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">true</longPathAware>
+    </windowsSettings>
+  </application>
+</assembly>`
+
+func checkTestManifest(t *testing.T, m *Manifest) {
+	t.Helper()
+	if m.Identity.Name != "Example.App" || m.Identity.ProcessorArchitecture != "amd64" {
+		t.Errorf("Identity = %+v", m.Identity)
+	}
+	if m.ExecutionLevel != ExecutionLevelRequireAdministrator || m.UIAccess {
+		t.Errorf("ExecutionLevel, UIAccess = %q, %v", m.ExecutionLevel, m.UIAccess)
+	}
+	if len(m.Dependencies) != 2 {
+		t.Fatalf("got %d dependencies, want 2", len(m.Dependencies))
+	}
+	want := AssemblyIdentity{
+		Type:                  "win32",
+		Name:                  "Microsoft.Windows.Common-Controls",
+		Version:               "6.0.0.0",
+		ProcessorArchitecture: "*",
+		PublicKeyToken:        "6595b64144ccf1df",
+		Language:              "*",
+	}
+	if m.Dependencies[0] != want {
+		t.Errorf("Dependencies[0] = %+v, want %+v", m.Dependencies[0], want)
+	}
+	if got := m.Dependencies[1].String(); got != "Example.Private,2.1.0.0,amd64" {
+		t.Errorf("Dependencies[1] = %s", got)
+	}
+	if m.DPIAware != "true/pm" || m.DPIAwareness != "PerMonitorV2" || !m.LongPathAware {
+		t.Errorf("DPIAware, DPIAwareness, LongPathAware = %q, %q, %v", m.DPIAware, m.DPIAwareness, m.LongPathAware)
+	}
+	if len(m.SupportedOS) != 2 || m.SupportedOS[0] != "{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}" {
+		t.Errorf("SupportedOS = %v", m.SupportedOS)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestManifest(t, m)
+
+	// UTF-16 with a byte order mark.
+	var b le
+	b.u16(0xfeff)
+	for _, c := range utf16.Encode([]rune(testManifest)) {
+		b.u16(c)
+	}
+	m, err = ParseManifest(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestManifest(t, m)
+
+	if _, err := ParseManifest([]byte("<assembly><dependency>")); err == nil {
+		t.Error("ParseManifest of truncated XML succeeded")
+	}
+}
+
+func TestParseAssemblyManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(`<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="Example.Private" version="2.1.0.0" processorArchitecture="amd64"/>
+  <file name="private1.dll"/>
+  <file name="private2.dll"/>
+</assembly>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Files[0] != "private1.dll" || m.Files[1] != "private2.dll" {
+		t.Errorf("Files = %v", m.Files)
+	}
+	if m.ExecutionLevel != "" || len(m.Dependencies) != 0 {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+}
+
+func TestLookupManifest(t *testing.T) {
+	ti := singleResourceImage(RT_MANIFEST, []byte(testManifest))
+	m, err := ti.open(t).LookupManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil {
+		t.Fatal("LookupManifest found no manifest")
+	}
+	checkTestManifest(t, m)
+}
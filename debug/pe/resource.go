@@ -0,0 +1,242 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Predefined resource types.
+const (
+	RT_CURSOR       = 1
+	RT_BITMAP       = 2
+	RT_ICON         = 3
+	RT_MENU         = 4
+	RT_DIALOG       = 5
+	RT_STRING       = 6
+	RT_FONTDIR      = 7
+	RT_FONT         = 8
+	RT_ACCELERATOR  = 9
+	RT_RCDATA       = 10
+	RT_MESSAGETABLE = 11
+	RT_GROUP_CURSOR = 12
+	RT_GROUP_ICON   = 14
+	RT_VERSION      = 16
+	RT_DLGINCLUDE   = 17
+	RT_PLUGPLAY     = 19
+	RT_VXD          = 20
+	RT_ANICURSOR    = 21
+	RT_ANIICON      = 22
+	RT_HTML         = 23
+	RT_MANIFEST     = 24
+)
+
+// ResourceID identifies a resource type or name, either by an integer
+// ID or by a string.
+type ResourceID struct {
+	Name string // non-empty if the entry is named
+	ID   uint32
+}
+
+// IsName reports whether the resource is identified by a string.
+func (id ResourceID) IsName() bool {
+	return id.Name != ""
+}
+
+func (id ResourceID) String() string {
+	if id.IsName() {
+		return id.Name
+	}
+	return "#" + strconv.FormatUint(uint64(id.ID), 10)
+}
+
+// ResourceDirectory is the header of a resource directory table.
+type ResourceDirectory struct {
+	Characteristics      uint32
+	TimeDateStamp        uint32
+	MajorVersion         uint16
+	MinorVersion         uint16
+	NumberOfNamedEntries uint16
+	NumberOfIdEntries    uint16
+}
+
+// ResourceDataEntry describes the data of a leaf in the resource tree.
+type ResourceDataEntry struct {
+	OffsetToData uint32 // RVA of the resource data
+	Size         uint32
+	CodePage     uint32
+	Reserved     uint32
+}
+
+// Resource is a leaf of the resource tree, found by following the
+// type, name and language directories.
+type Resource struct {
+	Type     ResourceID
+	Name     ResourceID
+	Language uint16
+	RVA      uint32
+	Size     uint32
+	CodePage uint32
+
+	f *File
+}
+
+// Data reads and returns the contents of the resource r.
+func (r *Resource) Data() ([]byte, error) {
+	return r.f.readRVA(r.RVA, r.Size)
+}
+
+// Open returns a new ReadSeeker reading the resource r.
+func (r *Resource) Open() io.ReadSeeker {
+	return io.NewSectionReader(imageReader{r.f}, int64(r.RVA), int64(r.Size))
+}
+
+const (
+	resourceDirectorySize = 16
+	resourceEntrySize     = 8
+	resourceNameIsString  = 0x80000000
+	resourceDataIsDir     = 0x80000000
+	resourceMaxDepth      = 3 // type, name and language
+)
+
+// resourceWalker walks the resource tree held in data, which is the
+// contents of the resource data directory.
+type resourceWalker struct {
+	f         *File
+	data      []byte
+	visited   map[uint32]bool
+	resources []*Resource
+}
+
+// LookupResources walks the resource tree of the image and returns
+// every resource in it, in directory order. It returns nil and no
+// error if the image has no resources.
+func (f *File) LookupResources() ([]*Resource, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read resource directory: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	w := &resourceWalker{f: f, data: data, visited: make(map[uint32]bool)}
+	var path [resourceMaxDepth]ResourceID
+	if err := w.walk(0, 0, &path); err != nil {
+		return nil, err
+	}
+	return w.resources, nil
+}
+
+// LookupResourcesByType returns the resources of the given
+// predefined type, such as RT_VERSION.
+func (f *File) LookupResourcesByType(typ uint32) ([]*Resource, error) {
+	rs, err := f.LookupResources()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Resource
+	for _, r := range rs {
+		if !r.Type.IsName() && r.Type.ID == typ {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (w *resourceWalker) walk(off uint32, depth int, path *[resourceMaxDepth]ResourceID) error {
+	if w.visited[off] {
+		return fmt.Errorf("resource directory at offset %#x is referenced twice", off)
+	}
+	w.visited[off] = true
+	if uint64(off)+resourceDirectorySize > uint64(len(w.data)) {
+		return fmt.Errorf("resource directory at offset %#x out of range", off)
+	}
+	d := w.data[off:]
+	var rd ResourceDirectory
+	rd.Characteristics = binary.LittleEndian.Uint32(d[0:4])
+	rd.TimeDateStamp = binary.LittleEndian.Uint32(d[4:8])
+	rd.MajorVersion = binary.LittleEndian.Uint16(d[8:10])
+	rd.MinorVersion = binary.LittleEndian.Uint16(d[10:12])
+	rd.NumberOfNamedEntries = binary.LittleEndian.Uint16(d[12:14])
+	rd.NumberOfIdEntries = binary.LittleEndian.Uint16(d[14:16])
+	n := int(rd.NumberOfNamedEntries) + int(rd.NumberOfIdEntries)
+	d = d[resourceDirectorySize:]
+	if n*resourceEntrySize > len(d) {
+		return fmt.Errorf("resource directory at offset %#x has too many entries", off)
+	}
+	for i := 0; i < n; i++ {
+		e := d[i*resourceEntrySize:]
+		name := binary.LittleEndian.Uint32(e[0:4])
+		target := binary.LittleEndian.Uint32(e[4:8])
+		var id ResourceID
+		if name&resourceNameIsString != 0 {
+			s, err := w.name(name &^ resourceNameIsString)
+			if err != nil {
+				return err
+			}
+			id.Name = s
+		} else {
+			id.ID = name
+		}
+		if depth < resourceMaxDepth {
+			path[depth] = id
+		}
+		if target&resourceDataIsDir != 0 {
+			if depth+1 >= resourceMaxDepth {
+				return fmt.Errorf("resource directory nested too deep")
+			}
+			if err := w.walk(target&^resourceDataIsDir, depth+1, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.leaf(target, depth, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// name reads a length-prefixed UTF-16 resource name.
+func (w *resourceWalker) name(off uint32) (string, error) {
+	if uint64(off)+2 > uint64(len(w.data)) {
+		return "", fmt.Errorf("resource name at offset %#x out of range", off)
+	}
+	l := uint64(binary.LittleEndian.Uint16(w.data[off:]))
+	if uint64(off)+2+l*2 > uint64(len(w.data)) {
+		return "", fmt.Errorf("resource name at offset %#x out of range", off)
+	}
+	u := make([]uint16, l)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(w.data[uint64(off)+2+uint64(i)*2:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+func (w *resourceWalker) leaf(off uint32, depth int, path *[resourceMaxDepth]ResourceID) error {
+	if uint64(off)+16 > uint64(len(w.data)) {
+		return fmt.Errorf("resource data entry at offset %#x out of range", off)
+	}
+	var de ResourceDataEntry
+	de.OffsetToData = binary.LittleEndian.Uint32(w.data[off:])
+	de.Size = binary.LittleEndian.Uint32(w.data[off+4:])
+	de.CodePage = binary.LittleEndian.Uint32(w.data[off+8:])
+	de.Reserved = binary.LittleEndian.Uint32(w.data[off+12:])
+	r := &Resource{
+		Type:     path[0],
+		RVA:      de.OffsetToData,
+		Size:     de.Size,
+		CodePage: de.CodePage,
+		f:        w.f,
+	}
+	if depth >= 1 {
+		r.Name = path[1]
+	}
+	if depth >= 2 {
+		r.Language = uint16(path[2].ID)
+	}
+	w.resources = append(w.resources, r)
+	return nil
+}
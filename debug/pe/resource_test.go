@@ -0,0 +1,183 @@
+package pe
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// buildResourceSection returns a .rsrc section at va holding a tree of
+// two types: RT_VERSION #1 (language 0x409) and a named "MYDATA" type
+// with a named "BLOB" entry in two languages.
+func buildResourceSection(va uint32) []byte {
+	var b le
+	dir := func(named, ids uint16) {
+		b.u32(0)
+		b.u32(0)
+		b.u16(0)
+		b.u16(0)
+		b.u16(named)
+		b.u16(ids)
+	}
+	entry := func(name, target uint32) {
+		b.u32(name)
+		b.u32(target)
+	}
+	// Layout: root at 0x00, type dirs at 0x20/0x38, name dirs at 0x50/0x68,
+	// data entries at 0x90.., names at 0xc0.., data at 0x100...
+	dir(1, 1) // root
+	entry(0x80000000|0xc0, 0x80000000|0x38)
+	entry(RT_VERSION, 0x80000000|0x20)
+	b.pad(0x20)
+	dir(0, 1) // RT_VERSION names
+	entry(1, 0x80000000|0x50)
+	b.pad(0x38)
+	dir(1, 0) // MYDATA names
+	entry(0x80000000|0xd0, 0x80000000|0x68)
+	b.pad(0x50)
+	dir(0, 1) // RT_VERSION #1 languages
+	entry(0x409, 0x90)
+	b.pad(0x68)
+	dir(0, 2) // BLOB languages
+	entry(0x409, 0xa0)
+	entry(0x407, 0xb0)
+	b.pad(0x90)
+	for i, s := range []uint32{4, 5, 6} {
+		b.u32(va + 0x100 + uint32(i)*0x10)
+		b.u32(s)
+		b.u32(1252)
+		b.u32(0)
+	}
+	b.pad(0xc0)
+	b.u16(6)
+	b.utf16("MYDATA")
+	b.pad(0xd0)
+	b.u16(4)
+	b.utf16("BLOB")
+	b.pad(0x100)
+	b.WriteString("vers")
+	b.pad(0x110)
+	b.WriteString("hello")
+	b.pad(0x120)
+	b.WriteString("hallo!")
+	return b.Bytes()
+}
+
+// singleResourceImage returns an image whose resource tree holds one
+// resource of type typ, name #1 and language 0x409 with the given data.
+func singleResourceImage(typ uint32, data []byte) *testImage {
+	const va = 0x3000
+	var b le
+	dir := func() {
+		b.u32(0)
+		b.u32(0)
+		b.u32(0)
+		b.u16(0)
+		b.u16(1)
+	}
+	dir()
+	b.u32(typ)
+	b.u32(0x80000000 | 0x18)
+	dir()
+	b.u32(1)
+	b.u32(0x80000000 | 0x30)
+	dir()
+	b.u32(0x409)
+	b.u32(0x48)
+	b.u32(va + 0x60)
+	b.u32(uint32(len(data)))
+	b.u32(0)
+	b.u32(0)
+	b.pad(0x60)
+	b.Write(data)
+	return &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_RESOURCE: {VirtualAddress: va, Size: uint32(b.Len())},
+		},
+		sections: []testSection{{name: ".rsrc", va: va, data: b.Bytes()}},
+	}
+}
+
+func TestLookupResources(t *testing.T) {
+	const va = 0x2000
+	rsrc := buildResourceSection(va)
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_RESOURCE: {VirtualAddress: va, Size: uint32(len(rsrc))},
+		},
+		sections: []testSection{{name: ".rsrc", va: va, data: rsrc}},
+	}
+	f := ti.open(t)
+	rs, err := f.LookupResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ, name string
+		lang      uint16
+		data      string
+	}{
+		{"MYDATA", "BLOB", 0x409, "hello"},
+		{"MYDATA", "BLOB", 0x407, "hallo!"},
+		{"#16", "#1", 0x409, "vers"},
+	}
+	if len(rs) != len(want) {
+		t.Fatalf("got %d resources, want %d", len(rs), len(want))
+	}
+	for i, w := range want {
+		r := rs[i]
+		if r.Type.String() != w.typ || r.Name.String() != w.name || r.Language != w.lang {
+			t.Errorf("resource %d: got %v/%v/%#x, want %s/%s/%#x", i, r.Type, r.Name, r.Language, w.typ, w.name, w.lang)
+		}
+		if r.CodePage != 1252 {
+			t.Errorf("resource %d: got code page %d, want 1252", i, r.CodePage)
+		}
+		data, err := r.Data()
+		if err != nil {
+			t.Errorf("resource %d: %v", i, err)
+		} else if string(data) != w.data {
+			t.Errorf("resource %d: got data %q, want %q", i, data, w.data)
+		}
+		data, err = io.ReadAll(r.Open())
+		if err != nil || !bytes.Equal(data, []byte(w.data)) {
+			t.Errorf("resource %d: Open read %q, %v; want %q", i, data, err, w.data)
+		}
+	}
+
+	vs, err := f.LookupResourcesByType(RT_VERSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Name.ID != 1 {
+		t.Errorf("LookupResourcesByType(RT_VERSION) = %v, want one resource #1", vs)
+	}
+}
+
+func TestLookupResourcesLoop(t *testing.T) {
+	const va = 0x2000
+	var b le
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.u16(0)
+	b.u16(1)
+	b.u32(RT_RCDATA)
+	b.u32(0x80000000) // points back at the root
+	ti := &testImage{
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_RESOURCE: {VirtualAddress: va, Size: uint32(b.Len())},
+		},
+		sections: []testSection{{name: ".rsrc", va: va, data: b.Bytes()}},
+	}
+	if _, err := ti.open(t).LookupResources(); err == nil {
+		t.Error("LookupResources of a looping tree succeeded")
+	}
+}
+
+func TestLookupResourcesNone(t *testing.T) {
+	ti := &testImage{sections: []testSection{{name: ".data", va: 0x1000, data: []byte{1}}}}
+	rs, err := ti.open(t).LookupResources()
+	if rs != nil || err != nil {
+		t.Errorf("LookupResources = %v, %v; want nil, nil", rs, err)
+	}
+}
@@ -0,0 +1,130 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/fcharlie/buna/debug/saferio"
+)
+
+// The markers of the Rich header. "DanS" is stored XOR-encrypted with
+// the key, "Rich" in the clear.
+const (
+	richSignature = 0x68636952 // "Rich"
+	dansSignature = 0x536e6144 // "DanS"
+)
+
+// RichEntry is a @comp.id record of the Rich header: a tool that
+// contributed objects to the image and how many of them.
+type RichEntry struct {
+	ProductID uint16
+	Build     uint16
+	Count     uint32
+}
+
+// CompID returns the packed @comp.id value of e.
+func (e RichEntry) CompID() uint32 {
+	return uint32(e.ProductID)<<16 | uint32(e.Build)
+}
+
+func (e RichEntry) String() string {
+	return fmt.Sprintf("%d.%d x%d", e.ProductID, e.Build, e.Count)
+}
+
+// RichHeader is the decoded Rich header the Microsoft linker writes
+// between the DOS stub and the PE signature.
+type RichHeader struct {
+	Offset   uint32 // file offset of the DanS marker
+	Key      uint32 // XOR key, which is the checksum the linker computed
+	Entries  []RichEntry
+	checksum uint32
+}
+
+// Checksum returns the checksum computed over the DOS header, the DOS
+// stub and the entries.
+func (r *RichHeader) Checksum() uint32 {
+	return r.checksum
+}
+
+// Valid reports whether the computed checksum matches the key, that
+// is, whether neither the DOS stub nor the entries were modified after
+// linking.
+func (r *RichHeader) Valid() bool {
+	return r.checksum == r.Key
+}
+
+// LookupRichHeader decodes the Rich header of the image. It returns nil
+// and no error if the image has none.
+func (f *File) LookupRichHeader() (*RichHeader, error) {
+	if f.originalReader == nil {
+		return nil, nil
+	}
+	var dosheader [0x40]byte
+	if _, err := f.originalReader.ReadAt(dosheader[:], 0); err != nil {
+		return nil, fmt.Errorf("fail to read DOS header: %v", err)
+	}
+	if dosheader[0] != 'M' || dosheader[1] != 'Z' {
+		// COFF object files have no DOS header.
+		return nil, nil
+	}
+	peOffset := binary.LittleEndian.Uint32(dosheader[0x3c:])
+	if peOffset <= 0x40 || peOffset > 0x10000 {
+		return nil, nil
+	}
+	dos, err := saferio.ReadDataAt(f.originalReader, uint64(peOffset), 0)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read DOS stub: %v", err)
+	}
+	// The header is dword aligned and ends with "Rich" and the key.
+	rich := -1
+	for i := (len(dos) - 8) &^ 3; i >= 0x40; i -= 4 {
+		if binary.LittleEndian.Uint32(dos[i:]) == richSignature {
+			rich = i
+			break
+		}
+	}
+	if rich < 0 {
+		return nil, nil
+	}
+	key := binary.LittleEndian.Uint32(dos[rich+4:])
+	dans := -1
+	for i := rich - 4; i >= 0x40; i -= 4 {
+		if binary.LittleEndian.Uint32(dos[i:])^key == dansSignature {
+			dans = i
+			break
+		}
+	}
+	if dans < 0 {
+		return nil, fmt.Errorf("Rich header at %#x has no DanS marker", rich)
+	}
+	// DanS is followed by three zero dwords of padding.
+	start := dans + 16
+	if start > rich || (rich-start)%8 != 0 {
+		return nil, fmt.Errorf("invalid Rich header size %d", rich-dans)
+	}
+	r := &RichHeader{Offset: uint32(dans), Key: key}
+	for i := start; i < rich; i += 8 {
+		compID := binary.LittleEndian.Uint32(dos[i:]) ^ key
+		r.Entries = append(r.Entries, RichEntry{
+			ProductID: uint16(compID >> 16),
+			Build:     uint16(compID),
+			Count:     binary.LittleEndian.Uint32(dos[i+4:]) ^ key,
+		})
+	}
+
+	// The checksum covers the bytes before DanS, except e_lfanew, each
+	// rotated by its offset, and the entries rotated by their counts.
+	sum := uint32(dans)
+	for i := 0; i < dans; i++ {
+		if i >= 0x3c && i < 0x40 {
+			continue
+		}
+		sum += bits.RotateLeft32(uint32(dos[i]), i)
+	}
+	for _, e := range r.Entries {
+		sum += bits.RotateLeft32(e.CompID(), int(e.Count&31))
+	}
+	r.checksum = sum
+	return r, nil
+}
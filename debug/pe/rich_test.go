@@ -0,0 +1,99 @@
+package pe
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// richStub returns a DOS stub followed by a Rich header holding
+// entries, encrypted with the checksum of an image whose DOS header is
+// built by testImage.
+func richStub(entries []RichEntry) []byte {
+	var b le
+	b.Write([]byte("\x0e\x1f\xba\x0e\x00\xb4\x09\xcd\x21\xb8\x01\x4c\xcd\x21This program cannot be run in DOS mode.\r\r\n$\x00\x00\x00\x00\x00\x00\x00"))
+	dans := 0x40 + b.Len()
+	peOffset := dans + 16 + 8*len(entries) + 8
+	peOffset = (peOffset + 7) &^ 7
+
+	dos := make([]byte, dans)
+	copy(dos, "MZ")
+	copy(dos[0x40:], b.Bytes())
+	key := uint32(dans)
+	for i := 0; i < dans; i++ {
+		if i < 0x3c || i >= 0x40 {
+			key += bits.RotateLeft32(uint32(dos[i]), i)
+		}
+	}
+	for _, e := range entries {
+		key += bits.RotateLeft32(e.CompID(), int(e.Count&31))
+	}
+
+	b.u32(dansSignature ^ key)
+	b.u32(key)
+	b.u32(key)
+	b.u32(key)
+	for _, e := range entries {
+		b.u32(e.CompID() ^ key)
+		b.u32(e.Count ^ key)
+	}
+	b.u32(richSignature)
+	b.u32(key)
+	b.pad(peOffset - 0x40)
+	return b.Bytes()
+}
+
+func TestLookupRichHeader(t *testing.T) {
+	entries := []RichEntry{
+		{ProductID: 0x0104, Build: 30795, Count: 18}, // Utc1900_CPP
+		{ProductID: 0x0103, Build: 30795, Count: 3},  // Utc1900_C
+		{ProductID: 0x0101, Build: 0, Count: 140},    // Import
+		{ProductID: 0x0102, Build: 30795, Count: 1},  // Linker1400
+	}
+	ti := &testImage{dosStub: richStub(entries)}
+	r, err := ti.open(t).LookupRichHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil {
+		t.Fatal("no Rich header")
+	}
+	if r.Offset != 0x80 {
+		t.Errorf("Offset = %#x, want 0x80", r.Offset)
+	}
+	if len(r.Entries) != len(entries) {
+		t.Fatalf("Entries = %v, want %v", r.Entries, entries)
+	}
+	for i := range entries {
+		if r.Entries[i] != entries[i] {
+			t.Errorf("Entries[%d] = %v, want %v", i, r.Entries[i], entries[i])
+		}
+	}
+	if !r.Valid() {
+		t.Errorf("checksum %#x does not match key %#x", r.Checksum(), r.Key)
+	}
+
+	// Patching the DOS stub invalidates the checksum.
+	ti.dosStub[0x10] = 'X'
+	if r, err = ti.open(t).LookupRichHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Valid() {
+		t.Error("Valid after modifying the DOS stub")
+	}
+}
+
+func TestLookupRichHeaderAbsent(t *testing.T) {
+	ti := &testImage{}
+	r, err := ti.open(t).LookupRichHeader()
+	if r != nil || err != nil {
+		t.Errorf("LookupRichHeader = %v, %v, want nil, nil", r, err)
+	}
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if r, err := f.LookupRichHeader(); r != nil || err != nil {
+		t.Errorf("LookupRichHeader of GNU image = %v, %v, want nil, nil", r, err)
+	}
+}
@@ -0,0 +1,113 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// TLSCallback is an entry of the TLS callback array. The loader calls
+// the callbacks before the entry point of the image.
+type TLSCallback struct {
+	VA      uint64
+	RVA     uint32
+	Section *Section // section holding the callback, nil if none does
+}
+
+// TLSDirectory is the thread local storage directory of an image
+// (IMAGE_TLS_DIRECTORY32 or IMAGE_TLS_DIRECTORY64). Addresses are VAs.
+type TLSDirectory struct {
+	StartAddressOfRawData uint64
+	EndAddressOfRawData   uint64
+	AddressOfIndex        uint64
+	AddressOfCallBacks    uint64
+	SizeOfZeroFill        uint32
+	Characteristics       uint32
+
+	Callbacks []TLSCallback
+}
+
+// Alignment returns the alignment of the TLS template encoded in the
+// IMAGE_SCN_ALIGN bits of Characteristics, or 0 if it is not given.
+func (d *TLSDirectory) Alignment() uint32 {
+	n := d.Characteristics >> 20 & 0xf
+	if n == 0 || n > 14 {
+		return 0
+	}
+	return 1 << (n - 1)
+}
+
+// maxTLSCallbacks bounds the callback array of malformed images.
+const maxTLSCallbacks = 1 << 16
+
+// LookupTLSDirectory decodes the TLS directory of the image and its
+// null-terminated callback array. It returns nil and no error if the
+// image has no TLS directory.
+func (f *File) LookupTLSDirectory() (*TLSDirectory, error) {
+	data, _, err := f.readDirectory(IMAGE_DIRECTORY_ENTRY_TLS)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read TLS directory: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	pe64 := f.is64()
+	d := &TLSDirectory{}
+	if pe64 {
+		if len(data) < 40 {
+			return nil, fmt.Errorf("TLS directory %d buffer size too small", len(data))
+		}
+		d.StartAddressOfRawData = binary.LittleEndian.Uint64(data[0:8])
+		d.EndAddressOfRawData = binary.LittleEndian.Uint64(data[8:16])
+		d.AddressOfIndex = binary.LittleEndian.Uint64(data[16:24])
+		d.AddressOfCallBacks = binary.LittleEndian.Uint64(data[24:32])
+		d.SizeOfZeroFill = binary.LittleEndian.Uint32(data[32:36])
+		d.Characteristics = binary.LittleEndian.Uint32(data[36:40])
+	} else {
+		if len(data) < 24 {
+			return nil, fmt.Errorf("TLS directory %d buffer size too small", len(data))
+		}
+		d.StartAddressOfRawData = uint64(binary.LittleEndian.Uint32(data[0:4]))
+		d.EndAddressOfRawData = uint64(binary.LittleEndian.Uint32(data[4:8]))
+		d.AddressOfIndex = uint64(binary.LittleEndian.Uint32(data[8:12]))
+		d.AddressOfCallBacks = uint64(binary.LittleEndian.Uint32(data[12:16]))
+		d.SizeOfZeroFill = binary.LittleEndian.Uint32(data[16:20])
+		d.Characteristics = binary.LittleEndian.Uint32(data[20:24])
+	}
+	if d.AddressOfCallBacks == 0 {
+		return d, nil
+	}
+	rva, ok := f.vaToRVA(d.AddressOfCallBacks)
+	if !ok {
+		return nil, fmt.Errorf("TLS callback array address %#x outside of image", d.AddressOfCallBacks)
+	}
+	ptrSize := uint32(4)
+	if pe64 {
+		ptrSize = 8
+	}
+	for i := 0; ; i++ {
+		if i == maxTLSCallbacks {
+			return nil, fmt.Errorf("TLS callback array at %#x is not terminated", d.AddressOfCallBacks)
+		}
+		b, err := f.readRVA(rva, ptrSize)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read TLS callback array: %v", err)
+		}
+		var va uint64
+		if pe64 {
+			va = binary.LittleEndian.Uint64(b)
+		} else {
+			va = uint64(binary.LittleEndian.Uint32(b))
+		}
+		if va == 0 {
+			break
+		}
+		cb := TLSCallback{VA: va}
+		if r, ok := f.vaToRVA(va); ok {
+			cb.RVA = r
+			cb.Section = f.sectionForRVA(r)
+		}
+		d.Callbacks = append(d.Callbacks, cb)
+		rva += ptrSize
+	}
+	return d, nil
+}
@@ -0,0 +1,88 @@
+package pe
+
+import "testing"
+
+func buildTLSImage(pe32 bool, base uint64) *testImage {
+	var b le
+	ptr := func(v uint64) {
+		if pe32 {
+			b.u32(uint32(v))
+		} else {
+			b.u64(v)
+		}
+	}
+	ptr(base + 0x2100) // raw data start
+	ptr(base + 0x2108) // raw data end
+	ptr(base + 0x2110) // index
+	ptr(base + 0x2040) // callbacks
+	b.u32(0x20)
+	b.u32(0x00300000) // IMAGE_SCN_ALIGN_4BYTES
+	b.pad(0x40)
+	ptr(base + 0x1010)
+	ptr(base + 0x1020)
+	ptr(0x1234) // outside of the image
+	ptr(0)
+	dirSize := uint32(40)
+	if pe32 {
+		dirSize = 24
+	}
+	return &testImage{
+		pe32:      pe32,
+		imageBase: base,
+		dirs: map[int]DataDirectory{
+			IMAGE_DIRECTORY_ENTRY_TLS: {VirtualAddress: 0x2000, Size: dirSize},
+		},
+		sections: []testSection{
+			{name: ".text", va: 0x1000, data: make([]byte, 0x100), chars: IMAGE_SCN_CNT_CODE | IMAGE_SCN_MEM_EXECUTE | IMAGE_SCN_MEM_READ},
+			{name: ".rdata", va: 0x2000, data: b.Bytes()},
+		},
+	}
+}
+
+func TestLookupTLSDirectory(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		pe32 bool
+		base uint64
+	}{
+		{"PE32", true, 0x400000},
+		{"PE32+", false, 0x140000000},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := buildTLSImage(tt.pe32, tt.base).open(t).LookupTLSDirectory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d == nil {
+				t.Fatal("no TLS directory")
+			}
+			if d.StartAddressOfRawData != tt.base+0x2100 || d.EndAddressOfRawData != tt.base+0x2108 ||
+				d.AddressOfIndex != tt.base+0x2110 || d.SizeOfZeroFill != 0x20 {
+				t.Errorf("TLS directory = %+v", d)
+			}
+			if d.Alignment() != 4 {
+				t.Errorf("Alignment = %d, want 4", d.Alignment())
+			}
+			if len(d.Callbacks) != 3 {
+				t.Fatalf("got %d callbacks, want 3", len(d.Callbacks))
+			}
+			for i, rva := range []uint32{0x1010, 0x1020} {
+				cb := d.Callbacks[i]
+				if cb.VA != tt.base+uint64(rva) || cb.RVA != rva || cb.Section == nil || cb.Section.Name != ".text" {
+					t.Errorf("callback %d = %+v", i, cb)
+				}
+			}
+			if cb := d.Callbacks[2]; cb.VA != 0x1234 || cb.Section != nil {
+				t.Errorf("callback 2 = %+v", cb)
+			}
+		})
+	}
+}
+
+func TestLookupTLSDirectoryNone(t *testing.T) {
+	ti := &testImage{sections: []testSection{{name: ".data", va: 0x1000, data: []byte{1}}}}
+	d, err := ti.open(t).LookupTLSDirectory()
+	if d != nil || err != nil {
+		t.Errorf("LookupTLSDirectory = %v, %v; want nil, nil", d, err)
+	}
+}
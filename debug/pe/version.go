@@ -0,0 +1,357 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// VS_FIXEDFILEINFO signature and flags.
+const (
+	VS_FFI_SIGNATURE = 0xFEEF04BD
+
+	VS_FF_DEBUG        = 0x00000001
+	VS_FF_PRERELEASE   = 0x00000002
+	VS_FF_PATCHED      = 0x00000004
+	VS_FF_PRIVATEBUILD = 0x00000008
+	VS_FF_INFOINFERRED = 0x00000010
+	VS_FF_SPECIALBUILD = 0x00000020
+)
+
+// VS_FIXEDFILEINFO operating systems.
+const (
+	VOS_UNKNOWN       = 0x00000000
+	VOS_DOS           = 0x00010000
+	VOS_OS216         = 0x00020000
+	VOS_OS232         = 0x00030000
+	VOS_NT            = 0x00040000
+	VOS__WINDOWS16    = 0x00000001
+	VOS__PM16         = 0x00000002
+	VOS__PM32         = 0x00000003
+	VOS__WINDOWS32    = 0x00000004
+	VOS_DOS_WINDOWS16 = 0x00010001
+	VOS_DOS_WINDOWS32 = 0x00010004
+	VOS_NT_WINDOWS32  = 0x00040004
+)
+
+// VS_FIXEDFILEINFO file types.
+const (
+	VFT_UNKNOWN    = 0x00000000
+	VFT_APP        = 0x00000001
+	VFT_DLL        = 0x00000002
+	VFT_DRV        = 0x00000003
+	VFT_FONT       = 0x00000004
+	VFT_VXD        = 0x00000005
+	VFT_STATIC_LIB = 0x00000007
+)
+
+// FixedFileInfo is the language independent part of a version
+// resource (VS_FIXEDFILEINFO).
+type FixedFileInfo struct {
+	Signature        uint32
+	StrucVersion     uint32
+	FileVersionMS    uint32
+	FileVersionLS    uint32
+	ProductVersionMS uint32
+	ProductVersionLS uint32
+	FileFlagsMask    uint32
+	FileFlags        uint32
+	FileOS           uint32
+	FileType         uint32
+	FileSubtype      uint32
+	FileDateMS       uint32
+	FileDateLS       uint32
+}
+
+// Version is a four part version number as stored in FixedFileInfo.
+type Version struct {
+	Major, Minor, Build, Revision uint16
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Build, v.Revision)
+}
+
+func makeVersion(ms, ls uint32) Version {
+	return Version{uint16(ms >> 16), uint16(ms), uint16(ls >> 16), uint16(ls)}
+}
+
+// FileVersion returns the binary version of the file.
+func (fi *FixedFileInfo) FileVersion() Version {
+	return makeVersion(fi.FileVersionMS, fi.FileVersionLS)
+}
+
+// ProductVersion returns the binary version of the product the file
+// is distributed with.
+func (fi *FixedFileInfo) ProductVersion() Version {
+	return makeVersion(fi.ProductVersionMS, fi.ProductVersionLS)
+}
+
+// Flags returns the FileFlags which are valid according to FileFlagsMask.
+func (fi *FixedFileInfo) Flags() uint32 {
+	return fi.FileFlags & fi.FileFlagsMask
+}
+
+// VersionStringTable is a StringFileInfo table of version strings in
+// one language and code page.
+type VersionStringTable struct {
+	Language uint16
+	CodePage uint16
+	Strings  map[string]string
+}
+
+// VersionTranslation is a language and code page pair listed in the
+// VarFileInfo Translation value.
+type VersionTranslation struct {
+	Language uint16
+	CodePage uint16
+}
+
+// VersionInfo is a decoded version resource (VS_VERSIONINFO).
+type VersionInfo struct {
+	Fixed        *FixedFileInfo // nil if the resource has no fixed part
+	StringTables []VersionStringTable
+	Translations []VersionTranslation
+}
+
+// Well known keys of the version string tables.
+const (
+	VersionComments         = "Comments"
+	VersionCompanyName      = "CompanyName"
+	VersionFileDescription  = "FileDescription"
+	VersionFileVersion      = "FileVersion"
+	VersionInternalName     = "InternalName"
+	VersionLegalCopyright   = "LegalCopyright"
+	VersionLegalTrademarks  = "LegalTrademarks"
+	VersionOriginalFilename = "OriginalFilename"
+	VersionPrivateBuild     = "PrivateBuild"
+	VersionProductName      = "ProductName"
+	VersionProductVersion   = "ProductVersion"
+	VersionSpecialBuild     = "SpecialBuild"
+)
+
+// String returns the value of key. String tables are searched in the
+// order given by Translations first, then in the order they appear.
+// It returns "" if no table has the key.
+func (vi *VersionInfo) String(key string) string {
+	for _, t := range vi.Translations {
+		for i := range vi.StringTables {
+			st := &vi.StringTables[i]
+			if st.Language != t.Language || st.CodePage != t.CodePage {
+				continue
+			}
+			if v, ok := st.Strings[key]; ok {
+				return v
+			}
+		}
+	}
+	for _, st := range vi.StringTables {
+		if v, ok := st.Strings[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// LookupVersionInfo decodes the first RT_VERSION resource of the image.
+// It returns nil and no error if the image has no version resource.
+func (f *File) LookupVersionInfo() (*VersionInfo, error) {
+	rs, err := f.LookupResourcesByType(RT_VERSION)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, nil
+	}
+	data, err := rs[0].Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read version resource: %v", err)
+	}
+	return ParseVersionInfo(data)
+}
+
+// versionBlock is one node of a version resource. Every node starts
+// with its length, value length, type and key; the value and the
+// children follow, each aligned to 32 bits.
+type versionBlock struct {
+	key      string
+	text     bool
+	value    []byte
+	children []byte
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// readVersionBlock reads the block at the start of b, which must be
+// 32-bit aligned, and returns it along with the bytes following it.
+func readVersionBlock(b []byte) (versionBlock, []byte, error) {
+	var blk versionBlock
+	if len(b) < 6 {
+		return blk, nil, errors.New("version block truncated")
+	}
+	length := int(binary.LittleEndian.Uint16(b[0:2]))
+	valueLength := int(binary.LittleEndian.Uint16(b[2:4]))
+	blk.text = binary.LittleEndian.Uint16(b[4:6]) == 1
+	if length < 6 || length > len(b) {
+		return blk, nil, fmt.Errorf("invalid version block length %d", length)
+	}
+	d := b[:length]
+	off := 6
+	var key []uint16
+	for {
+		if off+2 > len(d) {
+			return blk, nil, errors.New("version block key not terminated")
+		}
+		c := binary.LittleEndian.Uint16(d[off:])
+		off += 2
+		if c == 0 {
+			break
+		}
+		key = append(key, c)
+	}
+	blk.key = string(utf16.Decode(key))
+	off = align4(off)
+	if blk.text {
+		// Text values are measured in WORDs.
+		valueLength *= 2
+	}
+	if off > len(d) {
+		off = len(d)
+	}
+	end := off + valueLength
+	if end > len(d) {
+		end = len(d)
+	}
+	blk.value = d[off:end]
+	if off = align4(end); off > len(d) {
+		off = len(d)
+	}
+	blk.children = d[off:]
+	if n := align4(length); n <= len(b) {
+		return blk, b[n:], nil
+	}
+	return blk, nil, nil
+}
+
+// readVersionBlocks reads the sequence of blocks in b.
+func readVersionBlocks(b []byte) ([]versionBlock, error) {
+	var blks []versionBlock
+	for len(b) >= 6 {
+		if binary.LittleEndian.Uint16(b) == 0 {
+			// Some linkers pad the end of a table with zeros.
+			break
+		}
+		blk, rest, err := readVersionBlock(b)
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, blk)
+		b = rest
+	}
+	return blks, nil
+}
+
+// versionString decodes a NUL terminated UTF-16 value.
+func versionString(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// ParseVersionInfo decodes the contents of an RT_VERSION resource.
+func ParseVersionInfo(data []byte) (*VersionInfo, error) {
+	root, _, err := readVersionBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read version resource: %v", err)
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return nil, fmt.Errorf("unexpected version resource key %q", root.key)
+	}
+	vi := &VersionInfo{}
+	if len(root.value) >= binary.Size(FixedFileInfo{}) {
+		fi := &FixedFileInfo{}
+		if err := binary.Read(bytes.NewReader(root.value), binary.LittleEndian, fi); err != nil {
+			return nil, fmt.Errorf("fail to read fixed file info: %v", err)
+		}
+		if fi.Signature != VS_FFI_SIGNATURE {
+			return nil, fmt.Errorf("invalid fixed file info signature %#x", fi.Signature)
+		}
+		vi.Fixed = fi
+	}
+	children, err := readVersionBlocks(root.children)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read version resource: %v", err)
+	}
+	for _, c := range children {
+		switch c.key {
+		case "StringFileInfo":
+			if err := vi.readStringFileInfo(c.children); err != nil {
+				return nil, err
+			}
+		case "VarFileInfo":
+			if err := vi.readVarFileInfo(c.children); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vi, nil
+}
+
+func (vi *VersionInfo) readStringFileInfo(b []byte) error {
+	tables, err := readVersionBlocks(b)
+	if err != nil {
+		return fmt.Errorf("fail to read StringFileInfo: %v", err)
+	}
+	for _, t := range tables {
+		// The key is the language and code page as 8 hex digits.
+		var st VersionStringTable
+		if len(t.key) == 8 {
+			if lang, err := strconv.ParseUint(t.key[:4], 16, 16); err == nil {
+				st.Language = uint16(lang)
+			}
+			if cp, err := strconv.ParseUint(t.key[4:], 16, 16); err == nil {
+				st.CodePage = uint16(cp)
+			}
+		}
+		strs, err := readVersionBlocks(t.children)
+		if err != nil {
+			return fmt.Errorf("fail to read string table %q: %v", t.key, err)
+		}
+		st.Strings = make(map[string]string, len(strs))
+		for _, s := range strs {
+			st.Strings[s.key] = versionString(s.value)
+		}
+		vi.StringTables = append(vi.StringTables, st)
+	}
+	return nil
+}
+
+func (vi *VersionInfo) readVarFileInfo(b []byte) error {
+	vars, err := readVersionBlocks(b)
+	if err != nil {
+		return fmt.Errorf("fail to read VarFileInfo: %v", err)
+	}
+	for _, v := range vars {
+		if v.key != "Translation" {
+			continue
+		}
+		for i := 0; i+4 <= len(v.value); i += 4 {
+			vi.Translations = append(vi.Translations, VersionTranslation{
+				Language: binary.LittleEndian.Uint16(v.value[i:]),
+				CodePage: binary.LittleEndian.Uint16(v.value[i+2:]),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package pe
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// versionNode encodes a version resource block. Children are padded
+// to 32-bit boundaries relative to the start of the block.
+func versionNode(key string, text bool, value []byte, children ...[]byte) []byte {
+	var b le
+	b.u16(0) // length, patched below
+	valueLength := len(value)
+	if text {
+		valueLength /= 2
+	}
+	b.u16(uint16(valueLength))
+	if text {
+		b.u16(1)
+	} else {
+		b.u16(0)
+	}
+	b.utf16(key)
+	b.u16(0)
+	b.pad(align4(b.Len()))
+	b.Write(value)
+	for _, c := range children {
+		b.pad(align4(b.Len()))
+		b.Write(c)
+	}
+	out := b.Bytes()
+	binary.LittleEndian.PutUint16(out, uint16(len(out)))
+	return out
+}
+
+func versionText(s string) []byte {
+	var b le
+	b.utf16(s)
+	b.u16(0)
+	return b.Bytes()
+}
+
+func buildVersionInfo() []byte {
+	var fixed le
+	binary.Write(&fixed, binary.LittleEndian, FixedFileInfo{
+		Signature:        VS_FFI_SIGNATURE,
+		StrucVersion:     0x10000,
+		FileVersionMS:    1<<16 | 2,
+		FileVersionLS:    3<<16 | 4,
+		ProductVersionMS: 5 << 16,
+		FileFlagsMask:    0x3f,
+		FileFlags:        VS_FF_DEBUG | 0x100,
+		FileOS:           VOS_NT_WINDOWS32,
+		FileType:         VFT_DLL,
+	})
+	str := func(k, v string) []byte { return versionNode(k, true, versionText(v)) }
+	var trans le
+	trans.u16(0x407)
+	trans.u16(1200)
+	trans.u16(0x409)
+	trans.u16(1200)
+	return versionNode("VS_VERSION_INFO", false, fixed.Bytes(),
+		versionNode("StringFileInfo", true, nil,
+			versionNode("040904b0", true, nil,
+				str(VersionCompanyName, "Example Corp"),
+				str(VersionProductName, "Widget"),
+				str(VersionFileVersion, "1.2.3.4"),
+			),
+			versionNode("040704b0", true, nil,
+				str(VersionProductName, "Dings"),
+			),
+		),
+		versionNode("VarFileInfo", true, nil,
+			versionNode("Translation", false, trans.Bytes()),
+		),
+	)
+}
+
+func TestParseVersionInfo(t *testing.T) {
+	vi, err := ParseVersionInfo(buildVersionInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vi.Fixed == nil {
+		t.Fatal("missing fixed file info")
+	}
+	if got := vi.Fixed.FileVersion().String(); got != "1.2.3.4" {
+		t.Errorf("FileVersion = %s, want 1.2.3.4", got)
+	}
+	if got := vi.Fixed.ProductVersion().String(); got != "5.0.0.0" {
+		t.Errorf("ProductVersion = %s, want 5.0.0.0", got)
+	}
+	if got := vi.Fixed.Flags(); got != VS_FF_DEBUG {
+		t.Errorf("Flags = %#x, want %#x", got, VS_FF_DEBUG)
+	}
+	if vi.Fixed.FileOS != VOS_NT_WINDOWS32 || vi.Fixed.FileType != VFT_DLL {
+		t.Errorf("FileOS, FileType = %#x, %#x", vi.Fixed.FileOS, vi.Fixed.FileType)
+	}
+	if len(vi.StringTables) != 2 {
+		t.Fatalf("got %d string tables, want 2", len(vi.StringTables))
+	}
+	if st := vi.StringTables[0]; st.Language != 0x409 || st.CodePage != 1200 || len(st.Strings) != 3 {
+		t.Errorf("string table 0 = %+v", st)
+	}
+	want := []VersionTranslation{{0x407, 1200}, {0x409, 1200}}
+	if len(vi.Translations) != len(want) || vi.Translations[0] != want[0] || vi.Translations[1] != want[1] {
+		t.Errorf("Translations = %v, want %v", vi.Translations, want)
+	}
+	for key, want := range map[string]string{
+		VersionProductName: "Dings", // the German table is listed first
+		VersionCompanyName: "Example Corp",
+		VersionFileVersion: "1.2.3.4",
+		VersionComments:    "",
+	} {
+		if got := vi.String(key); got != want {
+			t.Errorf("String(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLookupVersionInfo(t *testing.T) {
+	ti := singleResourceImage(RT_VERSION, buildVersionInfo())
+	vi, err := ti.open(t).LookupVersionInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vi == nil || vi.String(VersionCompanyName) != "Example Corp" {
+		t.Errorf("LookupVersionInfo = %+v", vi)
+	}
+}
+
+func TestParseVersionInfoErrors(t *testing.T) {
+	good := buildVersionInfo()
+	bad := append([]byte(nil), good...)
+	binary.LittleEndian.PutUint16(bad, uint16(len(bad)+10))
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": good[:4],
+		"length":    bad,
+		"key":       versionNode("NOT_VERSION_INFO", false, nil),
+	} {
+		if _, err := ParseVersionInfo(data); err == nil {
+			t.Errorf("%s: ParseVersionInfo succeeded", name)
+		}
+	}
+}
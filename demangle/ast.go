@@ -4079,6 +4079,111 @@ func (ei *EnableIf) goString(indent int, field string) string {
 		ei.Type.goString(indent+2, "Type: "), args)
 }
 
+// CallingConvention is a function type with an explicit Microsoft
+// calling convention, such as __cdecl or __thiscall.
+type CallingConvention struct {
+	Conv string
+	Base AST
+}
+
+func (cc *CallingConvention) print(ps *printState) {
+	printBase(ps, cc, cc.Base)
+}
+
+func (cc *CallingConvention) printInner(ps *printState) {
+	ps.writeString(cc.Conv)
+	// A pointer to member prints its own leading space.
+	if ln := len(ps.inner); ln > 0 {
+		if _, ok := ps.inner[ln-1].(*PtrMem); ok {
+			return
+		}
+	}
+	ps.writeByte(' ')
+}
+
+func (cc *CallingConvention) Traverse(fn func(AST) bool) {
+	if fn(cc) {
+		cc.Base.Traverse(fn)
+	}
+}
+
+func (cc *CallingConvention) Copy(fn func(AST) AST, skip func(AST) bool) AST {
+	if skip(cc) {
+		return nil
+	}
+	base := cc.Base.Copy(fn, skip)
+	if base == nil {
+		return fn(cc)
+	}
+	cc = &CallingConvention{Conv: cc.Conv, Base: base}
+	if r := fn(cc); r != nil {
+		return r
+	}
+	return cc
+}
+
+func (cc *CallingConvention) GoString() string {
+	return cc.goString(0, "")
+}
+
+func (cc *CallingConvention) goString(indent int, field string) string {
+	return fmt.Sprintf("%*s%sCallingConvention: %s\n%s", indent, "", field,
+		cc.Conv, cc.Base.goString(indent+2, "Base: "))
+}
+
+// AccessSpecifier is a class member with an access specifier, as
+// recorded in Microsoft mangled names.  Storage is "static",
+// "virtual" or empty.
+type AccessSpecifier struct {
+	Access  string
+	Storage string
+	Val     AST
+}
+
+func (as *AccessSpecifier) print(ps *printState) {
+	ps.writeString(as.Access)
+	ps.writeString(": ")
+	if as.Storage != "" {
+		ps.writeString(as.Storage)
+		ps.writeByte(' ')
+	}
+	ps.print(as.Val)
+}
+
+func (as *AccessSpecifier) Traverse(fn func(AST) bool) {
+	if fn(as) {
+		as.Val.Traverse(fn)
+	}
+}
+
+func (as *AccessSpecifier) Copy(fn func(AST) AST, skip func(AST) bool) AST {
+	if skip(as) {
+		return nil
+	}
+	val := as.Val.Copy(fn, skip)
+	if val == nil {
+		return fn(as)
+	}
+	as = &AccessSpecifier{Access: as.Access, Storage: as.Storage, Val: val}
+	if r := fn(as); r != nil {
+		return r
+	}
+	return as
+}
+
+func (as *AccessSpecifier) GoString() string {
+	return as.goString(0, "")
+}
+
+func (as *AccessSpecifier) goString(indent int, field string) string {
+	var storage string
+	if as.Storage != "" {
+		storage = " Storage: " + as.Storage
+	}
+	return fmt.Sprintf("%*s%sAccessSpecifier: %s%s\n%s", indent, "", field,
+		as.Access, storage, as.Val.goString(indent+2, "Val: "))
+}
+
 // Print the inner types.
 func (ps *printState) printInner(prefixOnly bool) []AST {
 	var save []AST
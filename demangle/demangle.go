@@ -2,8 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package demangle defines functions that demangle GCC/LLVM
-// C++ and Rust symbol names.
+// Package demangle defines functions that demangle GCC/LLVM and
+// Microsoft Visual C++ symbol names, and Rust symbol names.
 // This package recognizes names that were mangled according to the C++ ABI
 // defined at http://codesourcery.com/cxx-abi/ and the Rust ABI
 // defined at
@@ -143,7 +143,8 @@ func ToString(name string, options ...Option) (string, error) {
 }
 
 // ToAST demangles a C++ symbol name into an abstract syntax tree
-// representing the symbol.
+// representing the symbol. Both Itanium and Microsoft Visual C++
+// mangled names are recognized.
 // If the NoParams option is passed, and the name has a function type,
 // the parameter types are not demangled.
 // If the name does not appear to be a C++ symbol name at all, the
@@ -179,6 +180,10 @@ func ToAST(name string, options ...Option) (AST, error) {
 		return a, nil
 	}
 
+	if isMsvcEncoding(name) {
+		return msvcToAST(name, options...)
+	}
+
 	const prefix = "_GLOBAL_"
 	if strings.HasPrefix(name, prefix) {
 		// The standard demangler ignores NoParams for global
@@ -39,7 +39,7 @@ func isItaniumEncoding(mangledName string) (int, bool) {
 // 	}
 // }
 
-// Demangle demangle function name. on windows support msvc abi and itanium abi, rust abi
+// Demangle demangle function name. support msvc abi, itanium abi and rust abi on every platform
 func Demangle(name string) string {
 	if skip, ok := isItaniumEncoding(name); ok {
 		return Filter(name[skip:])
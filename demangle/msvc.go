@@ -0,0 +1,1044 @@
+package demangle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isMsvcEncoding reports whether mangledName looks like a symbol
+// mangled according to the Microsoft Visual C++ ABI.
+func isMsvcEncoding(mangledName string) bool {
+	return strings.HasPrefix(mangledName, "?")
+}
+
+// MsvcFilter demangles a Microsoft Visual C++ symbol name.
+// If any error occurs during demangling, the input string is returned.
+func MsvcFilter(name string, options ...Option) string {
+	a, err := msvcToAST(name, options...)
+	if err != nil {
+		return name
+	}
+	return ASTToString(a, options...)
+}
+
+// msvcToAST demangles a Microsoft Visual C++ symbol name into an
+// abstract syntax tree.  The tree is printed in the same style as
+// Itanium symbols, with the calling convention and member access
+// that the Microsoft ABI records.
+func msvcToAST(name string, options ...Option) (ret AST, err error) {
+	if !isMsvcEncoding(name) {
+		return nil, ErrNotMangledName
+	}
+
+	// When the demangling routines encounter an error, they panic
+	// with a value of type demangleErr.
+	defer func() {
+		if r := recover(); r != nil {
+			if de, ok := r.(demangleErr); ok {
+				ret = nil
+				err = de
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	params := true
+	for _, o := range options {
+		switch {
+		case o == NoParams:
+			params = false
+		case o == NoTemplateParams || o == NoEnclosingParams || o == NoClones || o == NoRust || o == Verbose || o == LLVMStyle || isMaxLength(o):
+			// These options don't affect Microsoft symbols,
+			// or only affect printing of the AST.
+		default:
+			return nil, fmt.Errorf("unrecognized demangler option %v", o)
+		}
+	}
+
+	mst := &msvcState{str: name}
+	a := mst.symbol()
+
+	if len(mst.str) > 0 {
+		mst.fail("unparsed characters at end of mangled name")
+	}
+
+	if !params {
+		return msvcSymbolName(a), nil
+	}
+	return a, nil
+}
+
+// A msvcState holds the current state of demangling a Microsoft
+// Visual C++ symbol.
+type msvcState struct {
+	str   string   // remainder of string to demangle
+	off   int      // offset of str within original string
+	names []AST    // name back references
+	keys  []string // printed names, to avoid recording duplicates
+	types []AST    // function parameter back references
+}
+
+// fail panics with demangleErr, to be caught in msvcToAST.
+func (mst *msvcState) fail(err string) {
+	panic(demangleErr{err: err, off: mst.off})
+}
+
+// advance advances the current string offset.
+func (mst *msvcState) advance(add int) {
+	if len(mst.str) < add {
+		panic("internal error")
+	}
+	mst.str = mst.str[add:]
+	mst.off += add
+}
+
+// checkChar requires that the next character in the string be c,
+// and advances past it.
+func (mst *msvcState) checkChar(c byte) {
+	if len(mst.str) == 0 || mst.str[0] != c {
+		mst.fail("expected " + string(c))
+	}
+	mst.advance(1)
+}
+
+// consume advances past prefix if the string starts with it.
+func (mst *msvcState) consume(prefix string) bool {
+	if !strings.HasPrefix(mst.str, prefix) {
+		return false
+	}
+	mst.advance(len(prefix))
+	return true
+}
+
+// peek returns the next character, failing at the end of the string.
+func (mst *msvcState) peek() byte {
+	if len(mst.str) == 0 {
+		mst.fail("unexpected end of mangled name")
+	}
+	return mst.str[0]
+}
+
+// memorizeName records a name that can be referred to later by a
+// single digit.  At most ten names are kept.
+func (mst *msvcState) memorizeName(a AST) {
+	if len(mst.names) >= 10 {
+		return
+	}
+	key := ASTToString(a)
+	for _, k := range mst.keys {
+		if k == key {
+			return
+		}
+	}
+	mst.names = append(mst.names, a)
+	mst.keys = append(mst.keys, key)
+}
+
+// nameBackref returns a previously recorded name.
+func (mst *msvcState) nameBackref() AST {
+	i := int(mst.peek() - '0')
+	if i >= len(mst.names) {
+		mst.fail("name back reference out of range")
+	}
+	mst.advance(1)
+	return mst.names[i]
+}
+
+// number parses an encoded number:
+//
+//	<number> ::= [?] <digit>          # 1 to 10
+//	         ::= [?] <hex digit>+ @   # A to P for 0 to F
+func (mst *msvcState) number() (uint64, bool) {
+	neg := mst.consume("?")
+	if c := mst.peek(); isDigit(c) {
+		mst.advance(1)
+		return uint64(c-'0') + 1, neg
+	}
+	var v uint64
+	for {
+		c := mst.peek()
+		mst.advance(1)
+		if c == '@' {
+			return v, neg
+		}
+		if c < 'A' || c > 'P' {
+			mst.fail("invalid number")
+		}
+		v = v<<4 | uint64(c-'A')
+	}
+}
+
+// signedNumber parses an encoded number and formats it in decimal.
+func (mst *msvcState) signedNumber() string {
+	v, neg := mst.number()
+	s := strconv.FormatUint(v, 10)
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// simpleName parses a name terminated by '@'.
+func (mst *msvcState) simpleName() string {
+	i := strings.IndexByte(mst.str, '@')
+	if i <= 0 {
+		mst.fail("expected name")
+	}
+	n := mst.str[:i]
+	mst.advance(i + 1)
+	return n
+}
+
+// symbol parses a complete mangled symbol.
+//
+//	<symbol> ::= ? <name> <encoding>
+func (mst *msvcState) symbol() AST {
+	mst.checkChar('?')
+
+	switch {
+	case strings.HasPrefix(mst.str, "?@"):
+		// Hashed names are not reversible.
+		n := &Name{Name: "?" + mst.str}
+		mst.advance(len(mst.str))
+		return n
+	case mst.consume("?_C@_"):
+		// String literal; the contents are hashed.
+		mst.advance(len(mst.str))
+		return &Name{Name: "`string'"}
+	case mst.consume("?_R0"):
+		t := mst.qualifiedType()
+		if !mst.consume("@8") {
+			mst.fail("expected @8")
+		}
+		return &Typed{Name: &Name{Name: "`RTTI Type Descriptor'"}, Type: t}
+	case strings.HasPrefix(mst.str, "?__E"), strings.HasPrefix(mst.str, "?__F"):
+		return mst.initFini()
+	}
+
+	name, special := mst.fullName()
+
+	switch c := mst.peek(); {
+	case c >= '0' && c <= '4':
+		return mst.variable(name, c)
+	case c == '5':
+		// Guard variable for a function local static.
+		mst.noCast(name)
+		mst.advance(1)
+		if len(mst.str) > 0 && special != nil {
+			special.Name += "{" + mst.signedNumber() + "}"
+		}
+		return name
+	case c == '6' || c == '7':
+		return mst.specialTable(name)
+	case c == '8' || c == '9':
+		mst.noCast(name)
+		mst.advance(1)
+		return name
+	default:
+		return mst.function(name, special)
+	}
+}
+
+// noCast fails if name is a conversion operator: only the return
+// type of a function names its type.
+func (mst *msvcState) noCast(name AST) {
+	if _, ok := msvcUnqualifiedName(name).(*Cast); ok {
+		mst.fail("conversion operator without a type")
+	}
+}
+
+// initFini parses a dynamic initializer or atexit destructor stub.
+func (mst *msvcState) initFini() AST {
+	prefix := "`dynamic initializer for '"
+	if mst.str[3] == 'F' {
+		prefix = "`dynamic atexit destructor for '"
+	}
+	mst.advance(4)
+	var target AST
+	if strings.HasPrefix(mst.str, "?") {
+		// A static data member, spelled as a complete symbol.
+		target = msvcSymbolName(mst.symbol())
+		mst.consume("@")
+		mst.consume("@")
+	} else {
+		target, _ = mst.fullName()
+	}
+	name := &Name{Name: prefix + ASTToString(target) + "''"}
+	return mst.function(name, nil)
+}
+
+// variable parses the encoding of a data symbol.
+//
+//	<encoding> ::= <storage class> <type> <qualifiers>
+func (mst *msvcState) variable(name AST, c byte) AST {
+	mst.noCast(name)
+	mst.advance(1)
+	t := mst.qualifiedType()
+	mst.pointerExtQualifiers()
+	t = msvcQualify(t, mst.cvQualifiers())
+	var a AST = &Typed{Name: name, Type: t}
+	switch c {
+	case '0':
+		a = &AccessSpecifier{Access: "private", Storage: "static", Val: a}
+	case '1':
+		a = &AccessSpecifier{Access: "protected", Storage: "static", Val: a}
+	case '2':
+		a = &AccessSpecifier{Access: "public", Storage: "static", Val: a}
+	}
+	return a
+}
+
+// specialTable parses the encoding of a virtual function table or
+// virtual base table, with an optional "{for `X'}" target.
+func (mst *msvcState) specialTable(name AST) AST {
+	mst.noCast(name)
+	mst.advance(1)
+	mst.pointerExtQualifiers()
+	quals := mst.cvQualifiers()
+	if !mst.consume("@") {
+		target := mst.fullTypeName()
+		mst.consume("@")
+		q, ok := name.(*Qualified)
+		if !ok {
+			mst.fail("table without enclosing class")
+		}
+		n := ASTToString(q.Name) + "{for `" + ASTToString(target) + "'}"
+		name = &Qualified{Scope: q.Scope, Name: &Name{Name: n}}
+	}
+	if quals == nil {
+		return name
+	}
+	return &Typed{Name: name, Type: quals}
+}
+
+// functionClass describes a function symbol encoding letter.
+type msvcFunctionClass struct {
+	access  string
+	storage string
+	member  bool // has this qualifiers
+	thunk   bool // adjustor thunk
+}
+
+// function parses the encoding of a function symbol.
+//
+//	<encoding> ::= <function class> [<this quals>] <calling convention> <return type> <params> <throw spec>
+func (mst *msvcState) function(name AST, special *Name) AST {
+	var prefix string
+	if mst.consume("$$J0") || mst.consume("$$N") || mst.consume("$$O") {
+		prefix = "extern \"C\" "
+	}
+
+	var fc msvcFunctionClass
+	// The thunk suffix is appended once the type of a conversion
+	// operator is known.
+	var thunk string
+	c := mst.peek()
+	switch {
+	case c == '$':
+		// Virtual displacement thunk.
+		mst.advance(1)
+		ex := mst.consume("R")
+		d := mst.peek()
+		if d < '0' || d > '5' {
+			mst.fail("unsupported thunk")
+		}
+		mst.advance(1)
+		fc.access = [...]string{"private", "protected", "public"}[(d-'0')/2]
+		fc.storage = "virtual"
+		fc.member = true
+		n := 2
+		if ex {
+			n = 4
+		}
+		disp := make([]string, n)
+		for i := range disp {
+			disp[i] = mst.signedNumber()
+		}
+		thunk = "`vtordisp{" + strings.Join(disp, ",") + "}'"
+		prefix += "[thunk]:"
+	case c >= 'A' && c <= 'Z':
+		mst.advance(1)
+		i := int(c - 'A')
+		if i < 24 {
+			fc.access = [...]string{"private", "protected", "public"}[i/8]
+			switch (i % 8) / 2 {
+			case 0:
+				fc.member = true
+			case 1:
+				fc.storage = "static"
+			case 2:
+				fc.storage = "virtual"
+				fc.member = true
+			case 3:
+				fc.storage = "virtual"
+				fc.member = true
+				fc.thunk = true
+			}
+		}
+		if fc.thunk {
+			thunk = "`adjustor{" + mst.signedNumber() + "}'"
+			prefix += "[thunk]:"
+		}
+	default:
+		mst.fail("unrecognized function class")
+	}
+
+	var quals AST
+	var ref string
+	if fc.member {
+		quals, ref = mst.thisQualifiers()
+	}
+	conv := mst.callingConvention()
+
+	var ret AST
+	if !mst.consume("@") {
+		ret = mst.qualifiedType()
+	}
+	if cast, ok := msvcUnqualifiedName(name).(*Cast); ok {
+		// The conversion operator names its return type.
+		if ret == nil {
+			mst.fail("conversion operator without a type")
+		}
+		cast.To = ret
+		ret = nil
+	}
+	if thunk != "" {
+		name = msvcAppendName(name, thunk)
+	}
+
+	args := mst.params()
+	mst.throwSpec()
+
+	var ft AST = &CallingConvention{Conv: conv, Base: &FunctionType{Return: ret, Args: args}}
+	if quals != nil || ref != "" {
+		ft = &MethodWithQualifiers{Method: ft, Qualifiers: quals, RefQualifier: ref}
+	}
+	var a AST = &Typed{Name: name, Type: ft}
+	if fc.access != "" {
+		a = &AccessSpecifier{Access: fc.access, Storage: fc.storage, Val: a}
+	}
+	if prefix != "" {
+		a = &Special{Prefix: prefix, Val: a}
+	}
+	return a
+}
+
+// thisQualifiers parses the qualifiers of the implicit this pointer
+// of a member function, returning the cv-qualifiers and the
+// ref-qualifier.
+func (mst *msvcState) thisQualifiers() (AST, string) {
+	mst.pointerExtQualifiers()
+	ref := ""
+	if mst.consume("G") {
+		ref = "&"
+	} else if mst.consume("H") {
+		ref = "&&"
+	}
+	return mst.cvQualifiers(), ref
+}
+
+// callingConvention parses a calling convention letter.
+func (mst *msvcState) callingConvention() string {
+	c := mst.peek()
+	mst.advance(1)
+	switch c {
+	case 'A', 'B':
+		return "__cdecl"
+	case 'C', 'D':
+		return "__pascal"
+	case 'E', 'F':
+		return "__thiscall"
+	case 'G', 'H':
+		return "__stdcall"
+	case 'I', 'J':
+		return "__fastcall"
+	case 'M', 'N':
+		return "__clrcall"
+	case 'O', 'P':
+		return "__eabi"
+	case 'Q':
+		return "__vectorcall"
+	case 'S':
+		return "__attribute__((__swiftcall__))"
+	case 'W':
+		return "__attribute__((__swiftasynccall__))"
+	}
+	mst.fail("unrecognized calling convention")
+	panic("not reached")
+}
+
+// throwSpec parses the exception specification of a function.
+func (mst *msvcState) throwSpec() {
+	if mst.consume("_E") {
+		return
+	}
+	mst.checkChar('Z')
+}
+
+// params parses a function parameter list.
+//
+//	<params> ::= X
+//	         ::= <type>+ @
+//	         ::= <type>* Z    # ends with ...
+func (mst *msvcState) params() []AST {
+	if mst.consume("X") {
+		return []AST{&BuiltinType{Name: "void"}}
+	}
+	var args []AST
+	for {
+		c := mst.peek()
+		if c == '@' {
+			mst.advance(1)
+			return args
+		}
+		if c == 'Z' {
+			mst.advance(1)
+			return append(args, &BuiltinType{Name: "..."})
+		}
+		if isDigit(c) {
+			i := int(c - '0')
+			if i >= len(mst.types) {
+				mst.fail("type back reference out of range")
+			}
+			mst.advance(1)
+			args = append(args, mst.types[i])
+			continue
+		}
+		start := len(mst.str)
+		t := mst.qualifiedType()
+		if start-len(mst.str) > 1 && len(mst.types) < 10 {
+			mst.types = append(mst.types, t)
+		}
+		args = append(args, t)
+	}
+}
+
+// fullName parses a fully qualified symbol name.
+//
+//	<full name> ::= <unqualified name> <scope piece>* @
+//
+// The scope pieces are listed innermost first.  If the unqualified
+// name is a special name whose text depends on what follows, it is
+// returned too.
+func (mst *msvcState) fullName() (AST, *Name) {
+	first, special := mst.unqualifiedName(true)
+	var scopes []AST
+	for !mst.consume("@") {
+		scopes = append(scopes, mst.scopePiece())
+	}
+
+	// A constructor or destructor template is named after the class.
+	structor := first
+	if t, ok := first.(*Template); ok {
+		structor = t.Name
+	}
+	switch f := structor.(type) {
+	case *Constructor:
+		if len(scopes) == 0 {
+			mst.fail("constructor outside of class")
+		}
+		f.Name = scopes[0]
+	case *Destructor:
+		if len(scopes) == 0 {
+			mst.fail("destructor outside of class")
+		}
+		f.Name = scopes[0]
+	}
+	return msvcQualified(first, scopes), special
+}
+
+// fullTypeName parses the fully qualified name of a class, struct,
+// union or enum.
+func (mst *msvcState) fullTypeName() AST {
+	var first AST
+	c := mst.peek()
+	switch {
+	case isDigit(c):
+		first = mst.nameBackref()
+	case strings.HasPrefix(mst.str, "?$"):
+		first = mst.templateName(false)
+	default:
+		first = &Name{Name: mst.simpleName()}
+		mst.memorizeName(first)
+	}
+	var scopes []AST
+	for !mst.consume("@") {
+		scopes = append(scopes, mst.scopePiece())
+	}
+	return msvcQualified(first, scopes)
+}
+
+// msvcQualified builds a qualified name from an unqualified name and
+// its scopes, innermost first.
+func msvcQualified(first AST, scopes []AST) AST {
+	if len(scopes) == 0 {
+		return first
+	}
+	scope := scopes[len(scopes)-1]
+	for i := len(scopes) - 2; i >= 0; i-- {
+		scope = &Qualified{Scope: scope, Name: scopes[i]}
+	}
+	return &Qualified{Scope: scope, Name: first}
+}
+
+// unqualifiedName parses the first piece of a symbol name, which may
+// be an operator or a compiler generated special name.
+func (mst *msvcState) unqualifiedName(first bool) (AST, *Name) {
+	c := mst.peek()
+	switch {
+	case isDigit(c):
+		return mst.nameBackref(), nil
+	case strings.HasPrefix(mst.str, "?$"):
+		return mst.templateName(first), nil
+	case c == '?' && first:
+		mst.advance(1)
+		return mst.operatorName()
+	default:
+		n := &Name{Name: mst.simpleName()}
+		mst.memorizeName(n)
+		return n, nil
+	}
+}
+
+// scopePiece parses an enclosing namespace, class or function.
+func (mst *msvcState) scopePiece() AST {
+	c := mst.peek()
+	switch {
+	case isDigit(c):
+		return mst.nameBackref()
+	case strings.HasPrefix(mst.str, "?$"):
+		return mst.templateName(false)
+	case strings.HasPrefix(mst.str, "?A0x"):
+		mst.advance(2)
+		mst.simpleName()
+		n := &Name{Name: "`anonymous namespace'"}
+		mst.memorizeName(n)
+		return n
+	case c == '?':
+		// A name local to a function:
+		//	? <number> ? <symbol>
+		mst.advance(1)
+		v, _ := mst.number()
+		mst.checkChar('?')
+		names, keys, types := mst.names, mst.keys, mst.types
+		mst.names, mst.keys, mst.types = nil, nil, nil
+		fn := mst.symbol()
+		mst.names, mst.keys, mst.types = names, keys, types
+		return &Qualified{
+			Scope:     &Name{Name: "`" + ASTToString(fn) + "'"},
+			Name:      &Name{Name: "`" + strconv.FormatUint(v, 10) + "'"},
+			LocalName: true,
+		}
+	default:
+		n := &Name{Name: mst.simpleName()}
+		mst.memorizeName(n)
+		return n
+	}
+}
+
+// templateName parses a template instantiation.
+//
+//	<template name> ::= ?$ <unqualified name> <template arg>* @
+//
+// Template arguments have their own back reference tables.  Only the
+// first piece of a symbol name, with structor set, may be a constructor
+// or destructor template.
+func (mst *msvcState) templateName(structor bool) AST {
+	mst.advance(2)
+	names, keys, types := mst.names, mst.keys, mst.types
+	mst.names, mst.keys, mst.types = nil, nil, nil
+
+	var name AST
+	memorize := true
+	if mst.consume("?") {
+		name, _ = mst.operatorName()
+		switch name.(type) {
+		case *Operator:
+		case *Constructor, *Destructor:
+			if !structor {
+				mst.fail("unsupported template name")
+			}
+			// Named after the class, which follows: there is
+			// nothing to refer back to yet.
+			memorize = false
+		default:
+			mst.fail("unsupported template name")
+		}
+	} else {
+		name = &Name{Name: mst.simpleName()}
+		mst.memorizeName(name)
+	}
+	var args []AST
+	for !mst.consume("@") {
+		if a := mst.templateArg(); a != nil {
+			args = append(args, a)
+		}
+	}
+
+	mst.names, mst.keys, mst.types = names, keys, types
+	t := &Template{Name: name, Args: args}
+	if memorize {
+		mst.memorizeName(t)
+	}
+	return t
+}
+
+// templateArg parses a single template argument.  It returns nil for
+// an empty parameter pack.
+func (mst *msvcState) templateArg() AST {
+	switch {
+	case mst.consume("$$V"), mst.consume("$$Z"), mst.consume("$$$V"), mst.consume("$S"):
+		return nil
+	case mst.consume("$0"):
+		v, neg := mst.number()
+		return &Literal{Type: &BuiltinType{Name: "int"}, Val: strconv.FormatUint(v, 10), Neg: neg}
+	case mst.consume("$1"):
+		return &Special{Prefix: "&", Val: msvcSymbolName(mst.symbol())}
+	case mst.consume("$E"):
+		return msvcSymbolName(mst.symbol())
+	case mst.consume("$D"), mst.consume("$Q"):
+		v, _ := mst.number()
+		return &Name{Name: "`template-parameter" + strconv.FormatUint(v, 10) + "'"}
+	case strings.HasPrefix(mst.str, "$$") || !strings.HasPrefix(mst.str, "$"):
+		return mst.qualifiedType()
+	}
+	mst.fail("unsupported template argument")
+	panic("not reached")
+}
+
+// msvcOperators maps operator codes, following ?, to operator names.
+var msvcOperators = map[string]string{
+	"2": "new", "3": "delete", "4": "=", "5": ">>", "6": "<<",
+	"7": "!", "8": "==", "9": "!=", "A": "[]", "C": "->",
+	"D": "*", "E": "++", "F": "--", "G": "-", "H": "+",
+	"I": "&", "J": "->*", "K": "/", "L": "%", "M": "<",
+	"N": "<=", "O": ">", "P": ">=", "Q": ",", "R": "()",
+	"S": "~", "T": "^", "U": "|", "V": "&&", "W": "||",
+	"X": "*=", "Y": "+=", "Z": "-=",
+	"_0": "/=", "_1": "%=", "_2": ">>=", "_3": "<<=", "_4": "&=",
+	"_5": "|=", "_6": "^=", "_U": "new[]", "_V": "delete[]",
+	"__L": "co_await", "__M": "<=>",
+}
+
+// msvcSpecialNames maps special name codes, following ?, to the
+// names of compiler generated symbols.
+var msvcSpecialNames = map[string]string{
+	"_7":  "`vftable'",
+	"_8":  "`vbtable'",
+	"_9":  "`vcall'",
+	"_A":  "`typeof'",
+	"_B":  "`local static guard'",
+	"_D":  "`vbase destructor'",
+	"_E":  "`vector deleting destructor'",
+	"_F":  "`default constructor closure'",
+	"_G":  "`scalar deleting destructor'",
+	"_H":  "`vector constructor iterator'",
+	"_I":  "`vector destructor iterator'",
+	"_J":  "`vector vbase constructor iterator'",
+	"_K":  "`virtual displacement map'",
+	"_L":  "`eh vector constructor iterator'",
+	"_M":  "`eh vector destructor iterator'",
+	"_N":  "`eh vector vbase constructor iterator'",
+	"_O":  "`copy constructor closure'",
+	"_S":  "`local vftable'",
+	"_T":  "`local vftable constructor closure'",
+	"_X":  "`placement delete closure'",
+	"_Y":  "`placement delete[] closure'",
+	"_R2": "`RTTI Base Class Array'",
+	"_R3": "`RTTI Class Hierarchy Descriptor'",
+	"_R4": "`RTTI Complete Object Locator'",
+	"__A": "`managed vector constructor iterator'",
+	"__B": "`managed vector destructor iterator'",
+	"__C": "`eh vector copy constructor iterator'",
+	"__D": "`eh vector vbase copy constructor iterator'",
+	"__G": "`vector copy constructor iterator'",
+	"__H": "`vector vbase copy constructor iterator'",
+	"__I": "`managed vector copy constructor iterator'",
+	"__J": "`local static thread guard'",
+}
+
+// operatorName parses the name following ? in the first piece of a
+// symbol name.
+func (mst *msvcState) operatorName() (AST, *Name) {
+	switch {
+	case mst.consume("0"):
+		return &Constructor{}, nil
+	case mst.consume("1"):
+		return &Destructor{}, nil
+	case mst.consume("B"):
+		return &Cast{}, nil
+	case mst.consume("__K"):
+		return &Name{Name: "operator \"\" " + mst.simpleName()}, nil
+	case mst.consume("_R1"):
+		var disp [4]string
+		for i := range disp {
+			disp[i] = mst.signedNumber()
+		}
+		n := &Name{Name: "`RTTI Base Class Descriptor at (" + strings.Join(disp[:], ",") + ")'"}
+		return n, n
+	}
+	for l := 3; l > 0; l-- {
+		if len(mst.str) < l {
+			continue
+		}
+		code := mst.str[:l]
+		if op, ok := msvcOperators[code]; ok {
+			mst.advance(l)
+			return &Operator{Name: op}, nil
+		}
+		if sn, ok := msvcSpecialNames[code]; ok {
+			mst.advance(l)
+			n := &Name{Name: sn}
+			return n, n
+		}
+	}
+	mst.fail("unrecognized operator name")
+	panic("not reached")
+}
+
+// qualifiedType parses a type that may be preceded by ? and
+// cv-qualifiers, as used for return types and variables.
+func (mst *msvcState) qualifiedType() AST {
+	if mst.consume("?") {
+		quals := mst.cvQualifiers()
+		return msvcQualify(mst.typ(), quals)
+	}
+	return mst.typ()
+}
+
+// msvcBuiltinTypes maps type codes to builtin type names.
+var msvcBuiltinTypes = map[string]string{
+	"C": "signed char", "D": "char", "E": "unsigned char",
+	"F": "short", "G": "unsigned short", "H": "int",
+	"I": "unsigned int", "J": "long", "K": "unsigned long",
+	"M": "float", "N": "double", "O": "long double", "X": "void",
+	"_D": "__int8", "_E": "unsigned __int8", "_F": "__int16",
+	"_G": "unsigned __int16", "_H": "__int32", "_I": "unsigned __int32",
+	"_J": "__int64", "_K": "unsigned __int64", "_L": "__int128",
+	"_M": "unsigned __int128", "_N": "bool", "_Q": "char8_t",
+	"_S": "char16_t", "_U": "char32_t", "_W": "wchar_t",
+	"$$T": "std::nullptr_t",
+}
+
+// typ parses a type.
+func (mst *msvcState) typ() AST {
+	c := mst.peek()
+	for l := 3; l > 0; l-- {
+		if len(mst.str) < l {
+			continue
+		}
+		if bt, ok := msvcBuiltinTypes[mst.str[:l]]; ok {
+			mst.advance(l)
+			return &BuiltinType{Name: bt}
+		}
+	}
+	switch c {
+	case 'T', 'U', 'V':
+		mst.advance(1)
+		kind := [...]string{"union", "struct", "class"}[c-'T']
+		return &ElaboratedType{Kind: kind, Type: mst.fullTypeName()}
+	case 'W':
+		mst.advance(1)
+		if !isDigit(mst.peek()) {
+			mst.fail("expected enum size")
+		}
+		mst.advance(1)
+		return &ElaboratedType{Kind: "enum", Type: mst.fullTypeName()}
+	case 'P', 'Q', 'R', 'S', 'A', 'B':
+		mst.advance(1)
+		return mst.pointerType(c)
+	case 'Y':
+		mst.advance(1)
+		return mst.arrayType()
+	case '?':
+		return mst.qualifiedType()
+	case '$':
+		switch {
+		case mst.consume("$$Q"):
+			return mst.pointerType(msvcRvalueRef)
+		case mst.consume("$$R"):
+			return mst.pointerType(msvcVolatileRvalueRef)
+		case mst.consume("$$A6"):
+			return mst.functionType()
+		case mst.consume("$$A8@@"):
+			return mst.functionType()
+		case mst.consume("$$B"):
+			mst.checkChar('Y')
+			return mst.arrayType()
+		case mst.consume("$$C"):
+			quals := mst.cvQualifiers()
+			return msvcQualify(mst.typ(), quals)
+		}
+	}
+	mst.fail("unrecognized type code")
+	panic("not reached")
+}
+
+// functionType parses a function type following the calling
+// convention letter position.
+func (mst *msvcState) functionType() AST {
+	conv := mst.callingConvention()
+	var ret AST
+	if !mst.consume("@") {
+		ret = mst.qualifiedType()
+	}
+	args := mst.params()
+	mst.throwSpec()
+	return &CallingConvention{Conv: conv, Base: &FunctionType{Return: ret, Args: args}}
+}
+
+// Pointer kinds for rvalue references, which have no single letter
+// type code.
+const (
+	msvcRvalueRef         = 'q'
+	msvcVolatileRvalueRef = 'r'
+)
+
+// pointerType parses a pointer or reference type.  The kind is the
+// type code: P, Q, R and S are pointers with no, const, volatile and
+// const volatile qualifiers, A and B are references, and
+// msvcRvalueRef and msvcVolatileRvalueRef are rvalue references.
+func (mst *msvcState) pointerType(kind byte) AST {
+	var pointee AST
+	var class AST
+	switch {
+	case mst.consume("6"):
+		pointee = mst.functionType()
+	case mst.consume("8"):
+		class = mst.fullTypeName()
+		quals, ref := mst.thisQualifiers()
+		pointee = mst.functionType()
+		if quals != nil || ref != "" {
+			pointee = &MethodWithQualifiers{Method: pointee, Qualifiers: quals, RefQualifier: ref}
+		}
+	default:
+		mst.pointerExtQualifiers()
+		var quals AST
+		if c := mst.peek(); c >= 'Q' && c <= 'T' {
+			mst.advance(1)
+			quals = msvcCVQualifiers(c - 'Q')
+			class = mst.fullTypeName()
+		} else {
+			quals = mst.cvQualifiers()
+		}
+		pointee = msvcQualify(mst.typ(), quals)
+	}
+
+	var p AST
+	switch {
+	case class != nil:
+		p = &PtrMem{Class: class, Member: pointee}
+	case kind == 'A' || kind == 'B':
+		p = &ReferenceType{Base: pointee}
+	case kind == msvcRvalueRef || kind == msvcVolatileRvalueRef:
+		p = &RvalueReferenceType{Base: pointee}
+	default:
+		p = &PointerType{Base: pointee}
+	}
+
+	switch kind {
+	case 'Q':
+		return msvcQualify(p, msvcCVQualifiers(1))
+	case 'R', 'B', msvcVolatileRvalueRef:
+		return msvcQualify(p, msvcCVQualifiers(2))
+	case 'S':
+		return msvcQualify(p, msvcCVQualifiers(3))
+	}
+	return p
+}
+
+// arrayType parses an array type following Y.
+//
+//	<array type> ::= Y <number> <number>+ <type>
+func (mst *msvcState) arrayType() AST {
+	n, _ := mst.number()
+	if n == 0 || n > 64 {
+		mst.fail("invalid array rank")
+	}
+	dims := make([]uint64, n)
+	for i := range dims {
+		dims[i], _ = mst.number()
+	}
+	t := mst.qualifiedType()
+	for i := len(dims) - 1; i >= 0; i-- {
+		t = &ArrayType{Dimension: &Name{Name: strconv.FormatUint(dims[i], 10)}, Element: t}
+	}
+	return t
+}
+
+// pointerExtQualifiers skips the __ptr64, __unaligned and __restrict
+// pointer qualifiers, which are not printed.
+func (mst *msvcState) pointerExtQualifiers() {
+	for len(mst.str) > 0 && (mst.str[0] == 'E' || mst.str[0] == 'F' || mst.str[0] == 'I') {
+		mst.advance(1)
+	}
+}
+
+// cvQualifiers parses a cv-qualifier letter, A to D.
+func (mst *msvcState) cvQualifiers() AST {
+	c := mst.peek()
+	if c < 'A' || c > 'D' {
+		mst.fail("expected cv-qualifiers")
+	}
+	mst.advance(1)
+	return msvcCVQualifiers(c - 'A')
+}
+
+// msvcCVQualifiers returns the qualifiers for the bit set cv, where
+// 1 is const and 2 is volatile, or nil if there are none.
+func msvcCVQualifiers(cv byte) AST {
+	var qs []AST
+	if cv&1 != 0 {
+		qs = append(qs, &Qualifier{Name: "const"})
+	}
+	if cv&2 != 0 {
+		qs = append(qs, &Qualifier{Name: "volatile"})
+	}
+	if len(qs) == 0 {
+		return nil
+	}
+	return &Qualifiers{Qualifiers: qs}
+}
+
+// msvcQualify applies qualifiers to a type.
+func msvcQualify(t, quals AST) AST {
+	if quals == nil {
+		return t
+	}
+	return &TypeWithQualifiers{Base: t, Qualifiers: quals}
+}
+
+// msvcAppendName appends a suffix to the unqualified part of a name.
+func msvcAppendName(name AST, suffix string) AST {
+	if q, ok := name.(*Qualified); ok {
+		return &Qualified{Scope: q.Scope, Name: &Name{Name: ASTToString(q.Name) + suffix}}
+	}
+	return &Name{Name: ASTToString(name) + suffix}
+}
+
+// msvcUnqualifiedName returns the innermost part of a name.
+func msvcUnqualifiedName(name AST) AST {
+	if q, ok := name.(*Qualified); ok {
+		return q.Name
+	}
+	return name
+}
+
+// msvcSymbolName returns the name of a demangled symbol, without its
+// type.
+func msvcSymbolName(a AST) AST {
+	for {
+		switch s := a.(type) {
+		case *Special:
+			a = s.Val
+		case *AccessSpecifier:
+			a = s.Val
+		case *Typed:
+			return s.Name
+		default:
+			return a
+		}
+	}
+}
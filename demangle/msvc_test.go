@@ -0,0 +1,231 @@
+package demangle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMsvcDemangler(t *testing.T) {
+	var tests = []struct {
+		input        string
+		want         string
+		wantNoParams string
+	}{
+		{
+			"?foo@@YAXH@Z",
+			"void __cdecl foo(int)",
+			"foo",
+		},
+		{
+			"?bar@C@@QAEHXZ",
+			"public: int __thiscall C::bar(void)",
+			"C::bar",
+		},
+		{
+			"?get@C@@QBEHXZ",
+			"public: int __thiscall C::get(void) const",
+			"C::get",
+		},
+		{
+			"??0C@@QAE@XZ",
+			"public: __thiscall C::C(void)",
+			"C::C",
+		},
+		{
+			"??1C@@UAE@XZ",
+			"public: virtual __thiscall C::~C(void)",
+			"C::~C",
+		},
+		{
+			"??BC@@WBA@EAAHXZ",
+			"[thunk]:public: virtual __cdecl C::operator int`adjustor{16}'(void)",
+			"C::operator int`adjustor{16}'",
+		},
+		{
+			"??$?0H@C@@QAE@H@Z",
+			"public: __thiscall C::C<int>(int)",
+			"C::C<int>",
+		},
+		{
+			"??$?0H@?$C@D@@QAE@H@Z",
+			"public: __thiscall C<char>::C<char><int>(int)",
+			"C<char>::C<char><int>",
+		},
+		{
+			"?x@C@@2HB",
+			"public: static int const C::x",
+			"C::x",
+		},
+		{
+			"?p@@3PEBHEB",
+			"int const* const p",
+			"p",
+		},
+		{
+			"?fp@@3P6AXH@ZA",
+			"void (__cdecl *fp)(int)",
+			"fp",
+		},
+		{
+			"?f@N@@YAPAVC@1@PAV21@@Z",
+			"class N::C* __cdecl N::f(class N::C*)",
+			"N::f",
+		},
+		{
+			"?f@?$vector@HV?$allocator@H@std@@@std@@QEAAXAEBH@Z",
+			"public: void __cdecl std::vector<int, class std::allocator<int> >::f(int const&)",
+			"std::vector<int, class std::allocator<int> >::f",
+		},
+		{
+			"??$f@$0?5@@YAXXZ",
+			"void __cdecl f<-6>(void)",
+			"f<-6>",
+		},
+		{
+			"??BC@@QBEHXZ",
+			"public: __thiscall C::operator int(void) const",
+			"C::operator int",
+		},
+		{
+			"??4C@@QAEAAV0@ABV0@@Z",
+			"public: class C& __thiscall C::operator=(class C const&)",
+			"C::operator=",
+		},
+		{
+			"?f@@YAXP8C@@AEXH@Z@Z",
+			"void __cdecl f(void (__thiscall C::*)(int))",
+			"f",
+		},
+		{
+			"?f@@YAXPQC@@H@Z",
+			"void __cdecl f(int C::*)",
+			"f",
+		},
+		{
+			"?f@@YAXAAY02H@Z",
+			"void __cdecl f(int (&) [3])",
+			"f",
+		},
+		{
+			"?f@@YAXHZZ",
+			"void __cdecl f(int, ...)",
+			"f",
+		},
+		{
+			"?f@@YAX$$QAH@Z",
+			"void __cdecl f(int&&)",
+			"f",
+		},
+		{
+			"?f@@YAXVC@@0@Z",
+			"void __cdecl f(class C, class C)",
+			"f",
+		},
+		{
+			"?f@C@@QEGBAXXZ",
+			"public: void __cdecl C::f(void) const &",
+			"C::f",
+		},
+		{
+			"?f@?A0x12345678@@YAXXZ",
+			"void __cdecl `anonymous namespace'::f(void)",
+			"`anonymous namespace'::f",
+		},
+		{
+			"?x@?1??f@@YAXXZ@4HA",
+			"int `void __cdecl f(void)'::`2'::x",
+			"`void __cdecl f(void)'::`2'::x",
+		},
+		{
+			"??_GC@@UAEPAXI@Z",
+			"public: virtual void* __thiscall C::`scalar deleting destructor'(unsigned int)",
+			"C::`scalar deleting destructor'",
+		},
+		{
+			"?f@C@@W3AEXXZ",
+			"[thunk]:public: virtual void __thiscall C::f`adjustor{4}'(void)",
+			"C::f`adjustor{4}'",
+		},
+		{
+			"??__Ex@@YAXXZ",
+			"void __cdecl `dynamic initializer for 'x''(void)",
+			"`dynamic initializer for 'x''",
+		},
+		{
+			"??_7C@@6B@",
+			"const C::`vftable'",
+			"C::`vftable'",
+		},
+		{
+			"??_7D@@6BB@@@",
+			"const D::`vftable'{for `B'}",
+			"D::`vftable'{for `B'}",
+		},
+		{
+			"??_R0?AVC@@@8",
+			"class C `RTTI Type Descriptor'",
+			"`RTTI Type Descriptor'",
+		},
+		{
+			"??_R1A@?0A@EA@C@@8",
+			"C::`RTTI Base Class Descriptor at (0,-1,0,64)'",
+			"C::`RTTI Base Class Descriptor at (0,-1,0,64)'",
+		},
+		{
+			"??_C@_05ABCDEF@hello?$AA@",
+			"`string'",
+			"`string'",
+		},
+	}
+
+	for _, test := range tests {
+		if got, err := ToString(test.input); err != nil {
+			t.Errorf("demangling %s: unexpected error %v", test.input, err)
+		} else if got != test.want {
+			t.Errorf("demangling %s: got %s, want %s", test.input, got, test.want)
+		}
+
+		if got, err := ToString(test.input, NoParams); err != nil {
+			t.Errorf("demangling NoParams  %s: unexpected error %v", test.input, err)
+		} else if got != test.wantNoParams {
+			t.Errorf("demangling NoParams %s: got %s, want %s", test.input, got, test.wantNoParams)
+		}
+
+		if got := Demangle(test.input); got != test.want {
+			t.Errorf("Demangle(%s) == %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestMsvcFailure(t *testing.T) {
+	var tests = []struct {
+		input string
+		error string
+	}{
+		{"?f@@YAXH", "unexpected end of mangled name"},
+		{"?f@@YAX5@Z", "type back reference out of range"},
+		{"?f@@YAXV3@@Z", "name back reference out of range"},
+		{"?f@@YAX!@Z", "unrecognized type code"},
+		{"?f@@YAXXZQ", "unparsed characters at end of mangled name"},
+		{"??BFoo@@QEAA@XZ", "conversion operator without a type"},
+		{"??BFoo@@2HA", "conversion operator without a type"},
+		{"??BFoo@@6B@", "conversion operator without a type"},
+		{"??BFoo@@5", "conversion operator without a type"},
+		{"??BFoo@@8", "conversion operator without a type"},
+		{"??BC@@WBA@EAA@XZ", "conversion operator without a type"},
+		{"??D?$?0H@C@@QAE@H@Z", "unsupported template name"},
+	}
+
+	for _, test := range tests {
+		got, err := ToString(test.input)
+		if err == nil {
+			t.Errorf("unexpected success for %s: %s", test.input, got)
+		} else if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("unexpected error for %s: %v", test.input, err)
+		}
+
+		if got := Filter(test.input); got != test.input {
+			t.Errorf("Filter(%s) == %s, want %s", test.input, got, test.input)
+		}
+	}
+}
@@ -1,10 +0,0 @@
-//go:build !windows
-
-package demangle
-
-/// placeholder
-
-func MsvcFilter(name string) string {
-
-	return name
-}
@@ -1,19 +1,104 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"github.com/fcharlie/buna/debug/depends"
+	"github.com/fcharlie/buna/debug/mime"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s exefile\n", os.Args[0])
+	format := flag.String("format", "tree", "output format: tree, json or dot")
+	sysdir := flag.String("sysdir", "", "Windows system directories, separated by "+string(filepath.ListSeparator))
+	path := flag.String("path", "", "Windows PATH directories, separated by "+string(filepath.ListSeparator))
+	apiset := flag.String("apiset", "", "apisetschema.dll to resolve Windows API set contracts with")
+	root := flag.String("root", "", "root of the target system for ELF and Mach-O libraries")
+	symbols := flag.Bool("symbols", true, "report imported symbols the dependencies do not export")
+	color := flag.Bool("color", isTerminal(os.Stdout), "highlight missing modules and unresolved imports")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] exefile\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	file := flag.Arg(0)
+	bt, err := depends.Detect(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable detect file: %v\n", err)
+		os.Exit(1)
+	}
+	if bt.IsElf() && bt&(mime.Relocatable|mime.CoreDump) != 0 {
+		fmt.Fprintf(os.Stderr, "%s is not an executable nor a shared object\n", file)
+		os.Exit(1)
+	}
+
+	w := &depends.Walker{Symbols: *symbols}
+	switch {
+	case bt.IsPE():
+		r := depends.NewWindowsResolver("")
+		if *sysdir != "" {
+			r.SystemDirs = filepath.SplitList(*sysdir)
+		}
+		if *path != "" {
+			r.Path = filepath.SplitList(*path)
+		}
+		if *apiset == "" && len(r.SystemDirs) != 0 {
+			if p := filepath.Join(r.SystemDirs[0], "apisetschema.dll"); fileExists(p) {
+				*apiset = p
+			}
+		}
+		if *apiset != "" {
+			if err := r.LoadAPISet(*apiset); err != nil {
+				fmt.Fprintf(os.Stderr, "unable load api set schema: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		w.PE = r
+	case bt.IsElf():
+		w.ELF = depends.NewELFResolver(*root)
+	case bt.IsMachO():
+		w.MachO = depends.NewMachOResolver(*root)
+	}
+	g, err := w.Walk(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable walk dependencies: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "tree":
+		err = writeTree(os.Stdout, g, *color)
+	case "json":
+		err = writeJSON(os.Stdout, g)
+	case "dot":
+		err = writeDOT(os.Stdout, g)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *format)
 		os.Exit(1)
 	}
-	fd, err := os.Open(os.Args[1])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable open file: %s\n", err)
+		fmt.Fprintf(os.Stderr, "unable write graph: %v\n", err)
 		os.Exit(1)
 	}
-	defer fd.Close()
+	if len(g.Missing()) != 0 {
+		os.Exit(2)
+	}
+}
+
+func fileExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// isTerminal reports whether f is a character device, such as a
+// terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
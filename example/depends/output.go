@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fcharlie/buna/debug/depends"
+	"github.com/fcharlie/buna/debug/mime"
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+func formatName(bt mime.BinType) string {
+	switch {
+	case bt.IsPE():
+		return "PE"
+	case bt.IsElf():
+		return "ELF"
+	case bt.IsMachO():
+		return "Mach-O"
+	}
+	return "unknown"
+}
+
+// treeWriter prints the graph as an indented tree. The dependencies of
+// a module shared by several importers are printed once.
+type treeWriter struct {
+	w       *bufio.Writer
+	color   bool
+	printed map[*depends.Module]bool
+}
+
+func writeTree(w io.Writer, g *depends.Graph, color bool) error {
+	t := &treeWriter{w: bufio.NewWriter(w), color: color, printed: make(map[*depends.Module]bool)}
+	fmt.Fprintf(t.w, "%s (%s)\n", g.Root.Path, formatName(g.Root.Format))
+	t.module(g.Root, "")
+	missing := g.Missing()
+	if len(missing) != 0 {
+		fmt.Fprintf(t.w, "\n%s\n", t.highlight(colorRed, fmt.Sprintf("%d missing:", len(missing))))
+		for _, name := range missing {
+			fmt.Fprintf(t.w, "    %s\n", name)
+		}
+	}
+	if len(g.Cycles) != 0 {
+		fmt.Fprintf(t.w, "\n%d cycles:\n", len(g.Cycles))
+		for _, c := range g.Cycles {
+			fmt.Fprint(t.w, "   ")
+			for i, m := range c {
+				if i != 0 {
+					fmt.Fprint(t.w, " ->")
+				}
+				fmt.Fprintf(t.w, " %s", filepath.Base(m.Path))
+			}
+			fmt.Fprintln(t.w)
+		}
+	}
+	return t.w.Flush()
+}
+
+func (t *treeWriter) highlight(color, s string) string {
+	if !t.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (t *treeWriter) module(m *depends.Module, indent string) {
+	t.printed[m] = true
+	if m.Err != nil {
+		fmt.Fprintf(t.w, "%s%s\n", indent, t.highlight(colorRed, "error: "+m.Err.Error()))
+	}
+	for _, err := range m.Warnings {
+		fmt.Fprintf(t.w, "%s%s\n", indent, t.highlight(colorYellow, "warning: "+err.Error()))
+	}
+	for _, s := range m.Unresolved {
+		fmt.Fprintf(t.w, "%s%s\n", indent, t.highlight(colorYellow, "unresolved: "+s.String()))
+	}
+	for i, d := range m.Deps {
+		branch, next := "├── ", "│   "
+		if i == len(m.Deps)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(t.w, "%s%s%s\n", indent, branch, t.dependency(d))
+		if d.Module != nil && !d.Cycle && !t.printed[d.Module] {
+			t.module(d.Module, indent+next)
+		}
+	}
+}
+
+func (t *treeWriter) dependency(d *depends.Dependency) string {
+	s := d.Name
+	if d.Host != d.Name && d.Host != "" {
+		s += " -> " + d.Host
+	}
+	if d.Missing() {
+		if d.Weak {
+			return s + " [missing, weak]"
+		}
+		return t.highlight(colorRed, s+" [missing]")
+	}
+	if d.Path != "" && d.Path != d.Name {
+		s += " => " + d.Path
+	}
+	s += " [" + d.Location.String()
+	if d.Delay {
+		s += ", delay"
+	}
+	if d.Weak {
+		s += ", weak"
+	}
+	if d.Cycle {
+		s += ", cycle"
+	} else if d.Module != nil && t.printed[d.Module] {
+		s += ", see above"
+	}
+	return s + "]"
+}
+
+type jsonDependency struct {
+	Name     string `json:"name"`
+	Host     string `json:"host,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Location string `json:"location"`
+	Missing  bool   `json:"missing,omitempty"`
+	Delay    bool   `json:"delay,omitempty"`
+	Weak     bool   `json:"weak,omitempty"`
+	Cycle    bool   `json:"cycle,omitempty"`
+}
+
+type jsonModule struct {
+	Path       string           `json:"path"`
+	Format     string           `json:"format"`
+	Error      string           `json:"error,omitempty"`
+	Warnings   []string         `json:"warnings,omitempty"`
+	Unresolved []string         `json:"unresolved,omitempty"`
+	Deps       []jsonDependency `json:"deps"`
+}
+
+type jsonGraph struct {
+	Root    string       `json:"root"`
+	Modules []jsonModule `json:"modules"`
+	Missing []string     `json:"missing"`
+	Cycles  [][]string   `json:"cycles"`
+}
+
+// writeJSON prints the modules of the graph, with the dependencies
+// referring to the modules by path.
+func writeJSON(w io.Writer, g *depends.Graph) error {
+	jg := jsonGraph{Root: g.Root.Path, Missing: g.Missing(), Cycles: [][]string{}}
+	if jg.Missing == nil {
+		jg.Missing = []string{}
+	}
+	for _, m := range g.Modules {
+		jm := jsonModule{Path: m.Path, Format: formatName(m.Format), Deps: []jsonDependency{}}
+		if m.Err != nil {
+			jm.Error = m.Err.Error()
+		}
+		for _, err := range m.Warnings {
+			jm.Warnings = append(jm.Warnings, err.Error())
+		}
+		for _, s := range m.Unresolved {
+			jm.Unresolved = append(jm.Unresolved, s.String())
+		}
+		for _, d := range m.Deps {
+			jd := jsonDependency{
+				Name:     d.Name,
+				Path:     d.Path,
+				Location: d.Location.String(),
+				Missing:  d.Missing(),
+				Delay:    d.Delay,
+				Weak:     d.Weak,
+				Cycle:    d.Cycle,
+			}
+			if d.Host != d.Name {
+				jd.Host = d.Host
+			}
+			jm.Deps = append(jm.Deps, jd)
+		}
+		jg.Modules = append(jg.Modules, jm)
+	}
+	for _, c := range g.Cycles {
+		paths := make([]string, len(c))
+		for i, m := range c {
+			paths[i] = m.Path
+		}
+		jg.Cycles = append(jg.Cycles, paths)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jg)
+}
+
+// writeDOT prints the graph in the Graphviz DOT language. Missing
+// modules are red, modules with unresolved imports orange, libraries
+// provided by the system without a file grey.
+func writeDOT(w io.Writer, g *depends.Graph) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph depends {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	ids := make(map[string]string)
+	node := func(key, label, attrs string) string {
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		id := "n" + strconv.Itoa(len(ids))
+		ids[key] = id
+		fmt.Fprintf(bw, "\t%s [label=%s%s];\n", id, strconv.Quote(label), attrs)
+		return id
+	}
+	for _, m := range g.Modules {
+		label, attrs := filepath.Base(m.Path), ""
+		switch {
+		case m.Err != nil:
+			attrs = ", color=red"
+		case len(m.Unresolved) != 0:
+			label += fmt.Sprintf("\n%d unresolved", len(m.Unresolved))
+			attrs = ", color=orange"
+		}
+		node(m.Path, label, attrs)
+	}
+	for _, m := range g.Modules {
+		from := ids[m.Path]
+		for _, d := range m.Deps {
+			var to string
+			switch {
+			case d.Module != nil:
+				to = ids[d.Module.Path]
+			case d.Missing():
+				to = node("missing:"+d.Name, d.Name, ", color=red, fontcolor=red, style=dashed")
+			default:
+				to = node("system:"+d.Host, d.Host, ", color=grey, fontcolor=grey")
+			}
+			var attrs []string
+			if d.Host != d.Name {
+				attrs = append(attrs, "label="+strconv.Quote(d.Name))
+			}
+			if d.Delay || d.Weak {
+				attrs = append(attrs, "style=dashed")
+			}
+			if d.Cycle {
+				attrs = append(attrs, "color=blue")
+			}
+			fmt.Fprintf(bw, "\t%s -> %s", from, to)
+			for i, a := range attrs {
+				sep := ", "
+				if i == 0 {
+					sep = " ["
+				}
+				fmt.Fprint(bw, sep+a)
+			}
+			if len(attrs) != 0 {
+				fmt.Fprint(bw, "]")
+			}
+			fmt.Fprintln(bw, ";")
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -25,6 +25,35 @@ func main() {
 		os.Exit(1)
 	}
 	defer fd.Close()
+	if u := fd.UUID(); u != nil {
+		fmt.Fprintf(os.Stderr, "UUID: %s\n", u)
+	}
+	if platform, minos, ok := fd.MinOS(); ok {
+		fmt.Fprintf(os.Stderr, "MinOS: %s %s\n", platform, minos)
+	}
+	for _, l := range fd.Loads {
+		switch l := l.(type) {
+		case *macho.BuildVersion:
+			fmt.Fprintf(os.Stderr, "SDK: %s\n", l.SDK)
+			for _, t := range l.Tools {
+				fmt.Fprintf(os.Stderr, "Tool: %s %s\n", t.Tool, t.Version)
+			}
+		case *macho.VersionMin:
+			fmt.Fprintf(os.Stderr, "SDK: %s\n", l.SDK)
+		case *macho.DylibID:
+			fmt.Fprintf(os.Stderr, "ID: %s\n", l.Name)
+		case *macho.Dylinker:
+			fmt.Fprintf(os.Stderr, "Dylinker: %s\n", l.Name)
+		case *macho.EntryPoint:
+			fmt.Fprintf(os.Stderr, "EntryOff: %#x\n", l.EntryOff)
+		case *macho.SourceVersion:
+			fmt.Fprintf(os.Stderr, "SourceVersion: %s\n", l)
+		case *macho.EncryptionInfo:
+			fmt.Fprintf(os.Stderr, "Encrypted: %v\n", l.CryptID != 0)
+		case *macho.LinkerOption:
+			fmt.Fprintf(os.Stderr, "LinkerOption: %v\n", l.Options)
+		}
+	}
 	if size > int64(fd.OverlayOffset) {
 		overlay, err := fd.Overlay()
 		if err != nil && err != macho.ErrNoOverlayFound {
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/fcharlie/buna/debug/pe"
 	"github.com/fcharlie/buna/demangle"
@@ -34,7 +36,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Ordinal%d (Ordinal %d)\n", n.Ordinal, n.Ordinal)
 		}
 	}
-	for dll, ims := range ft.Imports {
+	for dll, ims := range ft.Delay {
 		fmt.Fprintf(os.Stderr, "\x1b[34mDelay DllName: %s\x1b[0m\n", dll)
 		for _, n := range ims {
 			if n.Ordinal == 0 {
@@ -44,6 +46,15 @@ func main() {
 			fmt.Fprintf(os.Stderr, "(Delay) Ordinal%d (Ordinal %d)\n", n.Ordinal, n.Ordinal)
 		}
 	}
+	if ft.BoundErr != nil {
+		fmt.Fprintf(os.Stderr, "\x1b[36mBound: invalid bound import directory: %v\x1b[0m\n", ft.BoundErr)
+	}
+	for dll, b := range ft.Bound {
+		fmt.Fprintf(os.Stderr, "\x1b[36mBound: %s %s%s\x1b[0m\n", dll, time.Unix(int64(b.TimeDateStamp), 0).UTC().Format(time.RFC3339), staleBinding(&b, filepath.Join(filepath.Dir(os.Args[1]), dll)))
+		for _, r := range b.Forwarders {
+			fmt.Fprintf(os.Stderr, "\x1b[36m  --> %s %s\x1b[0m\n", r.ModuleName, time.Unix(int64(r.TimeDateStamp), 0).UTC().Format(time.RFC3339))
+		}
+	}
 	for _, d := range ft.Exports {
 		if len(d.Name) == 0 {
 			if len(d.ForwardName) != 0 {
@@ -67,3 +78,17 @@ func main() {
 	// }
 	// fmt.Fprintf(os.Stderr, "Overlay: %v\n", string(overlay))
 }
+
+// staleBinding checks the binding against the DLL next to the image, if
+// there is one.
+func staleBinding(b *pe.BoundImport, p string) string {
+	dll, err := pe.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer dll.Close()
+	if b.Stale(dll) {
+		return " (stale)"
+	}
+	return ""
+}